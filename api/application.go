@@ -6,6 +6,7 @@ import (
 	"github.com/project-xpolaris/youplustoolkit/youlink"
 	"log"
 	"youfile/config"
+	"youfile/service"
 )
 
 func RunApiService() {
@@ -13,6 +14,7 @@ func RunApiService() {
 	engine.UseMiddleware(middleware.NewLoggerMiddleware())
 	engine.UseMiddleware(&AuthMiddleware{})
 	SetRouter(engine)
+	service.DefaultMountMonitor.SetNotifier(newMountMonitorNotifier())
 	if config.Instance.YouLink.Enable {
 		service := youlink.NewService(config.Instance.YouLink.Url, config.Instance.YouLink.ServiceUrl)
 		service.AddFunction(
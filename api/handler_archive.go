@@ -1,20 +1,27 @@
 package api
 
 import (
+	"errors"
 	"github.com/allentom/haruka"
 	"net/http"
 	"path/filepath"
 	"strings"
 	"youfile/service"
+	"youfile/template"
 )
 
 type CreateExtractTaskRequestBody struct {
 	Input []struct {
-		Input    string `json:"input"`
-		Output   string `json:"output"`
-		Password string `json:"password"`
-		InPlace  bool   `json:"inPlace"`
+		Input           string   `json:"input"`
+		Output          string   `json:"output"`
+		Password        string   `json:"password"`
+		InPlace         bool     `json:"inPlace"`
+		Entries         []string `json:"entries"`
+		StripComponents int      `json:"stripComponents"`
+		Flatten         bool     `json:"flatten"`
 	} `json:"input"`
+	// try passwords saved by user before ask for password
+	UseSavedPasswords bool `json:"useSavedPasswords"`
 }
 
 var newExtractTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -24,6 +31,7 @@ var newExtractTaskHandler haruka.RequestHandler = func(context *haruka.Context)
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
+	username := context.Param["username"].(string)
 	input := make([]*service.ExtractInput, 0)
 	realPathMapping := map[string]string{}
 	for _, raw := range requestBody.Input {
@@ -46,36 +54,65 @@ var newExtractTaskHandler haruka.RequestHandler = func(context *haruka.Context)
 			return
 		}
 		realPathMapping[raw.Output] = rawOutput
-		input = append(input, &service.ExtractInput{
+		extractInput := &service.ExtractInput{
 			Input:    raw.Input,
 			Output:   raw.Output,
 			Password: raw.Password,
-		})
+		}
+		if len(raw.Entries) > 0 || raw.StripComponents > 0 || raw.Flatten {
+			extractInput.Selection = &service.ExtractSelection{
+				Entries:         raw.Entries,
+				StripComponents: raw.StripComponents,
+				Flatten:         raw.Flatten,
+			}
+		}
+		input = append(input, extractInput)
 	}
 	task := service.DefaultTask.NewExtractTask(input, service.ExtractTaskOption{
 		OnComplete: func(id string) {
-			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
 				"event": EventUnarchiveComplete,
 				"id":    id,
-			})
+			}, username)
+		},
+		OnError: func(task *service.ExtractTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventUnarchiveError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnNeedPassword: func(task *service.ExtractTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventUnarchiveNeedPassword,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
 		},
+		UseSavedPasswords: requestBody.UseSavedPasswords,
 		OnFileExtractComplete: func(id string, output string) {
-			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
 				"event": EventUnarchiveFileComplete,
 				"id":    id,
 				"path":  realPathMapping[output],
 				"dir":   filepath.Dir(realPathMapping[output]),
-			})
+			}, username)
 		},
 		DisplayPath: realPathMapping,
-	}, context.Param["username"].(string))
+	}, username)
 	go task.Run()
 	context.JSON(task)
 }
 
 type CreateArchiveTaskRequestBody struct {
-	Sources []string `json:"sources"`
-	Target  string   `json:"target"`
+	Sources       []string `json:"sources"`
+	Target        string   `json:"target"`
+	Format        string   `json:"format"`
+	Level         int      `json:"level"`
+	Password      string   `json:"password"`
+	EncryptHeader bool     `json:"encryptHeader"`
+	Excludes      []string `json:"excludes"`
+	VolumeSize    int64    `json:"volumeSize"`
 }
 
 var newArchiveTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -85,6 +122,22 @@ var newArchiveTaskHandler haruka.RequestHandler = func(context *haruka.Context)
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
+	if len(requestBody.Format) > 0 {
+		requestBody.Target = service.WithArchiveExtension(requestBody.Target, requestBody.Format)
+	}
+	format := service.ArchiveFormatOf(requestBody.Target)
+	if len(format) == 0 {
+		AbortErrorWithStatus(service.ArchiveFormatNotSupported, context, http.StatusBadRequest)
+		return
+	}
+	if requestBody.Level < 0 || requestBody.Level > 9 {
+		AbortErrorWithStatus(errors.New("level must be between 0 and 9"), context, http.StatusBadRequest)
+		return
+	}
+	if requestBody.VolumeSize < 0 || (requestBody.VolumeSize > 0 && requestBody.VolumeSize < service.MinArchiveVolumeSize) {
+		AbortErrorWithStatus(service.ArchiveVolumeTooSmall, context, http.StatusBadRequest)
+		return
+	}
 	sourceRealPaths := make([]string, 0)
 	for _, source := range requestBody.Sources {
 		realPath, err := service.GetRealPath(source, context.Param["token"].(string))
@@ -100,13 +153,229 @@ var newArchiveTaskHandler haruka.RequestHandler = func(context *haruka.Context)
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
-	task := service.DefaultTask.NewArchiveTask(requestBody.Sources, requestBody.Target, func(id string, target string) {
-		DefaultNotificationManager.sendJSONToAll(haruka.JSON{
-			"event":  EventArchiveComplete,
-			"id":     id,
-			"target": rawTarget,
-		})
-	}, context.Param["username"].(string))
+	username := context.Param["username"].(string)
+	task := service.DefaultTask.NewArchiveTask(&service.NewArchiveTaskOption{
+		Sources:       sourceRealPaths,
+		Target:        requestBody.Target,
+		Format:        format,
+		Level:         requestBody.Level,
+		Password:      requestBody.Password,
+		EncryptHeader: requestBody.EncryptHeader,
+		Excludes:      requestBody.Excludes,
+		VolumeSize:    requestBody.VolumeSize,
+		Username:      username,
+		OnComplete: func(id string, target string) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event":  EventArchiveComplete,
+				"id":     id,
+				"target": rawTarget,
+			}, username)
+		},
+		OnError: func(task *service.ArchiveTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event":  EventArchiveError,
+				"id":     task.Id,
+				"target": rawTarget,
+				"task":   template.NewTaskTemplate(task),
+			}, username)
+		},
+	})
 	go task.Run()
 	context.JSON(task)
 }
+
+type ArchiveListRequestBody struct {
+	Path     string `json:"path"`
+	Password string `json:"password"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+var archiveListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody ArchiveListRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	target, err := service.GetRealPath(requestBody.Path, context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	page := requestBody.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := requestBody.PageSize
+	if pageSize < 1 {
+		pageSize = 50
+	}
+	entries, err := service.ListArchive(target, requestBody.Password)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	count := len(entries)
+	start := (page - 1) * pageSize
+	if start > count {
+		start = count
+	}
+	end := start + pageSize
+	if end > count {
+		end = count
+	}
+	context.JSON(haruka.JSON{
+		"success":  true,
+		"count":    count,
+		"page":     page,
+		"pageSize": pageSize,
+		"result":   template.NewArchiveEntryListTemplate(entries[start:end]),
+	})
+}
+
+type CreateArchiveTestTaskRequestBody struct {
+	// archives or folders contain archives
+	Sources  []string `json:"sources"`
+	Password string   `json:"password"`
+}
+
+var newArchiveTestTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody CreateArchiveTestTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Sources) == 0 {
+		AbortErrorWithStatus(errors.New("sources is required"), context, http.StatusBadRequest)
+		return
+	}
+	username := context.Param["username"].(string)
+	sourceRealPaths := make([]string, 0)
+	displayPath := map[string]string{}
+	for _, source := range requestBody.Sources {
+		realPath, err := service.GetRealPath(source, context.Param["token"].(string))
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		sourceRealPaths = append(sourceRealPaths, realPath)
+		displayPath[realPath] = source
+	}
+	task := service.DefaultTask.NewArchiveTestTask(&service.NewArchiveTestTaskOption{
+		Sources:     sourceRealPaths,
+		Password:    requestBody.Password,
+		DisplayPath: displayPath,
+		Username:    username,
+		OnComplete: func(task *service.ArchiveTestTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventArchiveTestComplete,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnError: func(task *service.ArchiveTestTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventArchiveTestError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+	})
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
+
+type SupplyExtractPasswordRequestBody struct {
+	Id string `json:"id"`
+	// input waiting for password is skipped if password is empty
+	Password string `json:"password"`
+	// add password to saved list if it is correct
+	Save bool `json:"save"`
+}
+
+var supplyExtractPasswordHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody SupplyExtractPasswordRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	task, ok := service.DefaultTask.GetTask(requestBody.Id).(*service.ExtractTask)
+	if !ok || task.GetUsername() != context.Param["username"].(string) {
+		AbortErrorWithStatus(errors.New("task not found"), context, http.StatusNotFound)
+		return
+	}
+	err = task.SupplyPassword(requestBody.Password, requestBody.Save)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
+
+var archivePasswordListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	passwords, err := service.GetArchivePasswords(context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewArchivePasswordListTemplate(passwords),
+	})
+}
+
+type SaveArchivePasswordRequestBody struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+var saveArchivePasswordHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody SaveArchivePasswordRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Password) == 0 {
+		AbortErrorWithStatus(errors.New("password is required"), context, http.StatusBadRequest)
+		return
+	}
+	password, err := service.SaveArchivePassword(context.Param["username"].(string), requestBody.Name, requestBody.Password)
+	if err == service.MasterKeyNotSet {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewArchivePasswordTemplate(password),
+	})
+}
+
+var removeArchivePasswordHandler haruka.RequestHandler = func(context *haruka.Context) {
+	id, err := context.GetQueryInt("id")
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.RemoveArchivePassword(uint(id), context.Param["username"].(string))
+	if err == service.ArchivePasswordNotFound {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"github.com/allentom/haruka"
+	"net/http"
+	"path/filepath"
+	"time"
+	"youfile/service"
+	"youfile/template"
+)
+
+var audioTagHandler haruka.RequestHandler = func(context *haruka.Context) {
+	realPath, err := service.GetRealPath(context.GetQueryString("path"), context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	audioTag, err := service.ReadAudioTag(realPath)
+	if err != nil {
+		if err == service.AudioTagNotSupported {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewAudioTagTemplate(realPath, audioTag),
+	})
+}
+
+var audioCoverHandler haruka.RequestHandler = func(context *haruka.Context) {
+	realPath, err := service.GetRealPath(context.GetQueryString("path"), context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	audioTag, err := service.ReadAudioTag(realPath)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if audioTag.Picture == nil {
+		AbortErrorWithStatus(service.AudioCoverNotFound, context, http.StatusNotFound)
+		return
+	}
+	if len(audioTag.Picture.MIMEType) > 0 {
+		context.Writer.Header().Set("Content-Type", audioTag.Picture.MIMEType)
+	}
+	http.ServeContent(context.Writer, context.Request, filepath.Base(realPath), time.Time{}, bytes.NewReader(audioTag.Picture.Data))
+}
+
+type AudioCoverRequestBody struct {
+	MimeType string `json:"mimeType"`
+	// base64 encoded image
+	Data []byte `json:"data"`
+}
+
+type CreateAudioTagTaskRequestBody struct {
+	Files       []string `json:"files"`
+	Title       *string  `json:"title"`
+	Artist      *string  `json:"artist"`
+	Album       *string  `json:"album"`
+	AlbumArtist *string  `json:"albumArtist"`
+	Genre       *string  `json:"genre"`
+	Composer    *string  `json:"composer"`
+	Comment     *string  `json:"comment"`
+	Year        *int     `json:"year"`
+	Track       *int     `json:"track"`
+	TrackTotal  *int     `json:"trackTotal"`
+	Disc        *int     `json:"disc"`
+	DiscTotal   *int     `json:"discTotal"`
+	// cover art replace all pictures in file
+	Cover       *AudioCoverRequestBody `json:"cover"`
+	RemoveCover bool                   `json:"removeCover"`
+}
+
+func audioTagTaskOption(username string) *service.NewAudioTagTaskOption {
+	return &service.NewAudioTagTaskOption{
+		Username: username,
+		OnComplete: func(task *service.AudioTagTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventAudioTagTaskComplete,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnError: func(task *service.AudioTagTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventAudioTagTaskError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+	}
+}
+
+var newAudioTagTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody CreateAudioTagTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Files) == 0 {
+		AbortErrorWithStatus(errors.New("files is required"), context, http.StatusBadRequest)
+		return
+	}
+	edit := &service.AudioTagEdit{
+		Title:         requestBody.Title,
+		Artist:        requestBody.Artist,
+		Album:         requestBody.Album,
+		AlbumArtist:   requestBody.AlbumArtist,
+		Genre:         requestBody.Genre,
+		Composer:      requestBody.Composer,
+		Comment:       requestBody.Comment,
+		Year:          requestBody.Year,
+		Track:         requestBody.Track,
+		TrackTotal:    requestBody.TrackTotal,
+		Disc:          requestBody.Disc,
+		DiscTotal:     requestBody.DiscTotal,
+		RemovePicture: requestBody.RemoveCover,
+	}
+	if requestBody.Cover != nil {
+		if len(requestBody.Cover.Data) == 0 {
+			AbortErrorWithStatus(errors.New("data of cover is required"), context, http.StatusBadRequest)
+			return
+		}
+		mimeType := requestBody.Cover.MimeType
+		if len(mimeType) == 0 {
+			mimeType = http.DetectContentType(requestBody.Cover.Data)
+		}
+		edit.Picture = &service.AudioPicture{MIMEType: mimeType, Data: requestBody.Cover.Data}
+	}
+	username := context.Param["username"].(string)
+	realPaths := make([]string, 0)
+	displayPath := map[string]string{}
+	for _, file := range requestBody.Files {
+		realPath, err := service.GetRealPath(file, context.Param["token"].(string))
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		realPaths = append(realPaths, realPath)
+		displayPath[realPath] = file
+	}
+	option := audioTagTaskOption(username)
+	option.Files = realPaths
+	option.Edit = edit
+	option.DisplayPath = displayPath
+	task := service.DefaultTask.NewAudioTagTask(option)
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
+
+type UndoAudioTagTaskRequestBody struct {
+	Id string `json:"id"`
+}
+
+var undoAudioTagTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody UndoAudioTagTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	username := context.Param["username"].(string)
+	tagTask, ok := service.DefaultTask.GetTask(requestBody.Id).(*service.AudioTagTask)
+	if !ok || tagTask.GetUsername() != username {
+		AbortErrorWithStatus(errors.New("task not found"), context, http.StatusNotFound)
+		return
+	}
+	task, err := service.DefaultTask.NewAudioTagUndoTask(tagTask, audioTagTaskOption(username))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/service"
+	"youfile/template"
+)
+
+type CreateDiskUsageTaskRequestBody struct {
+	Path string `json:"path"`
+	Top  int    `json:"top"`
+}
+
+var newDiskUsageTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody CreateDiskUsageTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	username := context.Param["username"].(string)
+	realPath, err := service.GetRealPath(requestBody.Path, context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	task := service.DefaultTask.NewDiskUsageTask(&service.NewDiskUsageTaskOption{
+		Src:  realPath,
+		TopN: requestBody.Top,
+		OnDone: func(task *service.DiskUsageTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventDiskUsageTaskComplete,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnError: func(task *service.DiskUsageTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventDiskUsageTaskError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		PathTrans: requestBody.Path,
+		Username:  username,
+	})
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
+
+var diskUsageNodeHandler haruka.RequestHandler = func(context *haruka.Context) {
+	task, ok := service.DefaultTask.GetTask(context.GetQueryString("taskId")).(*service.DiskUsageTask)
+	if !ok || task.GetUsername() != context.Param["username"].(string) {
+		AbortErrorWithStatus(errors.New("task not found"), context, http.StatusNotFound)
+		return
+	}
+	limit, err := context.GetQueryInt("limit")
+	if err != nil {
+		limit = 0
+	}
+	target := context.GetQueryString("path")
+	if len(target) > 0 {
+		target, err = service.GetRealPath(target, context.Param["token"].(string))
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+	}
+	node, err := task.QueryNode(target, limit)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewDiskUsageNodeTemplate(node, task.Option.Src, task.Option.PathTrans),
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/service"
+	"youfile/template"
+)
+
+type CreateFindDuplicatesTaskRequestBody struct {
+	Paths   []string `json:"paths"`
+	MinSize int64    `json:"minSize"`
+}
+
+var newFindDuplicatesTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody CreateFindDuplicatesTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Paths) == 0 {
+		AbortErrorWithStatus(errors.New("paths is required"), context, http.StatusBadRequest)
+		return
+	}
+	username := context.Param["username"].(string)
+	realPaths := make([]string, 0)
+	displayPath := map[string]string{}
+	for _, path := range requestBody.Paths {
+		realPath, err := service.GetRealPath(path, context.Param["token"].(string))
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		realPaths = append(realPaths, realPath)
+		displayPath[realPath] = path
+	}
+	task := service.DefaultTask.NewFindDuplicatesTask(&service.NewFindDuplicatesTaskOption{
+		Src:     realPaths,
+		MinSize: requestBody.MinSize,
+		OnDone: func(task *service.FindDuplicatesTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventFindDuplicatesTaskComplete,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnError: func(task *service.FindDuplicatesTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventFindDuplicatesTaskError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		DisplayPath: displayPath,
+		Username:    username,
+	})
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
+
+func getFindDuplicatesTask(context *haruka.Context, taskId string) (*service.FindDuplicatesTask, bool) {
+	task, ok := service.DefaultTask.GetTask(taskId).(*service.FindDuplicatesTask)
+	if !ok || task.GetUsername() != context.Param["username"].(string) {
+		AbortErrorWithStatus(errors.New("task not found"), context, http.StatusNotFound)
+		return nil, false
+	}
+	if task.GetStatus() != service.TaskStateComplete {
+		AbortErrorWithStatus(errors.New("task is not complete"), context, http.StatusBadRequest)
+		return nil, false
+	}
+	return task, true
+}
+
+var duplicateGroupListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	task, ok := getFindDuplicatesTask(context, context.GetQueryString("taskId"))
+	if !ok {
+		return
+	}
+	page, err := context.GetQueryInt("page")
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := context.GetQueryInt("pageSize")
+	if err != nil {
+		pageSize = 20
+	}
+	groups, total := task.GetGroups(page, pageSize)
+	context.JSON(haruka.JSON{
+		"success":  true,
+		"count":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"result":   template.NewDuplicateGroupListTemplate(groups, task.Option.DisplayPath),
+	})
+}
+
+type ResolveDuplicateRequestBody struct {
+	TaskId   string `json:"taskId"`
+	Groups   []int  `json:"groups"`
+	Action   string `json:"action"`
+	Keep     string `json:"keep"`
+	KeepPath string `json:"keepPath"`
+}
+
+var resolveDuplicateHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody ResolveDuplicateRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	task, ok := getFindDuplicatesTask(context, requestBody.TaskId)
+	if !ok {
+		return
+	}
+	if requestBody.Keep == service.DuplicateKeepPath {
+		if len(requestBody.Groups) != 1 {
+			AbortErrorWithStatus(errors.New("keep path require exactly one group"), context, http.StatusBadRequest)
+			return
+		}
+		requestBody.KeepPath, err = service.GetRealPath(requestBody.KeepPath, context.Param["token"].(string))
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+	}
+	results, err := task.Resolve(requestBody.Groups, service.ResolveDuplicateOption{
+		Action:      requestBody.Action,
+		Keep:        requestBody.Keep,
+		KeepPath:    requestBody.KeepPath,
+		Username:    context.Param["username"].(string),
+		DisplayPath: task.Option.DisplayPath,
+	})
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewResolveDuplicateResultTemplate(results, task.Option.DisplayPath),
+	})
+}
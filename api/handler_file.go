@@ -66,11 +66,19 @@ var writeFileHandler haruka.RequestHandler = func(context *haruka.Context) {
 			return
 		}
 	}
+	username := context.Param["username"].(string)
+	writeDelta := service.FileWriteDelta(requestBody.FilePath, int64(len(requestBody.Content)))
+	_, err = service.CheckQuota(username, map[string]int64{requestBody.FilePath: writeDelta})
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInsufficientStorage)
+		return
+	}
 	err = service.WriteTextFile(requestBody.FilePath, requestBody.Content)
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
 		return
 	}
+	service.AddQuotaUsage(username, requestBody.FilePath, writeDelta)
 	err = context.JSON(haruka.JSON{
 		"result": "success",
 	})
@@ -98,8 +106,18 @@ var readAsTextFileHandler haruka.RequestHandler = func(context *haruka.Context)
 }
 
 var getFileThumbnailHandler haruka.RequestHandler = func(context *haruka.Context) {
-	path := context.GetQueryString("name")
-	http.ServeFile(context.Writer, context.Request, filepath.Join("./thumbnails", path))
+	// thumbnail of other size is served if size is given
+	thumbnailPath, err := service.ThumbnailPath(context.GetQueryString("name"), context.GetQueryString("size"))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.TouchThumbnail(thumbnailPath)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	http.ServeFile(context.Writer, context.Request, thumbnailPath)
 }
 
 var readDirHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -117,15 +135,32 @@ var readDirHandler haruka.RequestHandler = func(context *haruka.Context) {
 		return
 	}
 	if thumbnail != "0" && config.Instance.Thumbnails {
-		go service.GenerateImageThumbnail(realPath, func() {
-			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
-				"event": GenerateThumbnailComplete,
-				"path":  readPath,
-			})
+		username := context.Param["username"].(string)
+		err = service.DefaultThumbnailService.GenerateDirectory(realPath, service.ThumbnailPriorityView, &service.ThumbnailNotifier{
+			OnFileComplete: func(path string, thumbnail string) {
+				DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+					"event":     EventThumbnailFileComplete,
+					"path":      filepath.Join(readPath, filepath.Base(path)),
+					"thumbnail": thumbnail,
+				}, username)
+			},
+			OnComplete: func() {
+				DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+					"event": GenerateThumbnailComplete,
+					"path":  readPath,
+				}, username)
+			},
 		})
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+			return
+		}
 	}
 
 	data := template.NewFileListTemplate(items, readPath, realPath)
+	if context.GetQueryString("meta") == "1" {
+		data.AttachImageMeta(realPath)
+	}
 	err = context.JSON(data)
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
@@ -332,7 +367,27 @@ var downloadFileHandler haruka.RequestHandler = func(context *haruka.Context) {
 		}
 	}
 	context.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(util.ConvertPathWithOS(targetPath))))
-	http.ServeFile(context.Writer, context.Request, targetPath)
+	serveAppFile(context, targetPath)
+}
+
+// serveAppFile serve file read from service.AppFs, so entry of archive can be served too
+func serveAppFile(context *haruka.Context, target string) {
+	file, err := service.AppFs.Open(target)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		AbortErrorWithStatus(errors.New("target is a directory"), context, http.StatusBadRequest)
+		return
+	}
+	http.ServeContent(context.Writer, context.Request, info.Name(), info.ModTime(), file)
 }
 
 var chmodFileHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -409,5 +464,47 @@ var getFileHandler haruka.RequestHandler = func(context *haruka.Context) {
 			return
 		}
 	}
-	http.ServeFile(context.Writer, context.Request, targetPath)
+	serveAppFile(context, targetPath)
+}
+
+var previewFileHandler haruka.RequestHandler = func(context *haruka.Context) {
+	realPath, err := service.GetRealPath(context.GetQueryString("path"), context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	size := context.GetQueryString("size")
+	if len(size) == 0 {
+		size = config.ThumbnailSizeLarge
+	}
+	preview, err := service.GetFilePreview(realPath, size)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewPreviewTemplate(preview),
+	})
+}
+
+var imageMetaHandler haruka.RequestHandler = func(context *haruka.Context) {
+	realPath, err := service.GetRealPath(context.GetQueryString("path"), context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if !service.IsImageMetaSupported(realPath) {
+		AbortErrorWithStatus(errors.New("metadata of file is not supported"), context, http.StatusBadRequest)
+		return
+	}
+	meta, err := service.GetImageMeta(realPath)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewImageMetaTemplate(meta),
+	})
 }
@@ -1,9 +1,10 @@
 package api
 
 import (
+	"errors"
 	"github.com/ahmetb/go-linq/v3"
 	"github.com/allentom/haruka"
-	"github.com/d-tux/go-fstab"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"youfile/config"
 	"youfile/service"
@@ -11,16 +12,43 @@ import (
 )
 
 var fstabMountListHandler haruka.RequestHandler = func(context *haruka.Context) {
-	data := service.DefaultFstab.Mounts
-	linq.From(data).Where(func(i interface{}) bool {
-		for _, point := range config.Instance.MountPoints {
-			if point == i.(*fstab.Mount).File {
-				return true
-			}
+	mounts := service.GetManagedMounts()
+	statuses, err := service.DefaultMountMonitor.Statuses(mounts)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(template.MountTemplateFromList(mounts, statuses))
+}
+
+// fstabErrorStatus return bad request for fstab rejected by validation or dry run
+func fstabErrorStatus(err error) int {
+	if errors.Is(err, service.FstabInvalid) || errors.Is(err, service.FstabDryRunFailed) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// saveFstab save fstab then reload it, unsaved change is dropped from loaded fstab if save failed
+func saveFstab() error {
+	err := service.DefaultFstab.Save()
+	if err != nil {
+		if loadErr := service.LoadFstab(); loadErr != nil {
+			logrus.Error(loadErr)
 		}
-		return false
-	}).ToSlice(&data)
-	context.JSON(template.MountTemplateFromList(data))
+		return err
+	}
+	return service.DefaultFstab.Reload()
+}
+
+// saveFstabMount save fstab with mount added, then mount it and show it in mount list
+func saveFstabMount(file string) error {
+	err := saveFstab()
+	if err != nil {
+		return err
+	}
+	config.Instance.MountPoints = append(config.Instance.MountPoints, file)
+	return config.SaveMounts()
 }
 
 var fstabAddMountHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -30,21 +58,14 @@ var fstabAddMountHandler haruka.RequestHandler = func(context *haruka.Context) {
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
-	service.DefaultFstab.AddMount(&requestBody)
-	err = service.DefaultFstab.Save()
+	err = service.DefaultFstab.AddMount(&requestBody)
 	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
-	config.Instance.MountPoints = append(config.Instance.MountPoints, requestBody.File)
-	err = config.SaveMounts()
+	err = saveFstabMount(requestBody.File)
 	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
-		return
-	}
-	err = service.DefaultFstab.Reload()
-	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		AbortErrorWithStatus(err, context, fstabErrorStatus(err))
 		return
 	}
 	err = context.JSON(map[string]interface{}{
@@ -59,9 +80,9 @@ var fstabRemoveMountHandler haruka.RequestHandler = func(context *haruka.Context
 		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
 		return
 	}
-	err = service.DefaultFstab.Save()
+	err = saveFstab()
 	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		AbortErrorWithStatus(err, context, fstabErrorStatus(err))
 		return
 	}
 	linq.From(config.Instance.MountPoints).Where(func(i interface{}) bool {
@@ -72,7 +93,8 @@ var fstabRemoveMountHandler haruka.RequestHandler = func(context *haruka.Context
 		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
 		return
 	}
-	err = service.DefaultFstab.Reload()
+	// detached only when fstab without it is saved, share is kept mounted if save is rejected
+	err = service.DetachMount(dirPath)
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
 		return
@@ -82,13 +104,14 @@ var fstabRemoveMountHandler haruka.RequestHandler = func(context *haruka.Context
 	})
 }
 
+// fstabReMountHandler save fstab, then mount every entry not mounted
 var fstabReMountHandler haruka.RequestHandler = func(context *haruka.Context) {
-	err := service.DefaultFstab.Save()
+	err := saveFstab()
 	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		AbortErrorWithStatus(err, context, fstabErrorStatus(err))
 		return
 	}
-	err = service.DefaultFstab.Reload()
+	err = service.DefaultFstab.MountAll()
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
 		return
@@ -97,3 +120,57 @@ var fstabReMountHandler haruka.RequestHandler = func(context *haruka.Context) {
 		"result": "success",
 	})
 }
+
+var fstabCheckHandler haruka.RequestHandler = func(context *haruka.Context) {
+	err := service.DefaultFstab.DryRun()
+	if err != nil && fstabErrorStatus(err) != http.StatusBadRequest {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewFstabCheckTemplate(err),
+	})
+}
+
+var fstabBackupListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	backups, err := service.GetFstabBackups()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewFstabBackupTemplateList(backups),
+	})
+}
+
+type RestoreFstabRequestBody struct {
+	Name string `json:"name"`
+}
+
+var fstabRestoreHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody RestoreFstabRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.RestoreFstabBackup(requestBody.Name)
+	if err != nil {
+		if err == service.FstabBackupNotFound {
+			AbortErrorWithStatus(err, context, http.StatusNotFound)
+			return
+		}
+		AbortErrorWithStatus(err, context, fstabErrorStatus(err))
+		return
+	}
+	err = service.DefaultFstab.Reload()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+	})
+}
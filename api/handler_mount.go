@@ -5,27 +5,69 @@ import (
 	"net/http"
 	"youfile/config"
 	"youfile/service"
+	"youfile/template"
 )
 
-var mountCifsHandler haruka.RequestHandler = func(context *haruka.Context) {
-	var requestBody service.MountCIFSOption
-	err := context.ParseJson(&requestBody)
+var mountProviderListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewMountProviderTemplateList(service.MountProviders),
+	})
+}
+
+// parseMountOption parse typed option of provider in path from request body
+func parseMountOption(context *haruka.Context) (service.MountProvider, service.MountOption, error) {
+	provider, err := service.GetMountProvider(context.GetPathParameterAsString("provider"))
 	if err != nil {
-		AbortErrorWithStatus(err, context, http.StatusBadRequest)
-		return
+		return nil, nil, err
+	}
+	option := provider.NewOption()
+	err = context.ParseJson(option)
+	if err != nil {
+		return nil, nil, err
 	}
 	if config.Instance.YouPlusPath {
-		requestBody.MountPath, err = service.GetRealPath(requestBody.MountPath, context.Param["token"].(string))
+		mountPath, err := service.GetRealPath(option.GetMountPath(), context.Param["token"].(string))
 		if err != nil {
-			AbortErrorWithStatus(err, context, http.StatusBadRequest)
-			return
+			return nil, nil, err
 		}
+		option.SetMountPath(mountPath)
+	}
+	return provider, option, option.Validate()
+}
+
+var mountHandler haruka.RequestHandler = func(context *haruka.Context) {
+	provider, option, err := parseMountOption(context)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.Mount(provider, option)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
 	}
-	err = service.MountCIFS(requestBody)
+	err = context.JSON(map[string]interface{}{
+		"result": "success",
+	})
+}
+
+var fstabAddProviderMountHandler haruka.RequestHandler = func(context *haruka.Context) {
+	provider, option, err := parseMountOption(context)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.DefaultFstab.AddProviderMount(provider, option)
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
 	}
+	err = saveFstabMount(option.GetMountPath())
+	if err != nil {
+		AbortErrorWithStatus(err, context, fstabErrorStatus(err))
+		return
+	}
 	err = context.JSON(map[string]interface{}{
 		"result": "success",
 	})
@@ -33,7 +75,7 @@ var mountCifsHandler haruka.RequestHandler = func(context *haruka.Context) {
 
 var umountHandler haruka.RequestHandler = func(context *haruka.Context) {
 	dirPath := context.GetQueryString("dirPath")
-	err := service.UmountFS(dirPath)
+	err := service.DefaultMountMonitor.Umount(dirPath)
 	if err != nil {
 		AbortErrorWithStatus(err, context, http.StatusBadRequest)
 		return
@@ -42,3 +84,102 @@ var umountHandler haruka.RequestHandler = func(context *haruka.Context) {
 		"result": "success",
 	})
 }
+
+var mountCredentialListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	credentials, err := service.GetMountCredentials()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewMountCredentialTemplateList(credentials),
+	})
+}
+
+// saveMountCredentialHandler create credential, or rotate it when name exists
+var saveMountCredentialHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody service.SaveMountCredentialOption
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = requestBody.Validate()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	credential, err := service.SaveMountCredential(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewMountCredentialTemplate(credential),
+	})
+}
+
+var removeMountCredentialHandler haruka.RequestHandler = func(context *haruka.Context) {
+	err := service.RemoveMountCredential(context.GetQueryString("name"))
+	if err == service.MountCredentialNotFound {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	if err == service.MountCredentialInUse {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
+
+// mountStatusHandler check managed mounts now instead of returning last result of monitor
+var mountStatusHandler haruka.RequestHandler = func(context *haruka.Context) {
+	statuses, err := service.DefaultMountMonitor.Check(service.GetManagedMounts())
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewMountStatusTemplateList(statuses),
+	})
+}
+
+func newMountMonitorNotifier() *service.MountMonitorNotifier {
+	return &service.MountMonitorNotifier{
+		OnDrop: func(status *service.MountStatus) {
+			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+				"event":  EventMountDropped,
+				"status": template.NewMountStatusTemplate(status),
+			})
+		},
+		OnRecover: func(status *service.MountStatus) {
+			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+				"event":  EventMountRecovered,
+				"status": template.NewMountStatusTemplate(status),
+			})
+		},
+		OnRemount: func(status *service.MountStatus, err error) {
+			if err != nil {
+				DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+					"event":  EventMountRemountFailed,
+					"status": template.NewMountStatusTemplate(status),
+					"error":  err.Error(),
+				})
+				return
+			}
+			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
+				"event":  EventMountRemounted,
+				"status": template.NewMountStatusTemplate(status),
+			})
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/config"
+	"youfile/service"
+	"youfile/template"
+)
+
+var quotaListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	if !config.Instance.Quota.Enable {
+		AbortErrorWithStatus(FeatureNotEnableError, context, http.StatusForbidden)
+		return
+	}
+	quotas, err := service.GetUserQuotas(context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewQuotaListTemplate(quotas),
+	})
+}
+
+type SaveQuotaRequestBody struct {
+	Username string `json:"username"`
+	Path     string `json:"path"`
+	Limit    int64  `json:"limit"`
+}
+
+var saveQuotaHandler haruka.RequestHandler = func(context *haruka.Context) {
+	if !config.Instance.Quota.Enable {
+		AbortErrorWithStatus(FeatureNotEnableError, context, http.StatusForbidden)
+		return
+	}
+	var requestBody SaveQuotaRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Path) == 0 || requestBody.Limit <= 0 {
+		AbortErrorWithStatus(errors.New("path and limit are required"), context, http.StatusBadRequest)
+		return
+	}
+	realPath, err := service.GetRealPath(requestBody.Path, context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	option := service.SaveQuotaOption{
+		Username: requestBody.Username,
+		Path:     requestBody.Path,
+		Root:     realPath,
+		Limit:    requestBody.Limit,
+	}
+	err = service.CheckSaveQuotaPermission(context.Param["username"].(string), option)
+	if err != nil {
+		if err == service.QuotaPermissionDenied {
+			AbortErrorWithStatus(err, context, http.StatusForbidden)
+			return
+		}
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	quota, err := service.SaveQuota(option)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewQuotaTemplate(quota),
+	})
+}
+
+var removeQuotaHandler haruka.RequestHandler = func(context *haruka.Context) {
+	if !config.Instance.Quota.Enable {
+		AbortErrorWithStatus(FeatureNotEnableError, context, http.StatusForbidden)
+		return
+	}
+	id, err := context.GetQueryInt("id")
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	quota, err := service.GetQuota(uint(id))
+	if err != nil {
+		if err == service.QuotaNotFound {
+			AbortErrorWithStatus(err, context, http.StatusNotFound)
+			return
+		}
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	// remove own quota would lift the limit, so only admin can remove quota
+	if !service.IsQuotaAdmin(context.Param["username"].(string)) {
+		AbortErrorWithStatus(service.QuotaPermissionDenied, context, http.StatusForbidden)
+		return
+	}
+	err = service.RemoveQuota(quota.ID)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
+
+var reconcileQuotaHandler haruka.RequestHandler = func(context *haruka.Context) {
+	if !config.Instance.Quota.Enable {
+		AbortErrorWithStatus(FeatureNotEnableError, context, http.StatusForbidden)
+		return
+	}
+	err := service.ReconcileQuota()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
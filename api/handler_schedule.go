@@ -0,0 +1,171 @@
+package api
+
+import (
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/service"
+	"youfile/template"
+)
+
+var scheduleJobListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	jobs, err := service.GetScheduleJobs(context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewScheduleJobListTemplate(jobs),
+	})
+}
+
+type SaveScheduleJobRequestBody struct {
+	Name          string   `json:"name"`
+	Cron          string   `json:"cron"`
+	TaskType      string   `json:"taskType"`
+	Enable        bool     `json:"enable"`
+	Sources       []string `json:"sources"`
+	Target        string   `json:"target"`
+	OnDuplicate   string   `json:"onDuplicate"`
+	Mode          string   `json:"mode"`
+	Compare       string   `json:"compare"`
+	Conflict      string   `json:"conflict"`
+	OlderThanDays int      `json:"olderThanDays"`
+}
+
+// saveScheduleJobHandler create job, or update job with id in query.
+// Paths are resolved to real path here, job run without user token.
+var saveScheduleJobHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody SaveScheduleJobRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	var id uint
+	if len(context.GetQueryString("id")) > 0 {
+		rawId, err := context.GetQueryInt("id")
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		id = uint(rawId)
+	}
+	token := context.Param["token"].(string)
+	option := &service.ScheduleJobOption{
+		Sources:       make([]string, 0),
+		OnDuplicate:   requestBody.OnDuplicate,
+		Mode:          requestBody.Mode,
+		Compare:       requestBody.Compare,
+		Conflict:      requestBody.Conflict,
+		OlderThanDays: requestBody.OlderThanDays,
+		DisplayPath:   map[string]string{},
+	}
+	for _, source := range requestBody.Sources {
+		realPath, err := service.GetRealPath(source, token)
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		option.Sources = append(option.Sources, realPath)
+		option.DisplayPath[realPath] = source
+	}
+	if len(requestBody.Target) > 0 {
+		option.Target, err = service.GetRealPath(requestBody.Target, token)
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		option.DisplayPath[option.Target] = requestBody.Target
+	}
+	job, err := service.SaveScheduleJob(service.SaveScheduleJobOption{
+		Id:       id,
+		Name:     requestBody.Name,
+		Username: context.Param["username"].(string),
+		Cron:     requestBody.Cron,
+		TaskType: requestBody.TaskType,
+		Enable:   requestBody.Enable,
+		Option:   option,
+	})
+	if err == service.ScheduleJobNotFound {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewScheduleJobTemplate(job),
+	})
+}
+
+var removeScheduleJobHandler haruka.RequestHandler = func(context *haruka.Context) {
+	id, err := context.GetQueryInt("id")
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.RemoveScheduleJob(uint(id), context.Param["username"].(string))
+	if err == service.ScheduleJobNotFound {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
+
+var runScheduleJobHandler haruka.RequestHandler = func(context *haruka.Context) {
+	id, err := context.GetQueryInt("id")
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	err = service.RunScheduleJob(uint(id), context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
+
+var scheduleRunListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	id, err := context.GetQueryInt("id")
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	job, err := service.GetScheduleJob(uint(id), context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	page, err := context.GetQueryInt("page")
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := context.GetQueryInt("pageSize")
+	if err != nil {
+		pageSize = 20
+	}
+	runs, count, err := service.GetScheduleRuns(job.ID, page, pageSize)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success":  true,
+		"count":    count,
+		"page":     page,
+		"pageSize": pageSize,
+		"result":   template.NewScheduleRunListTemplate(runs),
+	})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/service"
+	"youfile/template"
+)
+
+type CreateSyncTaskRequestBody struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Mode     string `json:"mode"`
+	Compare  string `json:"compare"`
+	Conflict string `json:"conflict"`
+	DryRun   bool   `json:"dryRun"`
+}
+
+var newSyncTaskHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody CreateSyncTaskRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	username := context.Param["username"].(string)
+	realSource, err := service.GetRealPath(requestBody.Source, context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	realTarget, err := service.GetRealPath(requestBody.Target, context.Param["token"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	syncOption := service.SyncOption{
+		Source:   realSource,
+		Target:   realTarget,
+		Mode:     requestBody.Mode,
+		Compare:  requestBody.Compare,
+		Conflict: requestBody.Conflict,
+	}
+	err = syncOption.Validate()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	task := service.DefaultTask.NewSyncTask(&service.NewSyncTaskOption{
+		SyncOption: syncOption,
+		DryRun:     requestBody.DryRun,
+		OnDone: func(task *service.SyncTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventSyncTaskComplete,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		OnError: func(task *service.SyncTask) {
+			DefaultNotificationManager.sendJSONToUser(haruka.JSON{
+				"event": EventSyncTaskError,
+				"id":    task.Id,
+				"task":  template.NewTaskTemplate(task),
+			}, username)
+		},
+		DisplayPath: map[string]string{
+			realSource: requestBody.Source,
+			realTarget: requestBody.Target,
+		},
+		Username: username,
+	})
+	go task.Run()
+	context.JSON(template.NewTaskTemplate(task))
+}
+
+var syncDiffHandler haruka.RequestHandler = func(context *haruka.Context) {
+	task, ok := service.DefaultTask.GetTask(context.GetQueryString("taskId")).(*service.SyncTask)
+	if !ok || task.GetUsername() != context.Param["username"].(string) {
+		AbortErrorWithStatus(errors.New("task not found"), context, http.StatusNotFound)
+		return
+	}
+	page, err := context.GetQueryInt("page")
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := context.GetQueryInt("pageSize")
+	if err != nil {
+		pageSize = 50
+	}
+	items, total, err := task.GetDiff(page, pageSize)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success":  true,
+		"count":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"result":   template.NewSyncDiffListTemplate(items),
+	})
+}
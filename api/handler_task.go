@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/allentom/haruka"
 	"net/http"
+	"time"
 	"youfile/config"
 	"youfile/service"
 	"youfile/template"
@@ -234,10 +235,30 @@ var newSearchFileTaskHandler haruka.RequestHandler = func(context *haruka.Contex
 			return
 		}
 	}
+	filter := &service.ImageMetaFilter{Camera: context.GetQueryString("camera")}
+	if captureFrom := context.GetQueryString("captureFrom"); len(captureFrom) > 0 {
+		from, err := time.ParseInLocation("2006-01-02", captureFrom, time.Local)
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		filter.CaptureFrom = &from
+	}
+	if captureTo := context.GetQueryString("captureTo"); len(captureTo) > 0 {
+		to, err := time.ParseInLocation("2006-01-02", captureTo, time.Local)
+		if err != nil {
+			AbortErrorWithStatus(err, context, http.StatusBadRequest)
+			return
+		}
+		// include the whole day
+		to = to.AddDate(0, 0, 1)
+		filter.CaptureTo = &to
+	}
 	task := service.DefaultTask.NewSearchFileTask(&service.NewSearchTaskOption{
-		Src:   realPath,
-		Key:   searchKey,
-		Limit: limit,
+		Src:    realPath,
+		Key:    searchKey,
+		Limit:  limit,
+		Filter: filter,
 		OnDone: func(id string) {
 			DefaultNotificationManager.sendJSONToAll(haruka.JSON{
 				"event": EventSearchTaskComplete,
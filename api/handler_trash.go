@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/allentom/haruka"
+	"net/http"
+	"youfile/service"
+	"youfile/template"
+)
+
+var trashItemListHandler haruka.RequestHandler = func(context *haruka.Context) {
+	items, err := service.GetTrashItems(context.Param["username"].(string))
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewTrashItemListTemplate(items),
+	})
+}
+
+type RestoreTrashItemRequestBody struct {
+	Id uint `json:"id"`
+}
+
+var restoreTrashItemHandler haruka.RequestHandler = func(context *haruka.Context) {
+	var requestBody RestoreTrashItemRequestBody
+	err := context.ParseJson(&requestBody)
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusBadRequest)
+		return
+	}
+	item, err := service.RestoreTrashItem(requestBody.Id, context.Param["username"].(string))
+	if err == service.TrashItemNotFound {
+		AbortErrorWithStatus(err, context, http.StatusNotFound)
+		return
+	}
+	if err == service.TrashRestoreConflict {
+		AbortErrorWithStatus(err, context, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewTrashItemTemplate(item),
+	})
+}
@@ -23,22 +23,64 @@ func SetRouter(e *haruka.Engine) {
 	e.Router.AddHandler("/task/copy", newCopyFileTaskHandler)
 	e.Router.AddHandler("/task/move", newMoveFileTaskHandler)
 	e.Router.AddHandler("/task/unarchive", newExtractTaskHandler)
+	e.Router.POST("/task/unarchive/password", supplyExtractPasswordHandler)
+	e.Router.GET("/archive/passwords", archivePasswordListHandler)
+	e.Router.POST("/archive/passwords", saveArchivePasswordHandler)
+	e.Router.DELETE("/archive/passwords", removeArchivePasswordHandler)
 	e.Router.AddHandler("/task/archive", newArchiveTaskHandler)
+	e.Router.POST("/archive/list", archiveListHandler)
+	e.Router.AddHandler("/task/archivetest", newArchiveTestTaskHandler)
 	e.Router.AddHandler("/task/delete", newDeleteTaskHandler)
+	e.Router.AddHandler("/task/diskusage", newDiskUsageTaskHandler)
+	e.Router.GET("/task/diskusage/node", diskUsageNodeHandler)
+	e.Router.AddHandler("/task/duplicate", newFindDuplicatesTaskHandler)
+	e.Router.GET("/duplicate/groups", duplicateGroupListHandler)
+	e.Router.POST("/duplicate/resolve", resolveDuplicateHandler)
+	e.Router.GET("/trash", trashItemListHandler)
+	e.Router.POST("/trash/restore", restoreTrashItemHandler)
+	e.Router.AddHandler("/task/sync", newSyncTaskHandler)
+	e.Router.AddHandler("/task/audiotag", newAudioTagTaskHandler)
+	e.Router.POST("/task/audiotag/undo", undoAudioTagTaskHandler)
+	e.Router.GET("/sync/diff", syncDiffHandler)
 	e.Router.AddHandler("/task/stop", stopTaskHandler)
 	e.Router.AddHandler("/task/get", getTaskHandler)
 	e.Router.AddHandler("/task/all", getTaskList)
-	e.Router.POST("/mount/cifs", mountCifsHandler)
+	e.Router.GET("/mount/providers", mountProviderListHandler)
+	e.Router.GET("/mount/status", mountStatusHandler)
+	e.Router.GET("/mount/credentials", mountCredentialListHandler)
+	e.Router.POST("/mount/credentials", saveMountCredentialHandler)
+	e.Router.DELETE("/mount/credentials", removeMountCredentialHandler)
+	e.Router.POST("/mount/{provider}", mountHandler)
+	e.Router.POST("/mount/{provider}/fstab", fstabAddProviderMountHandler)
 	e.Router.POST("/umount", umountHandler)
 	e.Router.GET("/fstab/mounts", fstabMountListHandler)
 	e.Router.POST("/fstab/mounts", fstabAddMountHandler)
 	e.Router.DELETE("/fstab/mounts", fstabRemoveMountHandler)
 	e.Router.GET("/fstab/reload", fstabReMountHandler)
+	e.Router.GET("/fstab/check", fstabCheckHandler)
+	e.Router.GET("/fstab/backups", fstabBackupListHandler)
+	e.Router.POST("/fstab/restore", fstabRestoreHandler)
 	e.Router.GET("/info", readOSInfoDirHandler)
 	e.Router.GET("/service/info", infoHandler)
 	e.Router.GET("/files", getFileHandler)
+	e.Router.GET("/preview", previewFileHandler)
+	e.Router.GET("/path/meta", imageMetaHandler)
+	e.Router.GET("/path/audiotag", audioTagHandler)
+	e.Router.GET("/path/audiotag/cover", audioCoverHandler)
 	e.Router.GET("/thumbnails", getFileThumbnailHandler)
 	e.Router.POST("/thumbnails/clear", clearThumbnailHandler)
+	e.Router.POST("/thumbnails/collect", collectThumbnailHandler)
+	e.Router.GET("/thumbnails/stats", thumbnailStatsHandler)
+	e.Router.GET("/quota", quotaListHandler)
+	e.Router.POST("/quota", saveQuotaHandler)
+	e.Router.DELETE("/quota", removeQuotaHandler)
+	e.Router.POST("/quota/reconcile", reconcileQuotaHandler)
+	e.Router.GET("/schedule", scheduleJobListHandler)
+	e.Router.POST("/schedule", saveScheduleJobHandler)
+	e.Router.PUT("/schedule", saveScheduleJobHandler)
+	e.Router.DELETE("/schedule", removeScheduleJobHandler)
+	e.Router.POST("/schedule/run", runScheduleJobHandler)
+	e.Router.GET("/schedule/runs", scheduleRunListHandler)
 	e.Router.POST("/user/auth", youPlusLoginHandler)
 	e.Router.GET("/user/auth", youPlusTokenHandler)
 	e.Router.AddHandler("/notification", notificationSocketHandler)
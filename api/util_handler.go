@@ -4,6 +4,7 @@ import (
 	"github.com/allentom/haruka"
 	"net/http"
 	"youfile/service"
+	"youfile/template"
 )
 
 var clearThumbnailHandler haruka.RequestHandler = func(context *haruka.Context) {
@@ -21,3 +22,26 @@ var clearThumbnailHandler haruka.RequestHandler = func(context *haruka.Context)
 		"result": "success",
 	})
 }
+
+var thumbnailStatsHandler haruka.RequestHandler = func(context *haruka.Context) {
+	stats, err := service.GetThumbnailStats()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"success": true,
+		"result":  template.NewThumbnailStatsTemplate(stats),
+	})
+}
+
+var collectThumbnailHandler haruka.RequestHandler = func(context *haruka.Context) {
+	err := service.CollectThumbnails()
+	if err != nil {
+		AbortErrorWithStatus(err, context, http.StatusInternalServerError)
+		return
+	}
+	context.JSON(haruka.JSON{
+		"result": "success",
+	})
+}
@@ -14,20 +14,38 @@ var DefaultNotificationManager = NotificationManager{
 	Conns: map[string]*NotificationConnection{},
 }
 var (
-	EventUnarchiveComplete     = "UnarchiveTaskComplete"
-	EventUnarchiveFileComplete = "UnarchiveFileComplete"
-	EventArchiveComplete       = "ArchiveTaskComplete"
-	EventCopyTaskComplete      = "CopyTaskComplete"
-	EventCopyTaskError         = "CopyTaskError"
-	EventCopyItemComplete      = "CopyItemComplete"
-	EventMoveTaskComplete      = "MoveTaskComplete"
-	EventMoveItemComplete      = "MoveItemComplete"
-	EventMoveTaskError         = "MoveTaskError"
-	EventSearchTaskComplete    = "SearchTaskComplete"
-	EventDeleteTaskDone        = "DeleteTaskDone"
-	EventDeleteTaskError       = "DeleteTaskError"
-	EventDeleteItemComplete    = "DeleteItemComplete"
-	GenerateThumbnailComplete  = "GenerateThumbnailComplete"
+	EventUnarchiveComplete          = "UnarchiveTaskComplete"
+	EventUnarchiveError             = "UnarchiveTaskError"
+	EventUnarchiveFileComplete      = "UnarchiveFileComplete"
+	EventUnarchiveNeedPassword      = "UnarchiveNeedPassword"
+	EventArchiveComplete            = "ArchiveTaskComplete"
+	EventArchiveError               = "ArchiveTaskError"
+	EventArchiveTestComplete        = "ArchiveTestTaskComplete"
+	EventArchiveTestError           = "ArchiveTestTaskError"
+	EventCopyTaskComplete           = "CopyTaskComplete"
+	EventCopyTaskError              = "CopyTaskError"
+	EventCopyItemComplete           = "CopyItemComplete"
+	EventMoveTaskComplete           = "MoveTaskComplete"
+	EventMoveItemComplete           = "MoveItemComplete"
+	EventMoveTaskError              = "MoveTaskError"
+	EventSearchTaskComplete         = "SearchTaskComplete"
+	EventDeleteTaskDone             = "DeleteTaskDone"
+	EventDeleteTaskError            = "DeleteTaskError"
+	EventDeleteItemComplete         = "DeleteItemComplete"
+	EventDiskUsageTaskComplete      = "DiskUsageTaskComplete"
+	EventDiskUsageTaskError         = "DiskUsageTaskError"
+	EventFindDuplicatesTaskComplete = "FindDuplicatesTaskComplete"
+	EventFindDuplicatesTaskError    = "FindDuplicatesTaskError"
+	EventSyncTaskComplete           = "SyncTaskComplete"
+	EventSyncTaskError              = "SyncTaskError"
+	EventAudioTagTaskComplete       = "AudioTagTaskComplete"
+	EventAudioTagTaskError          = "AudioTagTaskError"
+	EventMountDropped               = "MountDropped"
+	EventMountRecovered             = "MountRecovered"
+	EventMountRemounted             = "MountRemounted"
+	EventMountRemountFailed         = "MountRemountFailed"
+	EventThumbnailFileComplete      = "ThumbnailFileComplete"
+	GenerateThumbnailComplete       = "GenerateThumbnailComplete"
 )
 
 type NotificationConnection struct {
@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -12,9 +13,26 @@ var Manager = viper.New()
 var Logger = logrus.WithField("scope", "config")
 
 const (
-	ArchiveEngineDefault = "Default"
-	ArchiveEngineWinRAR  = "WinRAR"
-	ArchiveEngineUnar    = "Unar"
+	ArchiveEngineDefault  = "Default"
+	ArchiveEngineWinRAR   = "WinRAR"
+	ArchiveEngineUnar     = "Unar"
+	ArchiveEngineSevenZip = "SevenZip"
+)
+
+const (
+	QuotaEnforceRefuse = "refuse"
+	QuotaEnforceWarn   = "warn"
+)
+
+const (
+	ThumbnailFormatJpeg = "jpeg"
+	ThumbnailFormatWebp = "webp"
+)
+
+const (
+	ThumbnailSizeSmall  = "small"
+	ThumbnailSizeMedium = "medium"
+	ThumbnailSizeLarge  = "large"
 )
 
 type EntityConfig struct {
@@ -34,9 +52,55 @@ type YouLinkConfig struct {
 	Url        string
 	ServiceUrl string
 }
+type ThumbnailConfig struct {
+	Path string
+	// ThumbnailFormatJpeg or ThumbnailFormatWebp
+	Format  string
+	Quality int
+	// max width and height in pixel of each size
+	Sizes map[string]int
+	// path of heif-dec or heif-convert from libheif, found in PATH if empty
+	HeicDecoder string
+	// path of pdftoppm from poppler to render first page of pdf, found in PATH if empty
+	PdfRenderer string
+	// seconds before heic decoder or pdf renderer is killed, so broken file can not block worker
+	ConvertTimeout int
+	// count of thumbnail generate worker
+	Workers int
+	// thumbnails of images under roots are generated in background at start
+	Roots []string
+	// max disk usage of thumbnails in megabytes, least recently used thumbnails are evicted. 0 is unlimited
+	MaxSize int64
+	// days since last access before thumbnail is evicted, 0 is unlimited
+	MaxAge int
+	// minutes between garbage collect of thumbnails
+	GCInterval int
+}
+type QuotaConfig struct {
+	Enable       bool
+	Enforce      string
+	ScanInterval int
+	// users allowed to manage quotas of all users
+	Admins []string
+}
+type MountConfig struct {
+	// directory of cifs credentials files
+	CredentialPath string
+	// directory of credentials files decrypted at start, should be on tmpfs
+	RuntimeCredentialPath string
+	// seconds between health checks of mounts, 0 to disable
+	MonitorInterval int
+	// seconds to wait for probe before mount is reported as not responding
+	ProbeTimeout int
+	// remount fstab entry when it is dropped
+	AutoRemount bool
+}
 type AppConfig struct {
 	Addr            string
 	FstabPath       string
+	FstabBackupPath string
+	// count of fstab backups kept, older ones are removed
+	FstabKeepBackup int
 	MountPoints     []string
 	YouPlusPath     bool
 	YouPlusAuth     bool
@@ -46,11 +110,18 @@ type AppConfig struct {
 	ArchiveEngine   string
 	ArchiveExtract  string
 	ArchiveCompress string
+	ArchiveSevenZip string
 	Thumbnails      bool
+	Thumbnail       ThumbnailConfig
 	Entity          EntityConfig
 	YouLog          YouLogConfig
 	Remote          RemoteConfig
 	YouLink         YouLinkConfig
+	Quota           QuotaConfig
+	Mount           MountConfig
+	TrashPath       string
+	// key of secrets stored at rest, passwords of mount credentials and archives are only kept when it is set
+	MasterKey string
 }
 type RemoteServerConfig struct {
 	Enable bool
@@ -85,6 +156,8 @@ func LoadAppConfig(configPath string) error {
 	}
 	Manager.SetDefault("addr", ":8300")
 	Manager.SetDefault("fstab.path", "/etc/fstab")
+	Manager.SetDefault("fstab.backup", "./fstab_backups")
+	Manager.SetDefault("fstab.keepbackup", 20)
 	Manager.SetDefault("mountpoint", []string{})
 	Manager.SetDefault("youplus.path", false)
 	Manager.SetDefault("youplus.url", "http://localhost:8999")
@@ -92,6 +165,18 @@ func LoadAppConfig(configPath string) error {
 	Manager.SetDefault("youplus.zfs", false)
 	Manager.SetDefault("archive.engine", ArchiveEngineDefault)
 	Manager.SetDefault("thumbnails", false)
+	Manager.SetDefault("thumbnail.path", "./thumbnails")
+	Manager.SetDefault("thumbnail.format", ThumbnailFormatJpeg)
+	Manager.SetDefault("thumbnail.quality", 80)
+	Manager.SetDefault("thumbnail.size.small", 120)
+	Manager.SetDefault("thumbnail.size.medium", 240)
+	Manager.SetDefault("thumbnail.size.large", 480)
+	Manager.SetDefault("thumbnail.converttimeout", 30)
+	Manager.SetDefault("thumbnail.workers", 2)
+	Manager.SetDefault("thumbnail.roots", []string{})
+	Manager.SetDefault("thumbnail.maxsize", 0)
+	Manager.SetDefault("thumbnail.maxage", 0)
+	Manager.SetDefault("thumbnail.gcinterval", 60)
 	Manager.SetDefault("youlog.addr", "localhost:50052")
 	Manager.SetDefault("youlog.remote", false)
 	Manager.SetDefault("youlog.retry", 3000)
@@ -101,8 +186,20 @@ func LoadAppConfig(configPath string) error {
 	Manager.SetDefault("remote.server.addr", "localhost:50060")
 	Manager.SetDefault("remote.client.enable", false)
 	Manager.SetDefault("remote.client.addrs", []string{})
+	Manager.SetDefault("quota.enable", false)
+	Manager.SetDefault("quota.enforce", QuotaEnforceRefuse)
+	Manager.SetDefault("quota.interval", 60)
+	Manager.SetDefault("quota.admins", []string{})
+	Manager.SetDefault("trash.path", "./trash")
+	Manager.SetDefault("mount.credentials", "./credentials")
+	Manager.SetDefault("mount.runtimecredentials", "/run/youfile/credentials")
+	Manager.SetDefault("mount.monitorinterval", 30)
+	Manager.SetDefault("mount.probetimeout", 5)
+	Manager.SetDefault("mount.autoremount", false)
 	Instance.Addr = Manager.GetString("addr")
 	Instance.FstabPath = Manager.GetString("fstab.path")
+	Instance.FstabBackupPath = Manager.GetString("fstab.backup")
+	Instance.FstabKeepBackup = Manager.GetInt("fstab.keepbackup")
 	Instance.MountPoints = Manager.GetStringSlice("mountpoint")
 	Instance.YouPlusPath = Manager.GetBool("youplus.path")
 	Instance.YouPlusUrl = Manager.GetString("youplus.url")
@@ -112,7 +209,26 @@ func LoadAppConfig(configPath string) error {
 	Instance.ArchiveEngine = Manager.GetString("archive.engine")
 	Instance.ArchiveExtract = Manager.GetString("archive.extract")
 	Instance.ArchiveCompress = Manager.GetString("archive.compress")
+	Instance.ArchiveSevenZip = Manager.GetString("archive.sevenzip")
 	Instance.Thumbnails = Manager.GetBool("thumbnails")
+	Instance.Thumbnail = ThumbnailConfig{
+		Path:    Manager.GetString("thumbnail.path"),
+		Format:  Manager.GetString("thumbnail.format"),
+		Quality: Manager.GetInt("thumbnail.quality"),
+		Sizes: map[string]int{
+			ThumbnailSizeSmall:  Manager.GetInt("thumbnail.size.small"),
+			ThumbnailSizeMedium: Manager.GetInt("thumbnail.size.medium"),
+			ThumbnailSizeLarge:  Manager.GetInt("thumbnail.size.large"),
+		},
+		HeicDecoder:    Manager.GetString("thumbnail.heic"),
+		PdfRenderer:    Manager.GetString("thumbnail.pdftoppm"),
+		ConvertTimeout: Manager.GetInt("thumbnail.converttimeout"),
+		Workers:        Manager.GetInt("thumbnail.workers"),
+		Roots:          Manager.GetStringSlice("thumbnail.roots"),
+		MaxSize:        Manager.GetInt64("thumbnail.maxsize"),
+		MaxAge:         Manager.GetInt("thumbnail.maxage"),
+		GCInterval:     Manager.GetInt("thumbnail.gcinterval"),
+	}
 	Instance.Entity = EntityConfig{
 		Enable:  Manager.GetBool("youplus.entity.enable"),
 		Name:    Manager.GetString("youplus.entity.name"),
@@ -140,6 +256,25 @@ func LoadAppConfig(configPath string) error {
 		Url:        Manager.GetString("youlink.url"),
 		ServiceUrl: Manager.GetString("youlink.service"),
 	}
+	Instance.TrashPath = Manager.GetString("trash.path")
+	Instance.Quota = QuotaConfig{
+		Enable:       Manager.GetBool("quota.enable"),
+		Enforce:      Manager.GetString("quota.enforce"),
+		ScanInterval: Manager.GetInt("quota.interval"),
+		Admins:       Manager.GetStringSlice("quota.admins"),
+	}
+	Instance.Mount = MountConfig{
+		CredentialPath:        Manager.GetString("mount.credentials"),
+		RuntimeCredentialPath: Manager.GetString("mount.runtimecredentials"),
+		MonitorInterval:       Manager.GetInt("mount.monitorinterval"),
+		ProbeTimeout:          Manager.GetInt("mount.probetimeout"),
+		AutoRemount:           Manager.GetBool("mount.autoremount"),
+	}
+	Instance.MasterKey = Manager.GetString("masterkey")
+	// master key can be kept out of config file, it is not bound to viper so it is never saved
+	if masterKey := os.Getenv("YOUFILE_MASTER_KEY"); len(masterKey) > 0 {
+		Instance.MasterKey = masterKey
+	}
 	return nil
 }
 
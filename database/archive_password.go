@@ -0,0 +1,11 @@
+package database
+
+import "gorm.io/gorm"
+
+// ArchivePassword is password saved by user to try on encrypted archive, password is encrypted by master key
+type ArchivePassword struct {
+	gorm.Model
+	Username string `gorm:"index"`
+	Name     string
+	Password string
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type FileHash struct {
+	gorm.Model
+	Path        string `gorm:"index"`
+	Size        int64
+	ModTime     time.Time
+	PartialHash string
+	FullHash    string
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// ImageMeta is metadata read from EXIF, IPTC and XMP of image, it is stale when size, modify time or inode of file changed
+type ImageMeta struct {
+	gorm.Model
+	Path         string `gorm:"index"`
+	Size         int64
+	ModTime      time.Time
+	Inode        uint64
+	Width        int
+	Height       int
+	Orientation  int
+	CameraMake   string
+	CameraModel  string `gorm:"index"`
+	LensModel    string
+	CaptureAt    *time.Time `gorm:"index"`
+	Latitude     *float64
+	Longitude    *float64
+	ExposureTime string
+	FNumber      float64
+	ISO          int
+	FocalLength  float64
+	Title        string
+	Description  string
+	// separated by comma
+	Keywords string
+}
@@ -14,7 +14,7 @@ func ConnectToDatabase() error {
 		return err
 	}
 
-	err = Instance.AutoMigrate(&Thumbnail{})
+	err = Instance.AutoMigrate(&Thumbnail{}, &ThumbnailJob{}, &ImageMeta{}, &Quota{}, &FileHash{}, &ScheduleJob{}, &ScheduleRun{}, &ArchivePassword{}, &MountCredential{}, &SyncBaseline{}, &TrashItem{})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,18 @@
+package database
+
+import "gorm.io/gorm"
+
+// MountCredential is credentials of cifs mount written to credentials file,
+// password is kept only when it is encrypted by master key
+type MountCredential struct {
+	gorm.Model
+	Name      string `gorm:"uniqueIndex"`
+	Username  string
+	Domain    string
+	Password  string
+	Encrypted bool
+	// credentials file referenced by fstab
+	Path string
+	// mount path which credential is created for from its mount options, empty if created by user
+	MountPath string `gorm:"index"`
+}
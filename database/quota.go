@@ -0,0 +1,16 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type Quota struct {
+	gorm.Model
+	Username string
+	Path     string
+	Root     string
+	Limit    int64
+	Used     int64
+	ScanAt   *time.Time
+}
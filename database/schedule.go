@@ -0,0 +1,28 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type ScheduleJob struct {
+	gorm.Model
+	Name      string
+	Username  string
+	Cron      string
+	TaskType  string
+	Options   string
+	Enable    bool
+	LastRunAt *time.Time
+	NextRunAt *time.Time
+}
+
+type ScheduleRun struct {
+	gorm.Model
+	JobId   uint `gorm:"index"`
+	TaskId  string
+	Status  string
+	Error   string
+	StartAt time.Time
+	StopAt  *time.Time
+}
@@ -0,0 +1,12 @@
+package database
+
+import "gorm.io/gorm"
+
+// SyncBaseline is tree of last completed bidirectional sync between source and target
+type SyncBaseline struct {
+	gorm.Model
+	Source string `gorm:"index"`
+	Target string `gorm:"index"`
+	// json of entries by relative path
+	Tree string
+}
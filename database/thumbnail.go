@@ -1,9 +1,25 @@
 package database
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
+// Thumbnail is generated thumbnail of file, it is stale when size, modify time or inode of file changed.
+// Files with same checksum share thumbnails, file failed to decode is recorded with empty checksum
 type Thumbnail struct {
 	gorm.Model
-	Path     string
-	Checksum string
+	Path     string `gorm:"index"`
+	Size     int64
+	ModTime  time.Time
+	Inode    uint64
+	Checksum string    `gorm:"index"`
+	AccessAt time.Time `gorm:"index"`
+}
+
+// ThumbnailJob is image waiting for thumbnail generate, removed when generated
+type ThumbnailJob struct {
+	gorm.Model
+	Path     string `gorm:"uniqueIndex"`
+	Priority int
 }
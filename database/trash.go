@@ -0,0 +1,14 @@
+package database
+
+import "gorm.io/gorm"
+
+// TrashItem is file moved into trash, it can be moved back to original path
+type TrashItem struct {
+	gorm.Model
+	Username string `gorm:"index"`
+	// path of file in trash
+	Path         string
+	OriginalPath string
+	// original path shown to user
+	DisplayPath string
+}
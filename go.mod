@@ -4,19 +4,31 @@ go 1.15
 
 require (
 	github.com/ahmetb/go-linq/v3 v3.2.0
+	github.com/alexmullins/zip v0.0.0-20180717182244-4affb64b04d0
+	github.com/alecthomas/chroma v0.9.4
 	github.com/allentom/haruka v0.0.0-20211105095347-07d9bf2b815d
+	github.com/chai2010/webp v1.1.0
 	github.com/d-tux/go-fstab v0.0.0-20141204152952-eb4090f26517
+	github.com/dhowden/tag v0.0.0-20201120070457-d52dcb253c63
 	github.com/gorilla/websocket v1.4.2
 	github.com/kardianos/service v1.2.0
 	github.com/mattn/go-sqlite3 v1.14.7 // indirect
 	github.com/mholt/archiver/v3 v3.5.0
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/nwaples/rardecode v1.1.0
 	github.com/project-xpolaris/youplustoolkit v0.0.0-20211116034300-0bfdaefc307c
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/xid v1.3.0
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/afero v1.4.1
 	github.com/spf13/viper v1.7.1
+	github.com/ulikunitz/xz v0.5.7
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
+	golang.org/x/text v0.3.6
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.9
 )
@@ -57,6 +57,29 @@ func Program(configPath string) {
 	if err != nil {
 		Logger.Fatal(err)
 	}
+	err = service.RestoreMountCredentials()
+	if err != nil {
+		bootLogger.Error(err.Error())
+	}
+	if config.Instance.Quota.Enable {
+		bootLogger.Info("start quota scanner")
+		service.StartQuotaScanner()
+	}
+	if config.Instance.Thumbnails {
+		bootLogger.Info("start thumbnail service")
+		err = service.StartThumbnailService()
+		if err != nil {
+			bootLogger.Fatal(err.Error())
+		}
+		service.StartThumbnailCollector()
+	}
+	bootLogger.Info("start mount monitor")
+	service.StartMountMonitor()
+	bootLogger.Info("start scheduler")
+	err = service.StartScheduler()
+	if err != nil {
+		bootLogger.Fatal(err.Error())
+	}
 	if config.Instance.YouPlusPath {
 		youplusLog := bootLogger.WithFields(youlogtoolkit.Fields{
 			"scope": "YouPlus",
@@ -1,77 +1,420 @@
 package service
 
-import "youfile/config"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	aeszip "github.com/alexmullins/zip"
+	"github.com/spf13/afero"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"youfile/config"
+)
+
+const (
+	ArchiveFormatZip      = "zip"
+	ArchiveFormatTar      = "tar"
+	ArchiveFormatTarGz    = "tar.gz"
+	ArchiveFormatTarBz2   = "tar.bz2"
+	ArchiveFormatTarZstd  = "tar.zst"
+	ArchiveFormatTarXz    = "tar.xz"
+	ArchiveFormatSevenZip = "7z"
+	ArchiveFormatRar      = "rar"
+)
+
+var ArchiveFormats = []string{
+	ArchiveFormatZip,
+	ArchiveFormatTar,
+	ArchiveFormatTarGz,
+	ArchiveFormatTarBz2,
+	ArchiveFormatTarZstd,
+	ArchiveFormatTarXz,
+	ArchiveFormatSevenZip,
+	ArchiveFormatRar,
+}
+
+var (
+	ArchiveFormatNotSupported        = errors.New("archive format is not supported")
+	ArchivePasswordNotSupported      = errors.New("archive format does not support password")
+	ArchiveEncryptHeaderNotSupported = errors.New("archive format does not support header encryption")
+	ArchiveVolumeNotSupported        = errors.New("archive engine does not support this kind of volume")
+	ArchivePasswordIncorrect         = errors.New("archive password is incorrect")
+	ArchivePasswordRequired          = errors.New("archive is encrypted, password is required")
+)
 
 type ExtractOption interface {
 	GetPassword() string
+	GetSelection() *ExtractSelection
+	GetNotifier() *ArchiveNotifier
 }
 type CompressOption interface {
 	GetPassword() string
+	GetFormat() string
+	// level from 1 (fastest) to 9 (smallest), 0 for default level of format
+	GetLevel() int
+	GetExcludes() []string
+	// encrypt names of entries too, only for format has encrypted header
+	GetEncryptHeader() bool
+	// split output into volumes of size in bytes, 0 for single file
+	GetVolumeSize() int64
+	GetNotifier() *ArchiveNotifier
 }
 type ArchiveEngine interface {
 	Compress(target []string, output string, option CompressOption) error
 	Extract(target string, output string, option ExtractOption) error
+	List(target string, option ExtractOption) ([]*ArchiveEntry, error)
+	// Test verify checksum of entries without extract them, error is returned if archive can not be read at all
+	Test(target string, option ExtractOption) (*ArchiveTestResult, error)
 	CanCompress() bool
 	CanExtract() bool
+	SupportCompressFormat(format string) bool
+}
+
+type ArchiveEntry struct {
+	Path           string    `json:"path"`
+	IsDir          bool      `json:"is_dir"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size"`
+	ModTime        time.Time `json:"mod_time"`
+	Encrypted      bool      `json:"encrypted"`
+}
+
+// rardecode does not export its password error, archiver wrap it by message
+const rarDecodeBadPasswordMessage = "rardecode: incorrect password"
+
+// isArchivePasswordError return true if err is caused by missing or wrong password,
+// engines running command turn password failure they printed into ArchivePasswordIncorrect
+func isArchivePasswordError(err error) bool {
+	if errors.Is(err, ArchivePasswordIncorrect) || errors.Is(err, ArchivePasswordRequired) || errors.Is(err, aeszip.ErrPassword) {
+		return true
+	}
+	return strings.HasSuffix(err.Error(), rarDecodeBadPasswordMessage)
+}
+
+type ArchiveTestFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ArchiveTestResult is result of testing archive, archive is intact if there is no failure
+type ArchiveTestResult struct {
+	Failures []*ArchiveTestFailure `json:"failures"`
+	// password is incorrect, or archive is encrypted but no password given
+	WrongPassword bool `json:"wrong_password"`
+}
+
+func (r *ArchiveTestResult) AddFailure(path string, err string) {
+	r.Failures = append(r.Failures, &ArchiveTestFailure{Path: path, Error: err})
 }
 
 type BaseExtractOption struct {
-	Password string
+	Password  string
+	Selection *ExtractSelection
+	Notifier  *ArchiveNotifier
 }
 
 func (p *BaseExtractOption) GetPassword() string {
 	return p.Password
 }
 
+func (p *BaseExtractOption) GetSelection() *ExtractSelection {
+	return p.Selection
+}
+
+func (p *BaseExtractOption) GetNotifier() *ArchiveNotifier {
+	return p.Notifier
+}
+
 type BaseCompressOption struct {
-	Password string
+	Password      string
+	Format        string
+	Level         int
+	Excludes      []string
+	EncryptHeader bool
+	VolumeSize    int64
+	Notifier      *ArchiveNotifier
 }
 
 func (o *BaseCompressOption) GetPassword() string {
 	return o.Password
 }
 
+func (o *BaseCompressOption) GetFormat() string {
+	return o.Format
+}
+
+func (o *BaseCompressOption) GetLevel() int {
+	return o.Level
+}
+
+func (o *BaseCompressOption) GetExcludes() []string {
+	return o.Excludes
+}
+
+func (o *BaseCompressOption) GetEncryptHeader() bool {
+	return o.EncryptHeader
+}
+
+func (o *BaseCompressOption) GetVolumeSize() int64 {
+	return o.VolumeSize
+}
+
+func (o *BaseCompressOption) GetNotifier() *ArchiveNotifier {
+	return o.Notifier
+}
+
 type ExtractFileOption struct {
-	Input    string
-	Output   string
-	Password string
+	Input     string
+	Output    string
+	Password  string
+	Selection *ExtractSelection
+	Notifier  *ArchiveNotifier
 }
 
-func ExtractArchive(option ExtractFileOption) error {
-	var engine ArchiveEngine
-	var extractOption ExtractOption
-	if config.Instance.ArchiveEngine == config.ArchiveEngineWinRAR {
-		engine = NewWinRAREngine(config.Instance.ArchiveCompress, config.Instance.ArchiveExtract)
-		if !engine.CanExtract() {
-			engine = nil
-		} else {
-			rarExtractOption := &WinRARExtractOption{}
-			if len(option.Password) > 0 {
-				rarExtractOption.Password = option.Password
+type CompressFileOption struct {
+	Sources []string
+	Output  string
+	// format of output, inferred from name of output if empty
+	Format        string
+	Level         int
+	Password      string
+	Excludes      []string
+	EncryptHeader bool
+	VolumeSize    int64
+	Notifier      *ArchiveNotifier
+}
+
+// ArchiveFormatOf return format by extension of name, empty if it is not an archive can be created
+func ArchiveFormatOf(name string) string {
+	name = strings.ToLower(name)
+	for _, format := range ArchiveFormats {
+		if strings.HasSuffix(name, "."+format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// WithArchiveExtension append extension of format to name if name not end with it
+func WithArchiveExtension(name string, format string) string {
+	if len(format) == 0 || ArchiveFormatOf(name) == format {
+		return name
+	}
+	return name + "." + format
+}
+
+// matchArchiveExclude return true if path in archive or its base name match one of exclude glob
+func matchArchiveExclude(name string, excludes []string) bool {
+	name = cleanEntryPath(name)
+	for _, pattern := range excludes {
+		pattern = cleanEntryPath(pattern)
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// walkCompressSource walk source with name in archive, excluded files and directories are skipped
+func walkCompressSource(source string, excludes []string, walkFn func(itemPath string, name string, info os.FileInfo) error) error {
+	baseDir := filepath.Dir(source)
+	return afero.Walk(AppFs, source, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(baseDir, itemPath)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if matchArchiveExclude(name, excludes) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return walkFn(itemPath, name, info)
+	})
+}
+
+// analyzeCompressSource return total size and count of files going to be compressed
+func analyzeCompressSource(sources []string, excludes []string) (int64, int64, error) {
+	var size, count int64
+	for _, source := range sources {
+		err := walkCompressSource(source, excludes, func(itemPath string, name string, info os.FileInfo) error {
+			if info.Mode().IsRegular() {
+				size += info.Size()
+				count += 1
 			}
-			extractOption = rarExtractOption
+			return nil
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return size, count, nil
+}
+
+// getExtractEngine return configured engine for extract, fallback to default engine if not available
+func getExtractEngine(base BaseExtractOption) (ArchiveEngine, ExtractOption) {
+	if config.Instance.ArchiveEngine == config.ArchiveEngineWinRAR {
+		engine := NewWinRAREngine(config.Instance.ArchiveCompress, config.Instance.ArchiveExtract)
+		if engine.CanExtract() {
+			return engine, &WinRARExtractOption{base}
 		}
 	}
 
 	if config.Instance.ArchiveEngine == config.ArchiveEngineUnar {
-		engine = NewUnarArchiveEngine()
-		if !engine.CanExtract() {
-			engine = nil
-		} else {
-			unarExtractOption := &UnarArchiveExtractOption{}
-			if len(option.Password) > 0 {
-				unarExtractOption.Password = option.Password
-			}
-			extractOption = unarExtractOption
+		engine := NewUnarArchiveEngine()
+		if engine.CanExtract() {
+			return engine, &UnarArchiveExtractOption{base}
 		}
 	}
 
-	if engine == nil {
-		engine = &DefaultArchiveEngine{}
-		extractOption = &DefaultArchiveExtractOption{
-			BaseExtractOption{},
+	if config.Instance.ArchiveEngine == config.ArchiveEngineSevenZip {
+		engine := NewSevenZipEngine(config.Instance.ArchiveSevenZip)
+		if engine.CanExtract() {
+			return engine, &SevenZipExtractOption{base}
 		}
 	}
-	err := engine.Extract(option.Input, option.Output, extractOption)
+	return &DefaultArchiveEngine{}, &DefaultArchiveExtractOption{base}
+}
+
+func ExtractArchive(option ExtractFileOption) error {
+	engine, extractOption := getExtractEngine(BaseExtractOption{
+		Password:  option.Password,
+		Selection: option.Selection,
+		Notifier:  option.Notifier,
+	})
+	// engines open volume set by its first volume
+	volumes, err := ResolveArchiveVolumes(option.Input)
+	if err != nil {
+		return err
+	}
+	err = engine.Extract(volumes.First, option.Output, extractOption)
+	if err != nil && err != ArchiveInterrupt && isArchivePasswordError(err) {
+		if len(option.Password) == 0 {
+			return ArchivePasswordRequired
+		}
+		return ArchivePasswordIncorrect
+	}
 	return err
 }
+
+// TestArchive verify archive by configured engine, target can be any volume of archive
+func TestArchive(target string, password string, notifier *ArchiveNotifier) (*ArchiveTestResult, error) {
+	engine, extractOption := getExtractEngine(BaseExtractOption{
+		Password: password,
+		Notifier: notifier,
+	})
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Test(volumes.First, extractOption)
+}
+
+// getCompressEngine return configured engine if it can create format, fallback to default engine
+func getCompressEngine(base BaseCompressOption) (ArchiveEngine, CompressOption, error) {
+	if config.Instance.ArchiveEngine == config.ArchiveEngineWinRAR {
+		engine := NewWinRAREngine(config.Instance.ArchiveCompress, config.Instance.ArchiveExtract)
+		if engine.CanCompress() && engine.SupportCompressFormat(base.Format) {
+			return engine, &WinRARCompressOption{base}, nil
+		}
+	}
+	if config.Instance.ArchiveEngine == config.ArchiveEngineSevenZip {
+		engine := NewSevenZipEngine(config.Instance.ArchiveSevenZip)
+		if engine.CanCompress() && engine.SupportCompressFormat(base.Format) {
+			return engine, &SevenZipCompressOption{base}, nil
+		}
+	}
+	engine := &DefaultArchiveEngine{}
+	if engine.SupportCompressFormat(base.Format) {
+		return engine, &DefaultArchiveCompressOption{base}, nil
+	}
+	return nil, nil, ArchiveFormatNotSupported
+}
+
+func CompressArchive(option CompressFileOption) error {
+	format := option.Format
+	if len(format) == 0 {
+		format = ArchiveFormatOf(option.Output)
+	}
+	engine, compressOption, err := getCompressEngine(BaseCompressOption{
+		Password:      option.Password,
+		Format:        format,
+		Level:         option.Level,
+		Excludes:      option.Excludes,
+		EncryptHeader: option.EncryptHeader,
+		VolumeSize:    option.VolumeSize,
+		Notifier:      option.Notifier,
+	})
+	if err != nil {
+		return err
+	}
+	if option.VolumeSize > 0 && option.VolumeSize < MinArchiveVolumeSize {
+		return ArchiveVolumeTooSmall
+	}
+	return engine.Compress(option.Sources, option.Output, compressOption)
+}
+
+type archiveListCacheItem struct {
+	size    int64
+	modTime time.Time
+	entries []*ArchiveEntry
+}
+
+const archiveListCacheSize = 16
+
+var archiveListCache = map[string]*archiveListCacheItem{}
+var archiveListCacheLock sync.Mutex
+
+// ListArchive read entries of archive without extract it.
+// Result is cached until archive changed, so page through large archive not list it again.
+func ListArchive(target string, password string) ([]*ArchiveEntry, error) {
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return nil, err
+	}
+	target = volumes.First
+	stat, err := AppFs.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	// names of header encrypted archive are only listed with password, so listing is cached by password
+	passwordHash := sha256.Sum256([]byte(password))
+	cacheKey := target + "\x00" + hex.EncodeToString(passwordHash[:])
+	archiveListCacheLock.Lock()
+	cache, exist := archiveListCache[cacheKey]
+	archiveListCacheLock.Unlock()
+	// any volume changed change size of whole set in most case
+	if exist && cache.size == volumes.Size && cache.modTime.Equal(stat.ModTime()) {
+		return cache.entries, nil
+	}
+	engine, extractOption := getExtractEngine(BaseExtractOption{Password: password})
+	entries, err := engine.List(target, extractOption)
+	if err != nil {
+		return nil, err
+	}
+	archiveListCacheLock.Lock()
+	if len(archiveListCache) >= archiveListCacheSize {
+		for key := range archiveListCache {
+			delete(archiveListCache, key)
+			break
+		}
+	}
+	archiveListCache[cacheKey] = &archiveListCacheItem{
+		size:    volumes.Size,
+		modTime: stat.ModTime(),
+		entries: entries,
+	}
+	archiveListCacheLock.Unlock()
+	return entries, nil
+}
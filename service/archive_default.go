@@ -1,6 +1,16 @@
 package service
 
-import "github.com/mholt/archiver/v3"
+import (
+	"archive/tar"
+	"archive/zip"
+	aeszip "github.com/alexmullins/zip"
+	"github.com/mholt/archiver/v3"
+	"github.com/nwaples/rardecode"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
 
 type DefaultArchiveEngine struct {
 }
@@ -21,15 +31,622 @@ type DefaultArchiveCompressOption struct {
 	BaseCompressOption
 }
 
+func (e *DefaultArchiveEngine) SupportCompressFormat(format string) bool {
+	switch format {
+	case ArchiveFormatZip, ArchiveFormatTar, ArchiveFormatTarGz, ArchiveFormatTarBz2, ArchiveFormatTarZstd, ArchiveFormatTarXz:
+		return true
+	}
+	return false
+}
+
+// newArchiveWriter create writer of format, level is not supported by zst and xz
+func (e *DefaultArchiveEngine) newArchiveWriter(option CompressOption) (archiver.Writer, error) {
+	format := option.GetFormat()
+	level := option.GetLevel()
+	if option.GetEncryptHeader() {
+		return nil, ArchiveEncryptHeaderNotSupported
+	}
+	if len(option.GetPassword()) > 0 {
+		if format != ArchiveFormatZip {
+			return nil, ArchivePasswordNotSupported
+		}
+		return &encryptedZipWriter{password: option.GetPassword()}, nil
+	}
+	switch format {
+	case ArchiveFormatZip:
+		writer := archiver.NewZip()
+		if level > 0 {
+			writer.CompressionLevel = level
+		}
+		return writer, nil
+	case ArchiveFormatTar:
+		return archiver.NewTar(), nil
+	case ArchiveFormatTarGz:
+		writer := archiver.NewTarGz()
+		if level > 0 {
+			writer.CompressionLevel = level
+		}
+		return writer, nil
+	case ArchiveFormatTarBz2:
+		writer := archiver.NewTarBz2()
+		if level > 0 {
+			writer.CompressionLevel = level
+		}
+		return writer, nil
+	case ArchiveFormatTarZstd:
+		return archiver.NewTarZstd(), nil
+	case ArchiveFormatTarXz:
+		return archiver.NewTarXz(), nil
+	}
+	return nil, ArchiveFormatNotSupported
+}
+
 func (e *DefaultArchiveEngine) Compress(target []string, output string, option CompressOption) error {
-	err := archiver.Archive(target, output)
+	writer, err := e.newArchiveWriter(option)
 	if err != nil {
 		return err
 	}
+	notifier := option.GetNotifier()
+	var out io.WriteCloser
+	removeOutput := func() {
+		AppFs.Remove(output)
+	}
+	if option.GetVolumeSize() > 0 {
+		volumeWriter := newArchiveVolumeWriter(output, option.GetVolumeSize())
+		out = volumeWriter
+		removeOutput = volumeWriter.Remove
+	} else {
+		out, err = AppFs.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Create(out)
+	if err == nil {
+		for _, source := range target {
+			err = e.compressSource(writer, source, output, option.GetExcludes(), notifier)
+			if err != nil {
+				break
+			}
+		}
+		closeErr := writer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeOutput()
+		if notifier.IsStop() {
+			return ArchiveInterrupt
+		}
+		return err
+	}
+	return nil
+}
+
+// compressSource write source into archive, name in archive start with base name of source.
+// Links and other special files are not supported and skipped.
+func (e *DefaultArchiveEngine) compressSource(writer archiver.Writer, source string, output string, excludes []string, notifier *ArchiveNotifier) error {
+	return walkCompressSource(source, excludes, func(itemPath string, name string, info os.FileInfo) error {
+		if notifier.IsStop() {
+			return ArchiveInterrupt
+		}
+		if itemPath == output || !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+		notifier.EntryStart(name)
+		archiveFile := archiver.File{
+			FileInfo: archiver.FileInfo{FileInfo: info, CustomName: name},
+		}
+		if info.IsDir() {
+			return writer.Write(archiveFile)
+		}
+		file, err := AppFs.Open(itemPath)
+		if err != nil {
+			return err
+		}
+		archiveFile.ReadCloser = struct {
+			io.Reader
+			io.Closer
+		}{newArchiveProgressReader(file, notifier), file}
+		err = writer.Write(archiveFile)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		notifier.EntryDone()
+		return nil
+	})
+}
+
+// encryptedZipWriter write zip with entries encrypted by WinZip AES-256, which is not supported by archiver.
+// Entries are always deflated with default level.
+type encryptedZipWriter struct {
+	password string
+	zw       *aeszip.Writer
+}
+
+func (w *encryptedZipWriter) Create(out io.Writer) error {
+	w.zw = aeszip.NewWriter(out)
 	return nil
 }
 
+func (w *encryptedZipWriter) Write(f archiver.File) error {
+	header, err := aeszip.FileInfoHeader(f)
+	if err != nil {
+		return err
+	}
+	if f.IsDir() {
+		header.Name += "/"
+		header.Method = aeszip.Store
+		_, err = w.zw.CreateHeader(header)
+		return err
+	}
+	header.Method = aeszip.Deflate
+	header.SetPassword(w.password)
+	writer, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, f)
+	return err
+}
+
+func (w *encryptedZipWriter) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	return w.zw.Close()
+}
+
+// openArchiveReader open volumes for reading entries in sequence, reader is nil if format can not be read like this
+func openArchiveReader(volumes *ArchiveVolumeSet, password string, notifier *ArchiveNotifier) (archiver.Reader, func(), error) {
+	format, err := archiver.ByExtension(volumes.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, ok := format.(archiver.Reader)
+	if !ok {
+		return nil, nil, nil
+	}
+	if rar, isRar := reader.(*archiver.Rar); isRar {
+		rar.Password = password
+	}
+	if len(volumes.Volumes) > 1 && !volumes.Split {
+		rar, isRar := reader.(*archiver.Rar)
+		if !isRar {
+			return nil, nil, ArchiveVolumeNotSupported
+		}
+		// rardecode open following volumes by itself
+		err = rar.OpenFile(volumes.First)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, func() {
+			reader.Close()
+		}, nil
+	}
+	file, err := volumes.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = reader.Open(newArchiveProgressReader(file, notifier), volumes.Size)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, func() {
+		reader.Close()
+		file.Close()
+	}, nil
+}
+
 func (e *DefaultArchiveEngine) Extract(target string, output string, option ExtractOption) error {
-	err := archiver.Unarchive(target, output)
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return err
+	}
+	notifier := option.GetNotifier()
+	// progress of default engine is counted by bytes of archive read
+	notifier.SetTotal(volumes.Size, 0)
+	if volumes.isRandomAccessZip() {
+		return e.extractZip(volumes, output, option)
+	}
+	reader, closeReader, err := openArchiveReader(volumes, option.GetPassword(), notifier)
+	if err != nil {
+		return err
+	}
+	if reader == nil {
+		return archiver.Unarchive(target, output)
+	}
+	defer closeReader()
+	// rar volumes are read by rardecode, progress is counted by packed size of entries instead
+	_, countPacked := reader.(*archiver.Rar)
+	countPacked = countPacked && len(volumes.Volumes) > 1
+	selection := option.GetSelection()
+	written := map[string]bool{}
+	for {
+		if notifier.IsStop() {
+			return ArchiveInterrupt
+		}
+		f, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if notifier.IsStop() {
+				return ArchiveInterrupt
+			}
+			return err
+		}
+		err = e.extractFile(f, output, selection, written, notifier)
+		f.Close()
+		if err != nil {
+			if notifier.IsStop() {
+				return ArchiveInterrupt
+			}
+			return err
+		}
+		if header, ok := f.Header.(*rardecode.FileHeader); ok && countPacked {
+			notifier.AddSize(header.PackedSize)
+		}
+	}
+}
+
+// extractZip extract zip by aeszip, which can decrypt entries encrypted by AES
+func (e *DefaultArchiveEngine) extractZip(volumes *ArchiveVolumeSet, output string, option ExtractOption) error {
+	notifier := option.GetNotifier()
+	file, err := volumes.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := aeszip.NewReader(newArchiveProgressReader(file, notifier).(io.ReaderAt), volumes.Size)
+	if err != nil {
+		return err
+	}
+	selection := option.GetSelection()
+	written := map[string]bool{}
+	for _, f := range reader.File {
+		if notifier.IsStop() {
+			return ArchiveInterrupt
+		}
+		entryReader := &zipEntryReader{file: f, password: option.GetPassword()}
+		err = e.extractFile(archiver.File{
+			FileInfo:   f.FileInfo(),
+			Header:     f.FileHeader,
+			ReadCloser: entryReader,
+		}, output, selection, written, notifier)
+		entryReader.Close()
+		if err != nil {
+			if notifier.IsStop() {
+				return ArchiveInterrupt
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// zipEntryReader open entry at first read, so entries not selected are not decrypted
+type zipEntryReader struct {
+	file     *aeszip.File
+	password string
+	reader   io.ReadCloser
+}
+
+func (r *zipEntryReader) Read(p []byte) (int, error) {
+	if r.reader == nil {
+		if r.file.IsEncrypted() {
+			if len(r.password) == 0 {
+				return 0, ArchivePasswordRequired
+			}
+			r.file.SetPassword(r.password)
+		}
+		reader, err := r.file.Open()
+		if err == aeszip.ErrPassword {
+			return 0, ArchivePasswordIncorrect
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+	return r.reader.Read(p)
+}
+
+func (r *zipEntryReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
+
+// extractFile write entry read from archive to output
+func (e *DefaultArchiveEngine) extractFile(f archiver.File, output string, selection *ExtractSelection, written map[string]bool, notifier *ArchiveNotifier) error {
+	name := archiveFileName(f)
+	if !selection.Match(name) {
+		return nil
+	}
+	outputPath, ok := selection.OutputPath(name, f.IsDir())
+	if !ok {
+		return nil
+	}
+	destination, err := extractDestination(output, outputPath)
+	if err != nil {
+		return err
+	}
+	notifier.EntryStart(name)
+	err = checkExtractParents(output, destination)
+	if err != nil {
+		return err
+	}
+	if f.IsDir() {
+		return AppFs.MkdirAll(destination, os.ModePerm)
+	}
+	switch {
+	case f.Mode().IsRegular():
+		if selection.NeedRelocate() {
+			destination = uniqueExtractDestination(destination, written)
+		}
+		err = removeExtractLink(destination)
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(destination, f, f.Mode(), f.ModTime())
+	case selection.NeedRelocate():
+		// links are skipped, they may point to anywhere after relocate
+		return nil
+	default:
+		err = e.extractLink(f, output, destination)
+	}
+	if err != nil {
+		return err
+	}
+	notifier.EntryDone()
+	return nil
+}
+
+// extractLink create symlink or hard link of entry, other special files are skipped
+func (e *DefaultArchiveEngine) extractLink(f archiver.File, output string, destination string) error {
+	err := AppFs.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if header, ok := f.Header.(*tar.Header); ok {
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			_, err = resolveExtractLink(output, filepath.Dir(destination), header.Linkname, 0)
+			if err != nil {
+				return err
+			}
+			AppFs.Remove(destination)
+			return os.Symlink(header.Linkname, destination)
+		case tar.TypeLink:
+			source, err := extractDestination(output, cleanEntryPath(header.Linkname))
+			if err != nil {
+				return err
+			}
+			err = checkExtractParents(output, source)
+			if err != nil {
+				return err
+			}
+			AppFs.Remove(destination)
+			return os.Link(source, destination)
+		}
+		return nil
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		// target of link is content of entry in zip
+		linkTarget, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		_, err = resolveExtractLink(output, filepath.Dir(destination), string(linkTarget), 0)
+		if err != nil {
+			return err
+		}
+		AppFs.Remove(destination)
+		return os.Symlink(string(linkTarget), destination)
+	}
+	return nil
+}
+
+// archiveFileName return full path of entry, name of FileInfo is base name for some format
+func archiveFileName(f archiver.File) string {
+	switch header := f.Header.(type) {
+	case zip.FileHeader:
+		return header.Name
+	case aeszip.FileHeader:
+		return header.Name
+	case *tar.Header:
+		return header.Name
+	case *rardecode.FileHeader:
+		return header.Name
+	}
+	return f.Name()
+}
+
+func (e *DefaultArchiveEngine) List(target string, option ExtractOption) ([]*ArchiveEntry, error) {
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ArchiveEntry, 0)
+	if volumes.isRandomAccessZip() {
+		// read central directory only, reading in sequence open every file of archive
+		file, err := volumes.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader, err := zip.NewReader(file, volumes.Size)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			entries = append(entries, &ArchiveEntry{
+				Path:           file.Name,
+				IsDir:          file.FileInfo().IsDir(),
+				Size:           int64(file.UncompressedSize64),
+				CompressedSize: int64(file.CompressedSize64),
+				ModTime:        file.Modified,
+				Encrypted:      file.Flags&0x1 != 0,
+			})
+		}
+		return entries, nil
+	}
+	reader, closeReader, err := openArchiveReader(volumes, option.GetPassword(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, ArchiveFormatNotSupported
+	}
+	defer closeReader()
+	for {
+		f, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := &ArchiveEntry{
+			Path:    archiveFileName(f),
+			IsDir:   f.IsDir(),
+			Size:    f.Size(),
+			ModTime: f.ModTime(),
+		}
+		if header, ok := f.Header.(*rardecode.FileHeader); ok {
+			entry.CompressedSize = header.PackedSize
+		}
+		f.Close()
+		entries = append(entries, entry)
+	}
+}
+
+// Test read content of every entry, checksum is verified by reader of format at end of entry
+func (e *DefaultArchiveEngine) Test(target string, option ExtractOption) (*ArchiveTestResult, error) {
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return nil, err
+	}
+	notifier := option.GetNotifier()
+	result := &ArchiveTestResult{Failures: []*ArchiveTestFailure{}}
+	if volumes.isRandomAccessZip() {
+		return result, e.testZip(volumes, option.GetPassword(), notifier, result)
+	}
+	notifier.SetTotal(volumes.Size, 0)
+	reader, closeReader, err := openArchiveReader(volumes, option.GetPassword(), notifier)
+	if err != nil {
+		if isArchivePasswordError(err) {
+			// header of archive is encrypted
+			result.WrongPassword = true
+			return result, nil
+		}
+		return nil, err
+	}
+	if reader == nil {
+		return nil, ArchiveFormatNotSupported
+	}
+	defer closeReader()
+	for {
+		if notifier.IsStop() {
+			return result, ArchiveInterrupt
+		}
+		f, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			if notifier.IsStop() {
+				return result, ArchiveInterrupt
+			}
+			if isArchivePasswordError(err) {
+				result.WrongPassword = true
+				return result, nil
+			}
+			// entries after broken header can not be reached
+			return result, err
+		}
+		name := archiveFileName(f)
+		notifier.EntryStart(name)
+		if !f.IsDir() {
+			_, err = io.Copy(ioutil.Discard, f)
+		}
+		f.Close()
+		if err != nil {
+			if notifier.IsStop() {
+				return result, ArchiveInterrupt
+			}
+			if isArchivePasswordError(err) {
+				result.WrongPassword = true
+			}
+			result.AddFailure(name, err.Error())
+		}
+		notifier.EntryDone()
+	}
+}
+
+// testZip verify zip by aeszip, which can check entries encrypted by AES
+func (e *DefaultArchiveEngine) testZip(volumes *ArchiveVolumeSet, password string, notifier *ArchiveNotifier, result *ArchiveTestResult) error {
+	file, err := volumes.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := aeszip.NewReader(file, volumes.Size)
+	if err != nil {
+		return err
+	}
+	var totalSize, totalEntry int64
+	for _, f := range reader.File {
+		if !f.FileInfo().IsDir() {
+			totalSize += int64(f.CompressedSize64)
+			totalEntry += 1
+		}
+	}
+	notifier.SetTotal(totalSize, totalEntry)
+	for _, f := range reader.File {
+		if notifier.IsStop() {
+			return ArchiveInterrupt
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		notifier.EntryStart(f.Name)
+		if f.IsEncrypted() {
+			if len(password) == 0 {
+				result.WrongPassword = true
+				result.AddFailure(f.Name, ArchivePasswordRequired.Error())
+				continue
+			}
+			f.SetPassword(password)
+		}
+		err = testZipFile(f)
+		if err != nil {
+			if isArchivePasswordError(err) {
+				result.WrongPassword = true
+			}
+			result.AddFailure(f.Name, err.Error())
+		}
+		notifier.AddSize(int64(f.CompressedSize64))
+		notifier.EntryDone()
+	}
+	return nil
+}
+
+func testZipFile(f *aeszip.File) error {
+	entryReader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer entryReader.Close()
+	_, err = io.Copy(ioutil.Discard, entryReader)
 	return err
 }
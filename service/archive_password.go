@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+var ArchivePasswordNotFound = errors.New("archive password not found")
+
+var archivePasswordLogger = logrus.WithField("scope", "archive_password")
+
+// SaveArchivePassword add password to saved list of user, password already in list is not added again.
+// Password is encrypted by master key, it is not saved if master key is not set
+func SaveArchivePassword(username string, name string, password string) (*database.ArchivePassword, error) {
+	if len(config.Instance.MasterKey) == 0 {
+		return nil, MasterKeyNotSet
+	}
+	var saved []database.ArchivePassword
+	err := database.Instance.Where("username = ?", username).Find(&saved).Error
+	if err != nil {
+		return nil, err
+	}
+	for idx := range saved {
+		savedPassword, err := util.DecryptText(config.Instance.MasterKey, saved[idx].Password)
+		if err == nil && savedPassword == password {
+			return &saved[idx], nil
+		}
+	}
+	encrypted, err := util.EncryptText(config.Instance.MasterKey, password)
+	if err != nil {
+		return nil, err
+	}
+	record := &database.ArchivePassword{
+		Username: username,
+		Name:     name,
+		Password: encrypted,
+	}
+	err = database.Instance.Create(record).Error
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func GetArchivePasswords(username string) ([]database.ArchivePassword, error) {
+	var saved []database.ArchivePassword
+	err := database.Instance.Where("username = ?", username).Find(&saved).Error
+	return saved, err
+}
+
+func RemoveArchivePassword(id uint, username string) error {
+	result := database.Instance.Unscoped().Where("id = ? AND username = ?", id, username).Delete(&database.ArchivePassword{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ArchivePasswordNotFound
+	}
+	return nil
+}
+
+// getSavedArchivePasswords return decrypted passwords of user, password can not be decrypted is skipped
+func getSavedArchivePasswords(username string) []string {
+	if len(config.Instance.MasterKey) == 0 {
+		return []string{}
+	}
+	saved, err := GetArchivePasswords(username)
+	if err != nil {
+		archivePasswordLogger.Error(err)
+		return []string{}
+	}
+	passwords := make([]string, 0, len(saved))
+	for _, record := range saved {
+		password, err := util.DecryptText(config.Instance.MasterKey, record.Password)
+		if err != nil {
+			archivePasswordLogger.WithField("id", record.ID).Error(err)
+			continue
+		}
+		passwords = append(passwords, password)
+	}
+	return passwords
+}
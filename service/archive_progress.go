@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ArchiveInterrupt = errors.New("archive interrupt")
+
+// ArchiveNotifier collect progress of compress or extract, it is updated by engine and read by task.
+// All method can be called on nil notifier.
+type ArchiveNotifier struct {
+	TotalSize     int64
+	CompleteSize  int64
+	TotalEntry    int64
+	CompleteEntry int64
+	currentEntry  atomic.Value
+	stopFlag      int32
+}
+
+func (n *ArchiveNotifier) SetTotal(size int64, entry int64) {
+	if n == nil {
+		return
+	}
+	atomic.StoreInt64(&n.TotalSize, size)
+	atomic.StoreInt64(&n.TotalEntry, entry)
+}
+
+func (n *ArchiveNotifier) GetTotalSize() int64 {
+	if n == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&n.TotalSize)
+}
+
+func (n *ArchiveNotifier) AddSize(delta int64) {
+	if n == nil {
+		return
+	}
+	atomic.AddInt64(&n.CompleteSize, delta)
+}
+
+func (n *ArchiveNotifier) EntryStart(name string) {
+	if n == nil {
+		return
+	}
+	n.currentEntry.Store(name)
+}
+
+func (n *ArchiveNotifier) EntryDone() {
+	if n == nil {
+		return
+	}
+	atomic.AddInt64(&n.CompleteEntry, 1)
+}
+
+func (n *ArchiveNotifier) CurrentEntry() string {
+	if n == nil {
+		return ""
+	}
+	current, _ := n.currentEntry.Load().(string)
+	return current
+}
+
+func (n *ArchiveNotifier) Stop() {
+	if n == nil {
+		return
+	}
+	atomic.StoreInt32(&n.stopFlag, 1)
+}
+
+func (n *ArchiveNotifier) IsStop() bool {
+	return n != nil && atomic.LoadInt32(&n.stopFlag) == 1
+}
+
+// archiveProgressReader count bytes read into notifier, read is interrupted once notifier stopped
+type archiveProgressReader struct {
+	reader   io.Reader
+	notifier *ArchiveNotifier
+}
+
+func (r *archiveProgressReader) Read(p []byte) (int, error) {
+	if r.notifier.IsStop() {
+		return 0, ArchiveInterrupt
+	}
+	n, err := r.reader.Read(p)
+	r.notifier.AddSize(int64(n))
+	return n, err
+}
+
+// archiveProgressReaderAt is archiveProgressReader for format need random access, e.g. zip
+type archiveProgressReaderAt struct {
+	archiveProgressReader
+	readerAt io.ReaderAt
+}
+
+func (r *archiveProgressReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.notifier.IsStop() {
+		return 0, ArchiveInterrupt
+	}
+	n, err := r.readerAt.ReadAt(p, off)
+	r.notifier.AddSize(int64(n))
+	return n, err
+}
+
+func newArchiveProgressReader(reader io.Reader, notifier *ArchiveNotifier) io.Reader {
+	progressReader := archiveProgressReader{reader: reader, notifier: notifier}
+	if readerAt, ok := reader.(io.ReaderAt); ok {
+		return &archiveProgressReaderAt{archiveProgressReader: progressReader, readerAt: readerAt}
+	}
+	return &progressReader
+}
+
+// scanArchiveOutputLines split output of archive command by \n or \r,
+// backspace used to redraw percentage is removed
+func scanArchiveOutputLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if idx := bytes.IndexAny(data, "\r\n"); idx >= 0 {
+		return idx + 1, bytes.ReplaceAll(data[:idx], []byte("\b"), nil), nil
+	}
+	if atEOF {
+		return len(data), bytes.ReplaceAll(data, []byte("\b"), nil), nil
+	}
+	return 0, nil, nil
+}
+
+// runArchiveCommand run external archive command, each line of stdout is passed to onLine.
+// Command is killed once notifier stopped, error contain message printed by command.
+func runArchiveCommand(cmd *exec.Cmd, notifier *ArchiveNotifier, onLine func(line string)) error {
+	return runArchiveCommandWithSplit(cmd, notifier, scanArchiveOutputLines, onLine)
+}
+
+// runArchiveCommandWithSplit is runArchiveCommand for command print output can not be split by line
+func runArchiveCommandWithSplit(cmd *exec.Cmd, notifier *ArchiveNotifier, split bufio.SplitFunc, onLine func(line string)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	doneChan := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-doneChan:
+				return
+			case <-ticker.C:
+				if notifier.IsStop() {
+					cmd.Process.Kill()
+					return
+				}
+			}
+		}
+	}()
+	lastLine := ""
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(split)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) > 0 {
+			lastLine = line
+		}
+		if onLine != nil {
+			onLine(line)
+		}
+	}
+	err = cmd.Wait()
+	close(doneChan)
+	if notifier.IsStop() {
+		return ArchiveInterrupt
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) == 0 {
+			message = strings.TrimSpace(lastLine)
+		}
+		if len(message) > 0 {
+			return &archiveCommandError{err: err, output: message}
+		}
+		return err
+	}
+	return nil
+}
+
+// archiveCommandError is failure of archive command with message it printed
+type archiveCommandError struct {
+	err    error
+	output string
+}
+
+func (e *archiveCommandError) Error() string {
+	return fmt.Sprintf("%v: %s", e.err, e.output)
+}
+
+func (e *archiveCommandError) Unwrap() error {
+	return e.err
+}
+
+// newListCommandError keep output of failed list command, which is read by Output of command
+func newListCommandError(err error, stdout []byte) error {
+	message := strings.TrimSpace(string(stdout))
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		message = strings.TrimSpace(string(exitErr.Stderr) + "\n" + message)
+	}
+	if len(message) == 0 {
+		return err
+	}
+	return &archiveCommandError{err: err, output: message}
+}
+
+// archivePasswordDetector find password failure printed by archive command, pattern match message of the engine.
+// Failure is told by message only, error of command can contain any path.
+type archivePasswordDetector struct {
+	pattern *regexp.Regexp
+	matched bool
+}
+
+func newArchivePasswordDetector(pattern *regexp.Regexp) *archivePasswordDetector {
+	return &archivePasswordDetector{pattern: pattern}
+}
+
+func (d *archivePasswordDetector) onLine(line string) {
+	if d.pattern.MatchString(strings.TrimSpace(line)) {
+		d.matched = true
+	}
+}
+
+// check turn failure of command into ArchivePasswordIncorrect if password failure is printed
+func (d *archivePasswordDetector) check(err error) error {
+	if err == nil || err == ArchiveInterrupt {
+		return err
+	}
+	var commandErr *archiveCommandError
+	if d.matched {
+		return ArchivePasswordIncorrect
+	}
+	if errors.As(err, &commandErr) {
+		for _, line := range strings.Split(commandErr.output, "\n") {
+			if d.pattern.MatchString(strings.TrimSpace(line)) {
+				return ArchivePasswordIncorrect
+			}
+		}
+	}
+	return err
+}
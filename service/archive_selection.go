@@ -0,0 +1,279 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/xid"
+	"github.com/spf13/afero"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"youfile/util"
+)
+
+var (
+	ArchiveEntryOutsideOutput = errors.New("archive entry is outside of output")
+	ArchiveEntryThroughLink   = errors.New("archive entry is written through symlink")
+	ArchiveLinkOutsideOutput  = errors.New("archive link points outside of output")
+)
+
+// ExtractSelection select entries of archive to extract and how to place them in output.
+// nil selection extract whole archive as it is.
+type ExtractSelection struct {
+	// entry path or glob pattern, entries under matched directory are selected too
+	Entries         []string
+	StripComponents int
+	Flatten         bool
+}
+
+func cleanEntryPath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// IsWhole return true if selection extract everything without change path
+func (s *ExtractSelection) IsWhole() bool {
+	return s == nil || (len(s.Entries) == 0 && !s.NeedRelocate())
+}
+
+// NeedRelocate return true if path of entry is changed in output
+func (s *ExtractSelection) NeedRelocate() bool {
+	return s != nil && (s.StripComponents > 0 || s.Flatten)
+}
+
+func (s *ExtractSelection) Match(name string) bool {
+	if s == nil || len(s.Entries) == 0 {
+		return true
+	}
+	name = cleanEntryPath(name)
+	for _, pattern := range s.Entries {
+		pattern = cleanEntryPath(pattern)
+		// match entry itself or one of its parent directory
+		for target := name; target != "." && len(target) > 0; target = path.Dir(target) {
+			if target == pattern {
+				return true
+			}
+			if matched, _ := path.Match(pattern, target); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OutputPath return relative path of entry in output, false if entry should be skipped
+func (s *ExtractSelection) OutputPath(name string, isDir bool) (string, bool) {
+	name = cleanEntryPath(name)
+	if len(name) == 0 {
+		return "", false
+	}
+	if s == nil {
+		return name, true
+	}
+	if s.Flatten {
+		if isDir {
+			return "", false
+		}
+		return path.Base(name), true
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) <= s.StripComponents {
+		return "", false
+	}
+	return strings.Join(parts[s.StripComponents:], "/"), true
+}
+
+// FilterEntries return entries selected
+func (s *ExtractSelection) FilterEntries(entries []*ArchiveEntry) []*ArchiveEntry {
+	result := make([]*ArchiveEntry, 0)
+	for _, entry := range entries {
+		if s.Match(entry.Path) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// extractDestination join relative path to output, keep result inside output
+func extractDestination(output string, rel string) (string, error) {
+	destination := filepath.Join(output, filepath.FromSlash(rel))
+	if !util.IsSubPath(output, destination) {
+		return "", ArchiveEntryOutsideOutput
+	}
+	return destination, nil
+}
+
+// checkExtractParents refuse destination whose parent in output is a symlink, which may be extracted
+// from archive before and point to anywhere
+func checkExtractParents(output string, destination string) error {
+	rel, err := filepath.Rel(output, filepath.Dir(destination))
+	if err != nil {
+		return err
+	}
+	current := output
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return ArchiveEntryThroughLink
+		}
+	}
+	return nil
+}
+
+// removeExtractLink remove symlink at destination, so file is written in place of it instead of through it
+func removeExtractLink(destination string) error {
+	if info, err := os.Lstat(destination); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(destination)
+	}
+	return nil
+}
+
+// maxExtractLinkDepth limit links resolved through each other
+const maxExtractLinkDepth = 40
+
+// resolveExtractLink resolve target of symlink in dir through links extracted before,
+// error if target is absolute or go outside output at any step
+func resolveExtractLink(output string, dir string, linkname string, depth int) (string, error) {
+	if depth > maxExtractLinkDepth || filepath.IsAbs(linkname) || path.IsAbs(filepath.ToSlash(linkname)) {
+		return "", ArchiveLinkOutsideOutput
+	}
+	current := dir
+	// component not exist yet may become symlink later, then `..` after it can not be resolved
+	unknown := false
+	parts := strings.Split(filepath.ToSlash(linkname), "/")
+	for idx, part := range parts {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if unknown {
+				return "", ArchiveLinkOutsideOutput
+			}
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+		}
+		if !util.IsSubPath(output, current) {
+			return "", ArchiveLinkOutsideOutput
+		}
+		if unknown || idx == len(parts)-1 {
+			continue
+		}
+		info, err := os.Lstat(current)
+		if err != nil {
+			unknown = true
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(current)
+			if err != nil {
+				return "", err
+			}
+			current, err = resolveExtractLink(output, filepath.Dir(current), target, depth+1)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	return current, nil
+}
+
+// uniqueExtractDestination avoid flattened entries with same name overwrite each other
+func uniqueExtractDestination(destination string, written map[string]bool) string {
+	for written[destination] {
+		destination = util.RenameDuplicateFilename(destination)
+	}
+	written[destination] = true
+	return destination
+}
+
+// writeArchiveEntry write content of entry to destination
+func writeArchiveEntry(destination string, reader io.Reader, mode os.FileMode, modTime time.Time) error {
+	err := AppFs.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+	file, err := AppFs.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		return AppFs.Chtimes(destination, modTime, modTime)
+	}
+	return nil
+}
+
+// extractWithRelocate let extract function extract into temporary directory in output,
+// then move entries to path of selection. Used by engines can not rename entry when extract.
+// Links are skipped like default engine does, they may point to anywhere after relocate
+func extractWithRelocate(output string, selection *ExtractSelection, extract func(tempOutput string) error) error {
+	tempOutput := filepath.Join(output, fmt.Sprintf(".youfile-extract-%s", xid.New().String()))
+	err := AppFs.MkdirAll(tempOutput, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer AppFs.RemoveAll(tempOutput)
+	err = extract(tempOutput)
+	if err != nil {
+		return err
+	}
+	written := map[string]bool{}
+	return afero.Walk(AppFs, tempOutput, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if itemPath == tempOutput || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(tempOutput, itemPath)
+		if err != nil {
+			return err
+		}
+		outputPath, ok := selection.OutputPath(filepath.ToSlash(rel), info.IsDir())
+		if !ok {
+			return nil
+		}
+		destination, err := extractDestination(output, outputPath)
+		if err != nil {
+			return err
+		}
+		err = checkExtractParents(output, destination)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return AppFs.MkdirAll(destination, os.ModePerm)
+		}
+		destination = uniqueExtractDestination(destination, written)
+		err = removeExtractLink(destination)
+		if err != nil {
+			return err
+		}
+		err = AppFs.MkdirAll(filepath.Dir(destination), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		return AppFs.Rename(itemPath, destination)
+	})
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SevenZipExtractOption struct {
+	BaseExtractOption
+}
+type SevenZipCompressOption struct {
+	BaseCompressOption
+}
+
+// SevenZipEngine drive 7z binary, 7zz is the name of binary shipped by 7-Zip for linux
+type SevenZipEngine struct {
+	Path string
+}
+
+func NewSevenZipEngine(path string) *SevenZipEngine {
+	if len(path) == 0 {
+		for _, name := range []string{"7zz", "7z", "7za"} {
+			if binPath, err := exec.LookPath(name); err == nil {
+				path = binPath
+				break
+			}
+		}
+	}
+	return &SevenZipEngine{Path: path}
+}
+
+func (e *SevenZipEngine) CanCompress() bool {
+	return len(e.Path) > 0
+}
+
+func (e *SevenZipEngine) CanExtract() bool {
+	return len(e.Path) > 0
+}
+
+func (e *SevenZipEngine) SupportCompressFormat(format string) bool {
+	switch format {
+	case ArchiveFormatSevenZip, ArchiveFormatZip, ArchiveFormatTar:
+		return true
+	}
+	return false
+}
+
+// 7z print progress as `45% 12 + name` with -bsp1, number after percentage is count of processed files
+var sevenZipProgressPattern = regexp.MustCompile(`^\s*(\d+)%(?:\s+(\d+))?(?:\s+[+\-=U]\s+(.+))?\s*$`)
+
+// scanSevenZipOutput split output of 7z by line break and backspace used to redraw progress
+func scanSevenZipOutput(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if idx := bytes.IndexAny(data, "\r\n\b"); idx >= 0 {
+		return idx + 1, data[:idx], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// run 7z command, progress of percentage is converted to size by total of notifier.
+// Each line of output is passed to onLine if it is not nil.
+func (e *SevenZipEngine) run(args []string, notifier *ArchiveNotifier, onLine func(line string)) error {
+	cmd := exec.Command(e.Path, args...)
+	totalSize := notifier.GetTotalSize()
+	var lastSize, lastEntry int64
+	return runArchiveCommandWithSplit(cmd, notifier, scanSevenZipOutput, func(line string) {
+		if onLine != nil {
+			onLine(line)
+		}
+		match := sevenZipProgressPattern.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+		if len(match[3]) > 0 {
+			notifier.EntryStart(match[3])
+		}
+		percent, _ := strconv.ParseInt(match[1], 10, 64)
+		size := totalSize * percent / 100
+		if size > lastSize {
+			notifier.AddSize(size - lastSize)
+			lastSize = size
+		}
+		entry, _ := strconv.ParseInt(match[2], 10, 64)
+		for ; lastEntry < entry; lastEntry++ {
+			notifier.EntryDone()
+		}
+	})
+}
+
+func (e *SevenZipEngine) Compress(target []string, output string, option CompressOption) error {
+	if _, err := AppFs.Stat(output); err == nil {
+		// 7z update existing archive instead of create new one
+		return &os.PathError{Op: "create", Path: output, Err: os.ErrExist}
+	}
+	format := option.GetFormat()
+	args := []string{"a", "-y", "-bsp1", fmt.Sprintf("-t%s", format)}
+	if option.GetLevel() > 0 {
+		args = append(args, fmt.Sprintf("-mx=%d", option.GetLevel()))
+	}
+	if len(option.GetPassword()) > 0 {
+		switch format {
+		case ArchiveFormatSevenZip:
+			args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+		case ArchiveFormatZip:
+			args = append(args, fmt.Sprintf("-p%s", option.GetPassword()), "-mem=AES256")
+		default:
+			return ArchivePasswordNotSupported
+		}
+	}
+	if option.GetEncryptHeader() {
+		if format != ArchiveFormatSevenZip {
+			return ArchiveEncryptHeaderNotSupported
+		}
+		args = append(args, "-mhe=on")
+	}
+	if option.GetVolumeSize() > 0 {
+		args = append(args, fmt.Sprintf("-v%db", option.GetVolumeSize()))
+	}
+	for _, exclude := range option.GetExcludes() {
+		args = append(args, fmt.Sprintf("-xr!%s", exclude))
+	}
+	args = append(args, "--", output)
+	args = append(args, target...)
+	err := e.run(args, option.GetNotifier(), nil)
+	if err != nil {
+		removeArchiveOutput(output)
+	}
+	return err
+}
+
+// 7z print `Wrong password?` after error of encrypted data, or `ERROR: Wrong password : name`
+var sevenZipWrongPasswordPattern = regexp.MustCompile(`Wrong password\?|^ERROR: Wrong password|^Enter password`)
+
+func (e *SevenZipEngine) Extract(target string, output string, option ExtractOption) error {
+	detector := newArchivePasswordDetector(sevenZipWrongPasswordPattern)
+	return detector.check(e.extractSelection(target, output, option, detector))
+}
+
+func (e *SevenZipEngine) extractSelection(target string, output string, option ExtractOption, detector *archivePasswordDetector) error {
+	selection := option.GetSelection()
+	entries, err := e.List(target, option)
+	if err != nil {
+		return err
+	}
+	entries = selection.FilterEntries(entries)
+	setExtractTotal(option.GetNotifier(), entries)
+	if selection.IsWhole() {
+		return e.extract(target, output, option, nil, detector)
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if !selection.NeedRelocate() {
+		return e.extract(target, output, option, names, detector)
+	}
+	return extractWithRelocate(output, selection, func(tempOutput string) error {
+		return e.extract(target, tempOutput, option, names, detector)
+	})
+}
+
+// extract run 7z extract command, only entries in names are extracted if not nil
+func (e *SevenZipEngine) extract(target string, output string, option ExtractOption, names []string, detector *archivePasswordDetector) error {
+	args := []string{"x", "-y", "-bsp1", fmt.Sprintf("-o%s", output)}
+	if len(option.GetPassword()) > 0 {
+		args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+	}
+	if names != nil {
+		// names are not wildcard
+		args = append(args, "-spd")
+	}
+	args = append(args, "--", target)
+	args = append(args, names...)
+	return e.run(args, option.GetNotifier(), detector.onLine)
+}
+
+// 7z print error of entry as `ERROR: CRC Failed : name`, errors are printed to stdout by -bse1
+var sevenZipErrorPattern = regexp.MustCompile(`^ERROR:\s+(.+?)\s+:\s+(.+)$`)
+
+// Test run 7z test command, entry is failed if 7z report error on it
+func (e *SevenZipEngine) Test(target string, option ExtractOption) (*ArchiveTestResult, error) {
+	notifier := option.GetNotifier()
+	volumes, err := ResolveArchiveVolumes(target)
+	if err != nil {
+		return nil, err
+	}
+	// percentage is converted by size of archive
+	notifier.SetTotal(volumes.Size, 0)
+	args := []string{"t", "-y", "-bsp1", "-bse1"}
+	if len(option.GetPassword()) > 0 {
+		args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+	}
+	args = append(args, "--", target)
+	result := &ArchiveTestResult{Failures: []*ArchiveTestFailure{}}
+	err = e.run(args, notifier, func(line string) {
+		line = strings.TrimSpace(line)
+		// 7z ask for password when archive is encrypted and no password given
+		if strings.Contains(line, "Wrong password") || strings.HasPrefix(line, "Enter password") {
+			result.WrongPassword = true
+		}
+		if match := sevenZipErrorPattern.FindStringSubmatch(line); match != nil {
+			result.AddFailure(filepath.ToSlash(match[2]), match[1])
+		}
+	})
+	if err == ArchiveInterrupt {
+		return result, err
+	}
+	// 7z exit with error code if any entry is broken
+	if err != nil && len(result.Failures) == 0 && !result.WrongPassword {
+		return result, err
+	}
+	return result, nil
+}
+
+// List parse technical listing of 7z, each entry is a block of "key = value" lines after separator
+func (e *SevenZipEngine) List(target string, option ExtractOption) ([]*ArchiveEntry, error) {
+	args := []string{"l", "-slt"}
+	if len(option.GetPassword()) > 0 {
+		args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+	}
+	args = append(args, "--", target)
+	cmd := exec.Command(e.Path, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	rawOutput, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); len(message) > 0 {
+			return nil, &archiveCommandError{err: err, output: message}
+		}
+		return nil, err
+	}
+	entries := make([]*ArchiveEntry, 0)
+	var entry *ArchiveEntry
+	// properties of archive itself are printed before separator
+	started := false
+	scanner := bufio.NewScanner(bytes.NewReader(rawOutput))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "----------") {
+			started = true
+			continue
+		}
+		if !started {
+			continue
+		}
+		parts := strings.SplitN(line, " = ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if key == "Path" {
+			entry = &ArchiveEntry{Path: filepath.ToSlash(value)}
+			entries = append(entries, entry)
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+		switch key {
+		case "Folder":
+			entry.IsDir = value == "+"
+		case "Attributes":
+			entry.IsDir = entry.IsDir || strings.HasPrefix(value, "D")
+		case "Size":
+			entry.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "Packed Size":
+			entry.CompressedSize, _ = strconv.ParseInt(value, 10, 64)
+		case "Modified":
+			// fraction of second may be appended, e.g. 2021-01-01 12:00:00.1234567
+			if len(value) >= 19 {
+				entry.ModTime, _ = time.ParseInLocation("2006-01-02 15:04:05", value[:19], time.Local)
+			}
+		case "Encrypted":
+			entry.Encrypted = value == "+"
+		}
+	}
+	return entries, nil
+}
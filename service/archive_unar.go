@@ -1,6 +1,13 @@
 package service
 
-import "os/exec"
+import (
+	"encoding/json"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type UnarArchiveEngine struct {
 }
@@ -17,26 +24,187 @@ func (e *UnarArchiveEngine) CanExtract() bool {
 	return true
 }
 
+func (e *UnarArchiveEngine) SupportCompressFormat(format string) bool {
+	return false
+}
+
 func (e *UnarArchiveEngine) Compress(target []string, output string, option CompressOption) error {
 	return nil
 }
 
+// unar tell missing password by `This archive requires a password to unpack.`, and wrong one by failure of entry
+var unarWrongPasswordPattern = regexp.MustCompile(`(?i)^this archive requires a password|^failed!.*(incorrect|wrong) password`)
+
 func (e *UnarArchiveEngine) Extract(target string, output string, option ExtractOption) error {
+	detector := newArchivePasswordDetector(unarWrongPasswordPattern)
+	return detector.check(e.extractSelection(target, output, option, detector))
+}
+
+func (e *UnarArchiveEngine) extractSelection(target string, output string, option ExtractOption, detector *archivePasswordDetector) error {
+	selection := option.GetSelection()
+	notifier := option.GetNotifier()
+	entries, err := e.List(target, option)
+	if err != nil {
+		return err
+	}
+	entries = selection.FilterEntries(entries)
+	setExtractTotal(notifier, entries)
+	if selection.IsWhole() {
+		return e.unar(target, output, option.GetPassword(), nil, notifier, detector)
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if !selection.NeedRelocate() {
+		return e.unar(target, output, option.GetPassword(), names, notifier, detector)
+	}
+	return extractWithRelocate(output, selection, func(tempOutput string) error {
+		return e.unar(target, tempOutput, option.GetPassword(), names, notifier, detector)
+	})
+}
+
+// unar print each entry as `  name  (123 B)... OK.`, size is absent for directory
+var unarEntryPattern = regexp.MustCompile(`^\s+(.+?)\s+\(([\d,]+) B[^)]*\)\.\.\.\s*(.*)$`)
+
+// unar extract archive, only entries in names are extracted if not nil
+func (e *UnarArchiveEngine) unar(target string, output string, password string, names []string, notifier *ArchiveNotifier, detector *archivePasswordDetector) error {
 	args := []string{
 		"-o",
 		output,
-		"-q",
+		// never wait for input
+		"-f",
+		// keep path of entry as it is in archive, whole archive is not wrapped in directory of its name
+		"-D",
+	}
+	if len(password) > 0 {
+		args = append(args, "-p", password)
+	}
+	args = append(args, target)
+	args = append(args, names...)
+	cmd := exec.Command("unar", args...)
+	return runArchiveCommand(cmd, notifier, func(line string) {
+		match := unarEntryPattern.FindStringSubmatch(line)
+		if match == nil {
+			detector.onLine(line)
+			return
+		}
+		// only result of entry is checked, name can be anything
+		detector.onLine(match[3])
+		notifier.EntryStart(match[1])
+		if !strings.HasPrefix(match[3], "OK") {
+			return
+		}
+		size, _ := strconv.ParseInt(strings.ReplaceAll(match[2], ",", ""), 10, 64)
+		notifier.AddSize(size)
+		notifier.EntryDone()
+	})
+}
+
+// lsar print tested entry as `  name... OK.` or `  name... Failed! (Wrong checksum)`
+var lsarTestPattern = regexp.MustCompile(`^\s+(.+?)(?:\s+\(([\d,]+) B[^)]*\))?\.\.\.\s*(.*)$`)
+
+// Test run lsar test command shipped with unar
+func (e *UnarArchiveEngine) Test(target string, option ExtractOption) (*ArchiveTestResult, error) {
+	notifier := option.GetNotifier()
+	// listing fail if header is encrypted and password is wrong, test command report it
+	entries, err := e.List(target, option)
+	if err == nil {
+		setExtractTotal(notifier, entries)
 	}
+	args := []string{"-t"}
 	if len(option.GetPassword()) > 0 {
 		args = append(args, "-p", option.GetPassword())
 	}
 	args = append(args, target)
-	cmd := exec.Command("unar", args...)
-	err := cmd.Run()
+	result := &ArchiveTestResult{Failures: []*ArchiveTestFailure{}}
+	cmd := exec.Command("lsar", args...)
+	err = runArchiveCommand(cmd, notifier, func(line string) {
+		match := lsarTestPattern.FindStringSubmatch(line)
+		if match == nil {
+			if strings.Contains(strings.ToLower(line), "password") {
+				result.WrongPassword = true
+			}
+			return
+		}
+		notifier.EntryStart(match[1])
+		if !strings.HasPrefix(match[3], "OK") {
+			if strings.Contains(strings.ToLower(match[3]), "password") {
+				result.WrongPassword = true
+			}
+			result.AddFailure(match[1], match[3])
+			return
+		}
+		size, _ := strconv.ParseInt(strings.ReplaceAll(match[2], ",", ""), 10, 64)
+		notifier.AddSize(size)
+		notifier.EntryDone()
+	})
+	if err == ArchiveInterrupt {
+		return result, err
+	}
+	// lsar exit with error code if any entry is broken
+	if err != nil && len(result.Failures) == 0 && !result.WrongPassword {
+		return result, err
+	}
+	return result, nil
+}
+
+// setExtractTotal set total of notifier by entries going to be extracted
+func setExtractTotal(notifier *ArchiveNotifier, entries []*ArchiveEntry) {
+	var size, count int64
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		size += entry.Size
+		count += 1
+	}
+	notifier.SetTotal(size, count)
+}
+
+type lsarOutput struct {
+	Contents []struct {
+		FileName         string `json:"XADFileName"`
+		FileSize         int64  `json:"XADFileSize"`
+		CompressedSize   int64  `json:"XADCompressedSize"`
+		LastModification string `json:"XADLastModificationDate"`
+		IsDirectory      int    `json:"XADIsDirectory"`
+		IsEncrypted      int    `json:"XADIsEncrypted"`
+	} `json:"lsarContents"`
+}
+
+// List read entries by json output of lsar, which is shipped with unar
+func (e *UnarArchiveEngine) List(target string, option ExtractOption) ([]*ArchiveEntry, error) {
+	args := []string{"-j"}
+	if len(option.GetPassword()) > 0 {
+		args = append(args, "-p", option.GetPassword())
+	}
+	args = append(args, target)
+	rawOutput, err := exec.Command("lsar", args...).Output()
 	if err != nil {
-		return err
+		return nil, newListCommandError(err, rawOutput)
 	}
-	return nil
+	var output lsarOutput
+	err = json.Unmarshal(rawOutput, &output)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ArchiveEntry, 0, len(output.Contents))
+	for _, content := range output.Contents {
+		entry := &ArchiveEntry{
+			Path:           content.FileName,
+			IsDir:          content.IsDirectory == 1,
+			Size:           content.FileSize,
+			CompressedSize: content.CompressedSize,
+			Encrypted:      content.IsEncrypted == 1,
+		}
+		entry.ModTime, _ = time.Parse("2006-01-02 15:04:05 -0700", content.LastModification)
+		entries = append(entries, entry)
+	}
+	return entries, nil
 }
 
 type UnarArchiveExtractOption struct {
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const MinArchiveVolumeSize = 64 * 1024
+
+var ArchiveVolumeTooSmall = errors.New("archive volume size is too small")
+
+var (
+	// movie.part1.rar, number may be padded
+	rarPartVolumePattern = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`)
+	// movie.rar, movie.r00, movie.r01 ...
+	rarOldVolumePattern = regexp.MustCompile(`(?i)^(.+)\.r(\d{2,3})$`)
+	// spanned zip, movie.z01, movie.z02 ... movie.zip is the last one
+	zipSpanVolumePattern = regexp.MustCompile(`(?i)^(.+)\.z(\d{2})$`)
+	// file split by size, e.g. movie.7z.001, movie.zip.001
+	splitVolumePattern = regexp.MustCompile(`^(.+)\.(\d{3})$`)
+)
+
+// ArchiveVolumeSet is volumes of archive, archive not split has only one volume
+type ArchiveVolumeSet struct {
+	// volume engines should open
+	First string
+	// all volumes in order
+	Volumes []string
+	// name of archive without volume suffix, format is detected by it
+	Name string
+	// volumes are parts of single file, can be read by concatenating them
+	Split bool
+	Size  int64
+}
+
+func archiveVolumeExist(name string) bool {
+	stat, err := AppFs.Stat(name)
+	return err == nil && !stat.IsDir()
+}
+
+// collectArchiveVolumes return consecutive existing volumes from number start
+func collectArchiveVolumes(nameOf func(number int) string, start int) []string {
+	volumes := make([]string, 0)
+	for number := start; archiveVolumeExist(nameOf(number)); number++ {
+		volumes = append(volumes, nameOf(number))
+	}
+	return volumes
+}
+
+// ResolveArchiveVolumes find volume set of target, target can be any volume of set
+func ResolveArchiveVolumes(target string) (*ArchiveVolumeSet, error) {
+	set := &ArchiveVolumeSet{First: target, Volumes: []string{target}, Name: target}
+	lower := strings.ToLower(target)
+	if match := splitVolumePattern.FindStringSubmatch(target); match != nil {
+		base := match[1]
+		set.Volumes = collectArchiveVolumes(func(number int) string {
+			return fmt.Sprintf("%s.%03d", base, number)
+		}, 1)
+		set.First = fmt.Sprintf("%s.%03d", base, 1)
+		set.Name = base
+		set.Split = true
+	} else if match := rarPartVolumePattern.FindStringSubmatch(target); match != nil {
+		base := match[1]
+		width := len(match[2])
+		set.Volumes = collectArchiveVolumes(func(number int) string {
+			return fmt.Sprintf("%s.part%0*d.rar", base, width, number)
+		}, 1)
+		set.First = fmt.Sprintf("%s.part%0*d.rar", base, width, 1)
+		set.Name = base + ".rar"
+	} else if match := rarOldVolumePattern.FindStringSubmatch(target); match != nil || strings.HasSuffix(lower, ".rar") {
+		base := target[:len(target)-4]
+		width := 2
+		if match != nil {
+			base = match[1]
+			width = len(match[2])
+		}
+		if archiveVolumeExist(fmt.Sprintf("%s.r%0*d", base, width, 0)) {
+			set.First = base + ".rar"
+			set.Volumes = append([]string{set.First}, collectArchiveVolumes(func(number int) string {
+				return fmt.Sprintf("%s.r%0*d", base, width, number)
+			}, 0)...)
+			set.Name = set.First
+		}
+	} else if match := zipSpanVolumePattern.FindStringSubmatch(target); match != nil || strings.HasSuffix(lower, ".zip") {
+		base := target[:len(target)-4]
+		if match != nil {
+			base = match[1]
+		}
+		if archiveVolumeExist(base + ".z01") {
+			// spanned zip is opened by last volume, which contain central directory
+			set.First = base + ".zip"
+			set.Volumes = append(collectArchiveVolumes(func(number int) string {
+				return fmt.Sprintf("%s.z%02d", base, number)
+			}, 1), set.First)
+			set.Name = set.First
+		}
+	}
+	if len(set.Volumes) == 0 || !archiveVolumeExist(set.First) {
+		return nil, &os.PathError{Op: "open", Path: set.First, Err: os.ErrNotExist}
+	}
+	for _, volume := range set.Volumes {
+		stat, err := AppFs.Stat(volume)
+		if err != nil {
+			return nil, err
+		}
+		set.Size += stat.Size()
+	}
+	return set, nil
+}
+
+// isRandomAccessZip return true if set is zip can be read by central directory at end of it,
+// spanned zip is not the case
+func (s *ArchiveVolumeSet) isRandomAccessZip() bool {
+	return strings.HasSuffix(strings.ToLower(s.Name), ".zip") && (s.Split || len(s.Volumes) == 1)
+}
+
+// archiveVolumeFile is content of volumes can be read in sequence or randomly
+type archiveVolumeFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+// Open return content of set, volumes are concatenated if set is split
+func (s *ArchiveVolumeSet) Open() (archiveVolumeFile, error) {
+	if !s.Split {
+		return AppFs.Open(s.First)
+	}
+	reader := &archiveVolumeReader{size: s.Size}
+	var offset int64
+	for _, volume := range s.Volumes {
+		file, err := AppFs.Open(volume)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			reader.Close()
+			return nil, err
+		}
+		reader.files = append(reader.files, file)
+		reader.offsets = append(reader.offsets, offset)
+		offset += stat.Size()
+	}
+	return reader, nil
+}
+
+// archiveVolumeReader read split volumes as one file
+type archiveVolumeReader struct {
+	files []afero.File
+	// offset of each volume in whole file
+	offsets []int64
+	size    int64
+	pos     int64
+}
+
+func (r *archiveVolumeReader) ReadAt(p []byte, off int64) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if off >= r.size {
+			return total, io.EOF
+		}
+		idx := sort.Search(len(r.offsets), func(i int) bool {
+			return r.offsets[i] > off
+		}) - 1
+		n, err := r.files[idx].ReadAt(p, off-r.offsets[idx])
+		total += n
+		off += int64(n)
+		p = p[n:]
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		if n == 0 && err == io.EOF {
+			// volume is shorter than it was
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
+
+func (r *archiveVolumeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *archiveVolumeReader) Close() error {
+	var err error
+	for _, file := range r.files {
+		if closeErr := file.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// archiveVolumeWriter split archive into files named output.001, output.002 ...
+type archiveVolumeWriter struct {
+	output  string
+	size    int64
+	written int64
+	file    afero.File
+	Volumes []string
+}
+
+func newArchiveVolumeWriter(output string, size int64) *archiveVolumeWriter {
+	return &archiveVolumeWriter{output: output, size: size, Volumes: make([]string, 0)}
+}
+
+func (w *archiveVolumeWriter) next() error {
+	if w.file != nil {
+		err := w.file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	name := w.output + "." + fmt.Sprintf("%03d", len(w.Volumes)+1)
+	file, err := AppFs.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.written = 0
+	w.Volumes = append(w.Volumes, name)
+	return nil
+}
+
+func (w *archiveVolumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.file == nil || w.written >= w.size {
+			err := w.next()
+			if err != nil {
+				return total, err
+			}
+		}
+		part := p
+		if int64(len(part)) > w.size-w.written {
+			part = part[:w.size-w.written]
+		}
+		n, err := w.file.Write(part)
+		total += n
+		w.written += int64(n)
+		p = p[n:]
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (w *archiveVolumeWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Remove delete volumes written
+func (w *archiveVolumeWriter) Remove() {
+	w.Close()
+	for _, volume := range w.Volumes {
+		AppFs.Remove(volume)
+	}
+}
+
+// ArchiveOutputVolumes return volumes created for output, engine may split output with its own naming
+func ArchiveOutputVolumes(output string) []string {
+	candidates := []string{output, output + ".001"}
+	if strings.HasSuffix(strings.ToLower(output), ".rar") {
+		base := output[:len(output)-4]
+		for width := 1; width <= 3; width++ {
+			candidates = append(candidates, fmt.Sprintf("%s.part%0*d.rar", base, width, 1))
+		}
+	}
+	for _, candidate := range candidates {
+		if !archiveVolumeExist(candidate) {
+			continue
+		}
+		set, err := ResolveArchiveVolumes(candidate)
+		if err == nil {
+			return set.Volumes
+		}
+	}
+	return []string{}
+}
+
+// removeArchiveOutput delete output and its volumes
+func removeArchiveOutput(output string) {
+	for _, volume := range ArchiveOutputVolumes(output) {
+		AppFs.Remove(volume)
+	}
+}
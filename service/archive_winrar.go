@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type WinRARExtractOption struct {
@@ -20,66 +23,252 @@ type WinRAREngine struct {
 }
 
 func (e *WinRAREngine) CanCompress() bool {
-	return true
+	return len(e.RarPath) > 0
 }
 
 func (e *WinRAREngine) CanExtract() bool {
-	return true
+	return len(e.UnRARPath) > 0
+}
+
+func (e *WinRAREngine) SupportCompressFormat(format string) bool {
+	return format == ArchiveFormatRar
 }
 
 func NewWinRAREngine(rarPath string, unRARPath string) *WinRAREngine {
 	return &WinRAREngine{RarPath: rarPath, UnRARPath: unRARPath}
 }
 
+// rar print each entry as `Extracting  name   45%  OK`, percentage is redrawn by backspace
+var rarEntryPattern = regexp.MustCompile(`^(Extracting|Creating|Adding|Updating|Testing)\s+(.+?)(?:\s*\d+%)*\s+OK\s*$`)
+
+// parseRarOutput update notifier by line of rar output, sizeOf return size of entry
+func parseRarOutput(line string, notifier *ArchiveNotifier, sizeOf func(name string) int64) {
+	match := rarEntryPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return
+	}
+	// directory is shown as Creating
+	if match[1] == "Creating" {
+		return
+	}
+	notifier.EntryStart(match[2])
+	notifier.AddSize(sizeOf(match[2]))
+	notifier.EntryDone()
+}
+
 func (e *WinRAREngine) Compress(target []string, output string, option CompressOption) error {
 	args := []string{
-		"a", "-y",
+		// store path relative to source like default engine
+		"a", "-y", "-ep1",
 	}
 	if len(option.GetPassword()) > 0 {
-		args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+		if option.GetEncryptHeader() {
+			args = append(args, fmt.Sprintf("-hp%s", option.GetPassword()))
+		} else {
+			args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+		}
+	}
+	if option.GetVolumeSize() > 0 {
+		args = append(args, fmt.Sprintf("-v%db", option.GetVolumeSize()))
+	}
+	if option.GetLevel() > 0 {
+		// rar has level from 1 to 5
+		args = append(args, fmt.Sprintf("-m%d", (option.GetLevel()+1)/2))
+	}
+	for _, exclude := range option.GetExcludes() {
+		args = append(args, fmt.Sprintf("-x%s", exclude))
 	}
 	args = append(args, output)
 	args = append(args, target...)
 	cmd := exec.Command(e.RarPath, args...)
 	cmd.Dir = filepath.Dir(output)
-	err := cmd.Run()
+	notifier := option.GetNotifier()
+	err := runArchiveCommand(cmd, notifier, func(line string) {
+		parseRarOutput(line, notifier, func(name string) int64 {
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(cmd.Dir, name)
+			}
+			stat, err := AppFs.Stat(name)
+			if err != nil || stat.IsDir() {
+				return 0
+			}
+			return stat.Size()
+		})
+	})
+	if err == ArchiveInterrupt {
+		removeArchiveOutput(output)
+	}
+	return err
+}
+
+func (e *WinRAREngine) Extract(target string, output string, option ExtractOption) error {
+	detector := newArchivePasswordDetector(rarWrongPasswordPattern)
+	return detector.check(e.extractSelection(target, output, option, detector))
+}
+
+func (e *WinRAREngine) extractSelection(target string, output string, option ExtractOption, detector *archivePasswordDetector) error {
+	selection := option.GetSelection()
+	notifier := option.GetNotifier()
+	entries, err := e.List(target, option)
 	if err != nil {
 		return err
 	}
-	return nil
+	entries = selection.FilterEntries(entries)
+	setExtractTotal(notifier, entries)
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		sizes[filepath.FromSlash(entry.Path)] = entry.Size
+	}
+	if selection.IsWhole() {
+		return e.extract(target, output, option.GetPassword(), nil, notifier, sizes, detector)
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, filepath.FromSlash(entry.Path))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if !selection.NeedRelocate() {
+		return e.extract(target, output, option.GetPassword(), names, notifier, sizes, detector)
+	}
+	return extractWithRelocate(output, selection, func(tempOutput string) error {
+		return e.extract(target, tempOutput, option.GetPassword(), names, notifier, sizes, detector)
+	})
 }
 
-func (e *WinRAREngine) Extract(target string, output string, option ExtractOption) error {
+// extract run rar extract command, only entries in names are extracted if not nil
+func (e *WinRAREngine) extract(target string, output string, password string, names []string, notifier *ArchiveNotifier, sizes map[string]int64, detector *archivePasswordDetector) error {
 	args := []string{
 		"x", "-y",
 	}
-	password := option.GetPassword()
 	if len(password) > 0 {
 		args = append(args, fmt.Sprintf("-p%s", password))
+	} else {
+		args = append(args, "-p-")
 	}
 	if !strings.HasSuffix(output, "\\") {
 		output += "\\"
 	}
-	args = append(args, target, output)
+	args = append(args, target)
+	args = append(args, names...)
+	args = append(args, output)
 	cmd := exec.Command(e.UnRARPath, args...)
-	rawOutput := ""
-	go func() {
-		sout, err := cmd.StdoutPipe()
-		if err != nil {
-			fmt.Println(err)
+	return runArchiveCommand(cmd, notifier, func(line string) {
+		detector.onLine(line)
+		parseRarOutput(line, notifier, func(name string) int64 {
+			// extracting line show path in output
+			return sizes[strings.TrimPrefix(name, output)]
+		})
+	})
+}
+
+var (
+	// rar print broken entry as `name  - checksum error`
+	rarTestFailurePattern = regexp.MustCompile(`^(.+?)\s+-\s+(.+)$`)
+	// rar5 print `Incorrect password for name`, header encrypted archive print `The specified password is incorrect.`,
+	// rar4 print `Checksum error in the encrypted file name. Corrupt file or wrong password.`
+	rarWrongPasswordPattern = regexp.MustCompile(`(?i)^incorrect password for (.+)$|^the specified password is incorrect|corrupt file or wrong password\.?$`)
+)
+
+// Test run rar test command, entry is failed if rar report error on it
+func (e *WinRAREngine) Test(target string, option ExtractOption) (*ArchiveTestResult, error) {
+	notifier := option.GetNotifier()
+	sizes := map[string]int64{}
+	// listing fail if header is encrypted and password is wrong, test command report it
+	entries, err := e.List(target, option)
+	if err == nil {
+		setExtractTotal(notifier, entries)
+		for _, entry := range entries {
+			sizes[filepath.FromSlash(entry.Path)] = entry.Size
 		}
-		scanner := bufio.NewScanner(sout)
-		//scanner.Split(bufio.ScanWords)
-		for scanner.Scan() {
-			m := scanner.Text()
-			fmt.Println(m)
-			rawOutput += fmt.Sprintf("%s\n", m)
+	}
+	args := []string{"t", "-y"}
+	if len(option.GetPassword()) > 0 {
+		args = append(args, fmt.Sprintf("-p%s", option.GetPassword()))
+	} else {
+		args = append(args, "-p-")
+	}
+	args = append(args, target)
+	result := &ArchiveTestResult{Failures: []*ArchiveTestFailure{}}
+	cmd := exec.Command(e.UnRARPath, args...)
+	err = runArchiveCommand(cmd, notifier, func(line string) {
+		line = strings.TrimSpace(line)
+		if rarEntryPattern.MatchString(line) {
+			parseRarOutput(line, notifier, func(name string) int64 {
+				return sizes[name]
+			})
+			return
+		}
+		if match := rarWrongPasswordPattern.FindStringSubmatch(line); match != nil {
+			result.WrongPassword = true
+			if len(match[1]) > 0 {
+				result.AddFailure(strings.ReplaceAll(match[1], "\\", "/"), line)
+			}
+			return
 		}
-	}()
-	err := cmd.Run()
+		if match := rarTestFailurePattern.FindStringSubmatch(line); match != nil {
+			result.AddFailure(strings.ReplaceAll(match[1], "\\", "/"), match[2])
+		}
+	})
+	if err == ArchiveInterrupt {
+		return result, err
+	}
+	// rar exit with error code if any entry is broken
+	if err != nil && len(result.Failures) == 0 && !result.WrongPassword {
+		return result, err
+	}
+	return result, nil
+}
+
+// List parse technical listing of rar, each entry is a block of "key: value" lines
+func (e *WinRAREngine) List(target string, option ExtractOption) ([]*ArchiveEntry, error) {
+	args := []string{"lt", "-y"}
+	password := option.GetPassword()
+	if len(password) > 0 {
+		args = append(args, fmt.Sprintf("-p%s", password))
+	} else {
+		// do not wait for password input
+		args = append(args, "-p-")
+	}
+	args = append(args, target)
+	rawOutput, err := exec.Command(e.UnRARPath, args...).Output()
 	if err != nil {
-		return err
+		return nil, newListCommandError(err, rawOutput)
+	}
+	entries := make([]*ArchiveEntry, 0)
+	var entry *ArchiveEntry
+	scanner := bufio.NewScanner(strings.NewReader(string(rawOutput)))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if key == "Name" {
+			entry = &ArchiveEntry{Path: strings.ReplaceAll(value, "\\", "/")}
+			entries = append(entries, entry)
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+		switch key {
+		case "Type":
+			entry.IsDir = value == "Directory"
+		case "Size":
+			entry.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "Packed size":
+			entry.CompressedSize, _ = strconv.ParseInt(value, 10, 64)
+		case "mtime":
+			// nanosecond part is separated by comma, e.g. 2021-01-01 12:00:00,000000000
+			if len(value) >= 19 {
+				entry.ModTime, _ = time.ParseInLocation("2006-01-02 15:04:05", value[:19], time.Local)
+			}
+		case "Flags":
+			entry.Encrypted = strings.Contains(value, "encrypted")
+		}
 	}
-	fmt.Println(rawOutput)
-	return nil
+	return entries, nil
 }
@@ -0,0 +1,801 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/dhowden/tag"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"youfile/util"
+)
+
+var (
+	AudioTagNotSupported      = errors.New("tag of audio file is not supported")
+	AudioTagWriteNotSupported = errors.New("write tag of audio file is not supported")
+	AudioCoverNotFound        = errors.New("audio file has no cover art")
+	InvalidID3Tag             = errors.New("invalid id3v2 tag")
+	InvalidFlacFile           = errors.New("invalid flac file")
+)
+
+var AudioTagExtensions = []string{".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".m4b", ".mp4"}
+
+// tags of these files can be edited
+var AudioTagWriteExtensions = []string{".mp3", ".flac"}
+
+func IsAudioTagSupported(path string) bool {
+	return linq.From(AudioTagExtensions).Contains(strings.ToLower(filepath.Ext(path)))
+}
+
+func IsAudioTagWriteSupported(path string) bool {
+	return linq.From(AudioTagWriteExtensions).Contains(strings.ToLower(filepath.Ext(path)))
+}
+
+type AudioPicture struct {
+	MIMEType string
+	Data     []byte
+}
+
+type AudioTag struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Composer    string
+	Comment     string
+	Year        int
+	Track       int
+	TrackTotal  int
+	Disc        int
+	DiscTotal   int
+	Picture     *AudioPicture
+	// tag format, e.g. ID3v2.3, VORBIS, MP4
+	Format   string
+	FileType string
+}
+
+func ReadAudioTag(path string) (*AudioTag, error) {
+	if !IsAudioTagSupported(path) {
+		return nil, AudioTagNotSupported
+	}
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		if err == tag.ErrNoTagsFound {
+			return &AudioTag{}, nil
+		}
+		return nil, err
+	}
+	audioTag := &AudioTag{
+		Title:       metadata.Title(),
+		Artist:      metadata.Artist(),
+		Album:       metadata.Album(),
+		AlbumArtist: metadata.AlbumArtist(),
+		Genre:       metadata.Genre(),
+		Composer:    metadata.Composer(),
+		Comment:     metadata.Comment(),
+		Year:        metadata.Year(),
+		Format:      string(metadata.Format()),
+		FileType:    string(metadata.FileType()),
+	}
+	audioTag.Track, audioTag.TrackTotal = metadata.Track()
+	audioTag.Disc, audioTag.DiscTotal = metadata.Disc()
+	if picture := metadata.Picture(); picture != nil && len(picture.Data) > 0 {
+		audioTag.Picture = &AudioPicture{MIMEType: picture.MIMEType, Data: picture.Data}
+	}
+	return audioTag, nil
+}
+
+// decodeAudioCover decode embedded cover art of audio file for thumbnail
+func decodeAudioCover(path string) (image.Image, error) {
+	audioTag, err := ReadAudioTag(path)
+	if err != nil {
+		return nil, err
+	}
+	if audioTag.Picture == nil {
+		return nil, AudioCoverNotFound
+	}
+	img, _, err := image.Decode(bytes.NewReader(audioTag.Picture.Data))
+	return img, err
+}
+
+// AudioTagEdit change fields which are not nil, empty value remove the field
+type AudioTagEdit struct {
+	Title       *string
+	Artist      *string
+	Album       *string
+	AlbumArtist *string
+	Genre       *string
+	Composer    *string
+	Comment     *string
+	Year        *int
+	Track       *int
+	TrackTotal  *int
+	Disc        *int
+	DiscTotal   *int
+	Picture     *AudioPicture
+	// remove cover art, ignored when picture is set
+	RemovePicture bool
+	// tag before edit, set by Revert. Fields changed are restored from it as it is, since values
+	// parsed from tag lose data, e.g. full date, numeric genre and multiple values
+	raw *rawAudioTag
+}
+
+// rawAudioTag is tag of audio file as it is stored, frames of id3v2 or vorbis comments and pictures of flac
+type rawAudioTag struct {
+	frames   []*id3Frame
+	comments []string
+	pictures [][]byte
+}
+
+// id3Frames return frames of ids, default comments only for COMM
+func (t *rawAudioTag) id3Frames(ids ...string) []*id3Frame {
+	result := make([]*id3Frame, 0)
+	for _, frame := range t.frames {
+		for _, id := range ids {
+			if frame.id == id && (id != "COMM" || isDefaultComment(frame.data)) {
+				result = append(result, frame)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (e *AudioTagEdit) isPictureChanged() bool {
+	return e.Picture != nil || e.RemovePicture
+}
+
+// readRawAudioTag return tag of audio file as it is stored, pictures keep their type and description
+func readRawAudioTag(path string) (*rawAudioTag, error) {
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	raw := &rawAudioTag{frames: []*id3Frame{}, comments: []string{}, pictures: [][]byte{}}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		_, frames, err := readID3v2Frames(file)
+		if err != nil {
+			return nil, err
+		}
+		raw.frames = frames
+	case ".flac":
+		blocks, err := readFlacBlocks(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			switch block.blockType {
+			case flacBlockVorbisComment:
+				comment, err := parseVorbisComment(block.data)
+				if err != nil {
+					return nil, InvalidFlacFile
+				}
+				raw.comments = comment.comments
+			case flacBlockPicture:
+				raw.pictures = append(raw.pictures, block.data)
+			}
+		}
+	}
+	return raw, nil
+}
+
+// Revert return edit which restore fields changed by this edit to raw tag of file before this edit
+func (e *AudioTagEdit) Revert(original *AudioTag, raw *rawAudioTag) *AudioTagEdit {
+	revert := &AudioTagEdit{raw: raw}
+	copyString := func(changed *string, value string) *string {
+		if changed == nil {
+			return nil
+		}
+		return &value
+	}
+	copyInt := func(changed *int, value int) *int {
+		if changed == nil {
+			return nil
+		}
+		return &value
+	}
+	// values only mark fields to restore, raw tag is written
+	revert.Title = copyString(e.Title, original.Title)
+	revert.Artist = copyString(e.Artist, original.Artist)
+	revert.Album = copyString(e.Album, original.Album)
+	revert.AlbumArtist = copyString(e.AlbumArtist, original.AlbumArtist)
+	revert.Genre = copyString(e.Genre, original.Genre)
+	revert.Composer = copyString(e.Composer, original.Composer)
+	revert.Comment = copyString(e.Comment, original.Comment)
+	revert.Year = copyInt(e.Year, original.Year)
+	revert.Track = copyInt(e.Track, original.Track)
+	revert.TrackTotal = copyInt(e.TrackTotal, original.TrackTotal)
+	revert.Disc = copyInt(e.Disc, original.Disc)
+	revert.DiscTotal = copyInt(e.DiscTotal, original.DiscTotal)
+	revert.RemovePicture = e.isPictureChanged()
+	return revert
+}
+
+// numberPair return "x/n" value of track and disc, with fields not edited taken from current tag
+func numberPair(number *int, total *int, currentNumber int, currentTotal int) string {
+	if number != nil {
+		currentNumber = *number
+	}
+	if total != nil {
+		currentTotal = *total
+	}
+	if currentNumber <= 0 {
+		return ""
+	}
+	if currentTotal <= 0 {
+		return strconv.Itoa(currentNumber)
+	}
+	return fmt.Sprintf("%d/%d", currentNumber, currentTotal)
+}
+
+// WriteAudioTag apply edit to tag of audio file, fields not in edit are kept as it is.
+// Tag of link target is written, owner and hard links of file are kept
+func WriteAudioTag(path string, edit *AudioTagEdit) error {
+	if !IsAudioTagWriteSupported(path) {
+		return AudioTagWriteNotSupported
+	}
+	current, err := ReadAudioTag(path)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	source, err := AppFs.Open(target)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	// write to temp file in same directory, so original file is not broken when failed
+	output, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".tag")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		err = writeID3v2(source, output, edit, current)
+	case ".flac":
+		err = writeFlacTag(source, output, edit, current)
+	}
+	if err != nil {
+		output.Close()
+		return err
+	}
+	err = output.Close()
+	if err != nil {
+		return err
+	}
+	source.Close()
+	// replacing file would break hard links or change owner, content is copied back instead
+	if util.FileLinkCount(info) > 1 || util.CopyFileOwner(output.Name(), info) != nil {
+		return copyFileContent(output.Name(), target)
+	}
+	err = os.Chmod(output.Name(), info.Mode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(output.Name(), target)
+}
+
+// copyFileContent overwrite content of file in place, so its inode, owner and mode are kept
+func copyFileContent(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	output, err := os.OpenFile(to, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, source)
+	if err == nil {
+		err = output.Sync()
+	}
+	if err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+type id3Frame struct {
+	id    string
+	flags []byte
+	data  []byte
+}
+
+func decodeSyncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func encodeSyncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// readID3v2Frames return version and frames of id3v2 tag at head of file, version is 0 if file has no tag.
+// reader is at beginning of audio data after return
+func readID3v2Frames(reader io.ReadSeeker) (byte, []*id3Frame, error) {
+	header := make([]byte, 10)
+	_, err := io.ReadFull(reader, header)
+	if err != nil || string(header[:3]) != "ID3" {
+		_, err = reader.Seek(0, io.SeekStart)
+		return 0, nil, err
+	}
+	version := header[3]
+	flags := header[5]
+	if version != 3 && version != 4 {
+		return 0, nil, fmt.Errorf("%w: version 2.%d", AudioTagWriteNotSupported, version)
+	}
+	if flags&0x80 != 0 {
+		return 0, nil, fmt.Errorf("%w: unsynchronised tag", AudioTagWriteNotSupported)
+	}
+	body := make([]byte, decodeSyncsafe(header[6:10]))
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return 0, nil, InvalidID3Tag
+	}
+	if version == 4 && flags&0x10 != 0 {
+		// skip footer
+		_, err = reader.Seek(10, io.SeekCurrent)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	offset := 0
+	if flags&0x40 != 0 {
+		// skip extended header
+		if len(body) < 4 {
+			return 0, nil, InvalidID3Tag
+		}
+		if version == 4 {
+			offset = decodeSyncsafe(body[:4])
+		} else {
+			offset = int(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+	}
+	frames := make([]*id3Frame, 0)
+	for offset+10 <= len(body) && body[offset] != 0 {
+		var size int
+		if version == 4 {
+			size = decodeSyncsafe(body[offset+4 : offset+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		}
+		if size < 0 || offset+10+size > len(body) {
+			return 0, nil, InvalidID3Tag
+		}
+		frames = append(frames, &id3Frame{
+			id:    string(body[offset : offset+4]),
+			flags: body[offset+8 : offset+10],
+			data:  body[offset+10 : offset+10+size],
+		})
+		offset += 10 + size
+	}
+	return version, frames, nil
+}
+
+// encodeID3Text return text with encoding byte, utf-16 for v2.3 and utf-8 for v2.4
+func encodeID3Text(version byte, text string, terminated bool) []byte {
+	if version == 4 {
+		data := append([]byte{3}, text...)
+		if terminated {
+			data = append(data, 0)
+		}
+		return data
+	}
+	data := []byte{1, 0xff, 0xfe}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		data = append(data, byte(unit), byte(unit>>8))
+	}
+	if terminated {
+		data = append(data, 0, 0)
+	}
+	return data
+}
+
+// isDefaultComment check description of COMM frame is empty, comments with description are written by other apps
+func isDefaultComment(data []byte) bool {
+	if len(data) < 5 {
+		return true
+	}
+	description := data[4:]
+	switch data[0] {
+	case 1:
+		description = bytes.TrimPrefix(bytes.TrimPrefix(description, []byte{0xff, 0xfe}), []byte{0xfe, 0xff})
+		return len(description) >= 2 && description[0] == 0 && description[1] == 0
+	case 2:
+		return len(description) >= 2 && description[0] == 0 && description[1] == 0
+	default:
+		return description[0] == 0
+	}
+}
+
+func writeID3v2(source io.ReadSeeker, output io.Writer, edit *AudioTagEdit, current *AudioTag) error {
+	version, frames, err := readID3v2Frames(source)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = 3
+	}
+	removed := map[string]bool{}
+	added := make([]*id3Frame, 0)
+	setText := func(value *string, ids ...string) {
+		if value == nil {
+			return
+		}
+		for _, id := range ids {
+			removed[id] = true
+		}
+		if edit.raw != nil {
+			added = append(added, edit.raw.id3Frames(ids...)...)
+			return
+		}
+		if len(*value) > 0 {
+			added = append(added, &id3Frame{id: ids[0], data: encodeID3Text(version, *value, false)})
+		}
+	}
+	setText(edit.Title, "TIT2")
+	setText(edit.Artist, "TPE1")
+	setText(edit.Album, "TALB")
+	setText(edit.AlbumArtist, "TPE2")
+	setText(edit.Genre, "TCON")
+	setText(edit.Composer, "TCOM")
+	if edit.Year != nil {
+		year := ""
+		if *edit.Year > 0 {
+			year = strconv.Itoa(*edit.Year)
+		}
+		if version == 4 {
+			setText(&year, "TDRC", "TYER")
+		} else {
+			setText(&year, "TYER", "TDRC")
+		}
+	}
+	if edit.Track != nil || edit.TrackTotal != nil {
+		track := numberPair(edit.Track, edit.TrackTotal, current.Track, current.TrackTotal)
+		setText(&track, "TRCK")
+	}
+	if edit.Disc != nil || edit.DiscTotal != nil {
+		disc := numberPair(edit.Disc, edit.DiscTotal, current.Disc, current.DiscTotal)
+		setText(&disc, "TPOS")
+	}
+	if edit.Comment != nil && edit.raw != nil {
+		added = append(added, edit.raw.id3Frames("COMM")...)
+	} else if edit.Comment != nil && len(*edit.Comment) > 0 {
+		// encoding byte, language, empty description then text
+		description := encodeID3Text(version, "", true)
+		text := encodeID3Text(version, *edit.Comment, false)
+		data := append([]byte{description[0]}, "eng"...)
+		data = append(data, description[1:]...)
+		data = append(data, text[1:]...)
+		added = append(added, &id3Frame{id: "COMM", data: data})
+	}
+	if edit.isPictureChanged() {
+		removed["APIC"] = true
+		if edit.Picture != nil {
+			// latin1 mime type, front cover, empty description
+			data := append([]byte{0}, edit.Picture.MIMEType...)
+			data = append(data, 0, 3, 0)
+			data = append(data, edit.Picture.Data...)
+			added = append(added, &id3Frame{id: "APIC", data: data})
+		}
+		if edit.Picture == nil && edit.raw != nil {
+			added = append(added, edit.raw.id3Frames("APIC")...)
+		}
+	}
+	body := bytes.Buffer{}
+	writeFrame := func(frame *id3Frame) {
+		body.WriteString(frame.id)
+		if version == 4 {
+			body.Write(encodeSyncsafe(len(frame.data)))
+		} else {
+			size := make([]byte, 4)
+			binary.BigEndian.PutUint32(size, uint32(len(frame.data)))
+			body.Write(size)
+		}
+		if frame.flags != nil {
+			body.Write(frame.flags)
+		} else {
+			body.Write([]byte{0, 0})
+		}
+		body.Write(frame.data)
+	}
+	// new frames go first, so readers which take first frame of id get edited value
+	for _, frame := range added {
+		writeFrame(frame)
+	}
+	for _, frame := range frames {
+		if removed[frame.id] {
+			continue
+		}
+		if frame.id == "COMM" && edit.Comment != nil && isDefaultComment(frame.data) {
+			continue
+		}
+		writeFrame(frame)
+	}
+	if body.Len() > 0 {
+		header := append([]byte{'I', 'D', '3', version, 0, 0}, encodeSyncsafe(body.Len())...)
+		_, err = output.Write(header)
+		if err != nil {
+			return err
+		}
+		_, err = output.Write(body.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(output, source)
+	return err
+}
+
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockPadding       = 1
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// readFlacBlocks return metadata blocks of flac, reader is at beginning of audio frames after return
+func readFlacBlocks(reader io.Reader) ([]*flacBlock, error) {
+	magic := make([]byte, 4)
+	_, err := io.ReadFull(reader, magic)
+	if err != nil || string(magic) != "fLaC" {
+		return nil, InvalidFlacFile
+	}
+	blocks := make([]*flacBlock, 0)
+	for {
+		header := make([]byte, 4)
+		_, err = io.ReadFull(reader, header)
+		if err != nil {
+			return nil, InvalidFlacFile
+		}
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, size)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return nil, InvalidFlacFile
+		}
+		blocks = append(blocks, &flacBlock{blockType: header[0] & 0x7f, data: data})
+		if header[0]&0x80 != 0 {
+			return blocks, nil
+		}
+	}
+}
+
+type vorbisComment struct {
+	vendor   string
+	comments []string
+}
+
+func parseVorbisComment(data []byte) (*vorbisComment, error) {
+	reader := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var size uint32
+		err := binary.Read(reader, binary.LittleEndian, &size)
+		if err != nil {
+			return "", err
+		}
+		if int64(size) > int64(reader.Len()) {
+			return "", InvalidFlacFile
+		}
+		value := make([]byte, size)
+		_, err = io.ReadFull(reader, value)
+		return string(value), err
+	}
+	vendor, err := readString()
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	err = binary.Read(reader, binary.LittleEndian, &count)
+	if err != nil {
+		return nil, err
+	}
+	comment := &vorbisComment{vendor: vendor, comments: []string{}}
+	for idx := uint32(0); idx < count; idx++ {
+		value, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		comment.comments = append(comment.comments, value)
+	}
+	return comment, nil
+}
+
+func (c *vorbisComment) bytes() []byte {
+	buf := bytes.Buffer{}
+	binary.Write(&buf, binary.LittleEndian, uint32(len(c.vendor)))
+	buf.WriteString(c.vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(c.comments)))
+	for _, comment := range c.comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(comment)))
+		buf.WriteString(comment)
+	}
+	return buf.Bytes()
+}
+
+// isVorbisCommentOf check name of comment is one of keys, keys are case insensitive
+func isVorbisCommentOf(comment string, keys []string) bool {
+	name := comment
+	if idx := strings.Index(comment, "="); idx >= 0 {
+		name = comment[:idx]
+	}
+	for _, key := range keys {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// set replace all values of keys by value of first key, keys are case insensitive
+func (c *vorbisComment) set(value string, keys ...string) {
+	kept := make([]string, 0, len(c.comments))
+	for _, comment := range c.comments {
+		if !isVorbisCommentOf(comment, keys) {
+			kept = append(kept, comment)
+		}
+	}
+	if len(value) > 0 {
+		kept = append(kept, keys[0]+"="+value)
+	}
+	c.comments = kept
+}
+
+// restore replace all values of keys by values of them in original comments as they are
+func (c *vorbisComment) restore(original []string, keys ...string) {
+	c.set("", keys...)
+	for _, comment := range original {
+		if isVorbisCommentOf(comment, keys) {
+			c.comments = append(c.comments, comment)
+		}
+	}
+}
+
+func flacPictureBlock(picture *AudioPicture) []byte {
+	buf := bytes.Buffer{}
+	// front cover, empty description, dimensions left unknown
+	binary.Write(&buf, binary.BigEndian, uint32(3))
+	binary.Write(&buf, binary.BigEndian, uint32(len(picture.MIMEType)))
+	buf.WriteString(picture.MIMEType)
+	binary.Write(&buf, binary.BigEndian, uint32(0))
+	binary.Write(&buf, binary.BigEndian, [4]uint32{})
+	binary.Write(&buf, binary.BigEndian, uint32(len(picture.Data)))
+	buf.Write(picture.Data)
+	return buf.Bytes()
+}
+
+func writeFlacTag(source io.Reader, output io.Writer, edit *AudioTagEdit, current *AudioTag) error {
+	blocks, err := readFlacBlocks(source)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 || blocks[0].blockType != flacBlockStreamInfo {
+		return InvalidFlacFile
+	}
+	comment := &vorbisComment{vendor: "youfile", comments: []string{}}
+	for _, block := range blocks {
+		if block.blockType == flacBlockVorbisComment {
+			comment, err = parseVorbisComment(block.data)
+			if err != nil {
+				return InvalidFlacFile
+			}
+			break
+		}
+	}
+	// undo restore original comments of keys instead of value
+	set := func(value string, keys ...string) {
+		if edit.raw != nil {
+			comment.restore(edit.raw.comments, keys...)
+			return
+		}
+		comment.set(value, keys...)
+	}
+	setString := func(value *string, keys ...string) {
+		if value != nil {
+			set(*value, keys...)
+		}
+	}
+	setString(edit.Title, "TITLE")
+	setString(edit.Artist, "ARTIST")
+	setString(edit.Album, "ALBUM")
+	setString(edit.AlbumArtist, "ALBUMARTIST", "ALBUM ARTIST")
+	setString(edit.Genre, "GENRE")
+	setString(edit.Composer, "COMPOSER")
+	setString(edit.Comment, "COMMENT", "DESCRIPTION")
+	if edit.Year != nil {
+		year := ""
+		if *edit.Year > 0 {
+			year = strconv.Itoa(*edit.Year)
+		}
+		set(year, "DATE")
+	}
+	setNumber := func(value *int, keys ...string) {
+		if value == nil {
+			return
+		}
+		number := ""
+		if *value > 0 {
+			number = strconv.Itoa(*value)
+		}
+		set(number, keys...)
+	}
+	setNumber(edit.Track, "TRACKNUMBER")
+	setNumber(edit.TrackTotal, "TRACKTOTAL", "TOTALTRACKS")
+	setNumber(edit.Disc, "DISCNUMBER")
+	setNumber(edit.DiscTotal, "DISCTOTAL", "TOTALDISCS")
+
+	// stream info must be first, padding is dropped since whole file is rewritten
+	result := []*flacBlock{blocks[0], {blockType: flacBlockVorbisComment, data: comment.bytes()}}
+	if edit.Picture != nil {
+		result = append(result, &flacBlock{blockType: flacBlockPicture, data: flacPictureBlock(edit.Picture)})
+	} else if edit.isPictureChanged() && edit.raw != nil {
+		for _, picture := range edit.raw.pictures {
+			result = append(result, &flacBlock{blockType: flacBlockPicture, data: picture})
+		}
+	}
+	for _, block := range blocks[1:] {
+		switch block.blockType {
+		case flacBlockVorbisComment, flacBlockPadding:
+			continue
+		case flacBlockPicture:
+			if edit.isPictureChanged() {
+				continue
+			}
+		}
+		result = append(result, block)
+	}
+	_, err = output.Write([]byte("fLaC"))
+	if err != nil {
+		return err
+	}
+	for idx, block := range result {
+		if len(block.data) >= 1<<24 {
+			return fmt.Errorf("%w: metadata block too large", AudioTagWriteNotSupported)
+		}
+		header := block.blockType
+		if idx == len(result)-1 {
+			header |= 0x80
+		}
+		size := len(block.data)
+		_, err = output.Write([]byte{header, byte(size >> 16), byte(size >> 8), byte(size)})
+		if err != nil {
+			return err
+		}
+		_, err = output.Write(block.data)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(output, source)
+	return err
+}
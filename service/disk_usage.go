@@ -0,0 +1,313 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	DiskUsageInterrupt    = errors.New("disk usage interrupt")
+	DiskUsageNodeNotFound = errors.New("node not found")
+)
+
+const (
+	DiskUsageAgeDay     = "day"
+	DiskUsageAgeWeek    = "week"
+	DiskUsageAgeMonth   = "month"
+	DiskUsageAgeYear    = "year"
+	DiskUsageAgeOlder   = "older"
+	diskUsageMaxWorkers = 8
+)
+
+type DiskUsageNode struct {
+	Name      string           `json:"name"`
+	Path      string           `json:"path"`
+	IsDir     bool             `json:"is_dir"`
+	Size      int64            `json:"size"`
+	FileCount int64            `json:"file_count"`
+	DirCount  int64            `json:"dir_count"`
+	ModTime   time.Time        `json:"mod_time"`
+	Children  []*DiskUsageNode `json:"children,omitempty"`
+}
+
+type DiskUsageGroup struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	FileCount int64  `json:"file_count"`
+}
+
+type DiskUsageResult struct {
+	Root       *DiskUsageNode
+	TopFiles   []*DiskUsageNode
+	TopDirs    []*DiskUsageNode
+	Extensions []*DiskUsageGroup
+	Ages       []*DiskUsageGroup
+}
+
+type DiskUsageNotifier struct {
+	ScanFile    int64
+	ScanDir     int64
+	ScanSize    int64
+	CurrentPath atomic.Value
+	stopFlag    int32
+}
+
+func (n *DiskUsageNotifier) Stop() {
+	atomic.StoreInt32(&n.stopFlag, 1)
+}
+func (n *DiskUsageNotifier) IsStop() bool {
+	return atomic.LoadInt32(&n.stopFlag) == 1
+}
+
+type diskUsageScanner struct {
+	notifier *DiskUsageNotifier
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	errLock  sync.Mutex
+	err      error
+}
+
+func (s *diskUsageScanner) setError(err error) {
+	s.errLock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.errLock.Unlock()
+}
+
+// scanDir read children of node, sub directories are scanned by another worker if available
+func (s *diskUsageScanner) scanDir(node *DiskUsageNode) {
+	if s.notifier.IsStop() {
+		s.setError(DiskUsageInterrupt)
+		return
+	}
+	s.notifier.CurrentPath.Store(node.Path)
+	items, err := ReadDir(node.Path)
+	if err != nil {
+		// skip unreadable directory instead of abort the whole scan
+		return
+	}
+	node.Children = make([]*DiskUsageNode, 0, len(items))
+	for _, item := range items {
+		child := &DiskUsageNode{
+			Name:    item.Name(),
+			Path:    filepath.Join(node.Path, item.Name()),
+			IsDir:   item.IsDir(),
+			ModTime: item.ModTime(),
+		}
+		node.Children = append(node.Children, child)
+		if !item.IsDir() {
+			child.Size = item.Size()
+			child.FileCount = 1
+			atomic.AddInt64(&s.notifier.ScanFile, 1)
+			atomic.AddInt64(&s.notifier.ScanSize, item.Size())
+			continue
+		}
+		atomic.AddInt64(&s.notifier.ScanDir, 1)
+		select {
+		case s.sem <- struct{}{}:
+			s.wg.Add(1)
+			go func(dir *DiskUsageNode) {
+				defer func() {
+					<-s.sem
+					s.wg.Done()
+				}()
+				s.scanDir(dir)
+			}(child)
+		default:
+			s.scanDir(child)
+		}
+	}
+}
+
+// summarize fill size and count of directory nodes
+func (n *DiskUsageNode) summarize() {
+	if !n.IsDir {
+		return
+	}
+	n.Size = 0
+	n.FileCount = 0
+	n.DirCount = 0
+	for _, child := range n.Children {
+		child.summarize()
+		n.Size += child.Size
+		n.FileCount += child.FileCount
+		n.DirCount += child.DirCount
+		if child.IsDir {
+			n.DirCount += 1
+		}
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Size > n.Children[j].Size
+	})
+}
+
+func (n *DiskUsageNode) walk(fn func(node *DiskUsageNode)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
+// Shallow return copy of node with direct children only
+func (n *DiskUsageNode) Shallow(limit int) *DiskUsageNode {
+	node := *n
+	node.Children = make([]*DiskUsageNode, 0)
+	for _, child := range n.Children {
+		if limit > 0 && len(node.Children) == limit {
+			break
+		}
+		childCopy := *child
+		childCopy.Children = nil
+		node.Children = append(node.Children, &childCopy)
+	}
+	return &node
+}
+
+func diskUsageAgeKey(modTime time.Time, now time.Time) string {
+	age := now.Sub(modTime)
+	switch {
+	case age < 24*time.Hour:
+		return DiskUsageAgeDay
+	case age < 7*24*time.Hour:
+		return DiskUsageAgeWeek
+	case age < 30*24*time.Hour:
+		return DiskUsageAgeMonth
+	case age < 365*24*time.Hour:
+		return DiskUsageAgeYear
+	default:
+		return DiskUsageAgeOlder
+	}
+}
+
+func sortDiskUsageGroups(groups map[string]*DiskUsageGroup) []*DiskUsageGroup {
+	result := make([]*DiskUsageGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Size > result[j].Size
+	})
+	return result
+}
+
+func analyzeDiskUsage(root *DiskUsageNode, topN int) *DiskUsageResult {
+	result := &DiskUsageResult{Root: root}
+	files := make([]*DiskUsageNode, 0)
+	dirs := make([]*DiskUsageNode, 0)
+	extensions := map[string]*DiskUsageGroup{}
+	ages := map[string]*DiskUsageGroup{}
+	now := time.Now()
+	root.walk(func(node *DiskUsageNode) {
+		if node.IsDir {
+			if node != root {
+				dirs = append(dirs, node)
+			}
+			return
+		}
+		files = append(files, node)
+		ext := strings.ToLower(filepath.Ext(node.Name))
+		if _, exist := extensions[ext]; !exist {
+			extensions[ext] = &DiskUsageGroup{Key: ext}
+		}
+		extensions[ext].Size += node.Size
+		extensions[ext].FileCount += 1
+		ageKey := diskUsageAgeKey(node.ModTime, now)
+		if _, exist := ages[ageKey]; !exist {
+			ages[ageKey] = &DiskUsageGroup{Key: ageKey}
+		}
+		ages[ageKey].Size += node.Size
+		ages[ageKey].FileCount += 1
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Size > dirs[j].Size
+	})
+	if len(files) > topN {
+		files = files[:topN]
+	}
+	if len(dirs) > topN {
+		dirs = dirs[:topN]
+	}
+	result.TopFiles = make([]*DiskUsageNode, 0, len(files))
+	for _, file := range files {
+		fileCopy := *file
+		result.TopFiles = append(result.TopFiles, &fileCopy)
+	}
+	result.TopDirs = make([]*DiskUsageNode, 0, len(dirs))
+	for _, dir := range dirs {
+		dirCopy := *dir
+		dirCopy.Children = nil
+		result.TopDirs = append(result.TopDirs, &dirCopy)
+	}
+	result.Extensions = sortDiskUsageGroups(extensions)
+	result.Ages = sortDiskUsageGroups(ages)
+	return result
+}
+
+// ScanDiskUsage build size tree of src concurrently
+func ScanDiskUsage(src string, topN int, notifier *DiskUsageNotifier) (*DiskUsageResult, error) {
+	stat, err := AppFs.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	root := &DiskUsageNode{
+		Name:    stat.Name(),
+		Path:    src,
+		IsDir:   stat.IsDir(),
+		ModTime: stat.ModTime(),
+	}
+	if !stat.IsDir() {
+		root.Size = stat.Size()
+		root.FileCount = 1
+		return analyzeDiskUsage(root, topN), nil
+	}
+	if notifier == nil {
+		notifier = &DiskUsageNotifier{}
+	}
+	scanner := &diskUsageScanner{
+		notifier: notifier,
+		sem:      make(chan struct{}, diskUsageMaxWorkers),
+	}
+	scanner.scanDir(root)
+	scanner.wg.Wait()
+	if scanner.err != nil {
+		return nil, scanner.err
+	}
+	root.summarize()
+	return analyzeDiskUsage(root, topN), nil
+}
+
+// FindNode find node with path in tree
+func (r *DiskUsageResult) FindNode(target string) (*DiskUsageNode, error) {
+	target = filepath.Clean(target)
+	node := r.Root
+	if target == filepath.Clean(node.Path) {
+		return node, nil
+	}
+	rel, err := filepath.Rel(node.Path, target)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, DiskUsageNodeNotFound
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		var next *DiskUsageNode
+		for _, child := range node.Children {
+			if child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, DiskUsageNodeNotFound
+		}
+		node = next
+	}
+	return node, nil
+}
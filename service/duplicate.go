@@ -0,0 +1,423 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"youfile/database"
+	"youfile/util"
+)
+
+const (
+	DuplicatePhaseScan    = "Scan"
+	DuplicatePhasePartial = "PartialHash"
+	DuplicatePhaseFull    = "FullHash"
+
+	DuplicateActionDelete   = "delete"
+	DuplicateActionHardlink = "hardlink"
+	DuplicateActionTrash    = "trash"
+
+	DuplicateKeepNewest = "newest"
+	DuplicateKeepOldest = "oldest"
+	DuplicateKeepPath   = "path"
+
+	duplicatePartialSize = 64 * 1024
+)
+
+var (
+	DuplicateInterrupt      = errors.New("find duplicates interrupt")
+	DuplicateFileChanged    = errors.New("file changed since scan")
+	DuplicateKeepNotFound   = errors.New("keep file not in group")
+	UnknownDuplicateAction  = errors.New("unknown duplicate action")
+	UnknownDuplicateKeepOpt = errors.New("unknown keep option")
+)
+
+type DuplicateFile struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type DuplicateGroup struct {
+	Id       int              `json:"id"`
+	Hash     string           `json:"hash"`
+	Size     int64            `json:"size"`
+	Files    []*DuplicateFile `json:"files"`
+	Resolved bool             `json:"resolved"`
+}
+
+// Wasted return size can be freed by keep only one file
+func (g *DuplicateGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+type DuplicateNotifier struct {
+	PhaseChan     chan string
+	ScanChan      chan string
+	HashChan      chan string
+	HashTotalChan chan int
+	StopFlag      bool
+}
+
+type FindDuplicatesOption struct {
+	Src     []string
+	MinSize int64
+}
+
+func fileHash(path string, partial bool) (string, error) {
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if !partial {
+		_, err = io.Copy(hash, file)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	}
+	// head and tail of file
+	_, err = io.CopyN(hash, file, duplicatePartialSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if stat.Size() > duplicatePartialSize*2 {
+		_, err = file.Seek(-duplicatePartialSize, io.SeekEnd)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hash, file)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// GetCachedFileHash read hash of file from cache, computed hash is saved for next time.
+// Cache entry is invalid when size or modify time of file changed.
+func GetCachedFileHash(path string, info os.FileInfo, partial bool) (string, error) {
+	var cache database.FileHash
+	err := database.Instance.Where("path = ?", path).
+		Attrs(database.FileHash{Path: path}).
+		FirstOrInit(&cache).Error
+	if err != nil {
+		return "", err
+	}
+	if cache.Size != info.Size() || !cache.ModTime.Equal(info.ModTime()) {
+		cache.Size = info.Size()
+		cache.ModTime = info.ModTime()
+		cache.PartialHash = ""
+		cache.FullHash = ""
+	}
+	if partial && len(cache.PartialHash) > 0 {
+		return cache.PartialHash, nil
+	}
+	if !partial && len(cache.FullHash) > 0 {
+		return cache.FullHash, nil
+	}
+	hash, err := fileHash(path, partial)
+	if err != nil {
+		return "", err
+	}
+	if partial {
+		cache.PartialHash = hash
+	} else {
+		cache.FullHash = hash
+	}
+	err = database.Instance.Save(&cache).Error
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+type duplicateCandidate struct {
+	path string
+	info os.FileInfo
+}
+
+// fileIdentity is device and inode of file, paths hard linked together have same identity
+type fileIdentity struct {
+	device uint64
+	inode  uint64
+}
+
+func groupCandidates(groups [][]*duplicateCandidate, partial bool, notifier *DuplicateNotifier) ([][]*duplicateCandidate, error) {
+	result := make([][]*duplicateCandidate, 0)
+	for _, group := range groups {
+		byHash := map[string][]*duplicateCandidate{}
+		hashOrder := make([]string, 0)
+		for _, candidate := range group {
+			if notifier != nil {
+				if notifier.StopFlag {
+					return nil, DuplicateInterrupt
+				}
+				notifier.HashChan <- candidate.path
+			}
+			hash, err := GetCachedFileHash(candidate.path, candidate.info, partial)
+			if err != nil {
+				// file may be removed or unreadable, skip it
+				continue
+			}
+			if _, exist := byHash[hash]; !exist {
+				hashOrder = append(hashOrder, hash)
+			}
+			byHash[hash] = append(byHash[hash], candidate)
+		}
+		for _, hash := range hashOrder {
+			if len(byHash[hash]) > 1 {
+				result = append(result, byHash[hash])
+			}
+		}
+	}
+	return result, nil
+}
+
+func countCandidates(groups [][]*duplicateCandidate) int {
+	count := 0
+	for _, group := range groups {
+		count += len(group)
+	}
+	return count
+}
+
+// FindDuplicates group files by size, then by partial hash, then by full hash.
+// Paths hard linked together share content on disk, so only first path of each inode is candidate
+func FindDuplicates(option FindDuplicatesOption, notifier *DuplicateNotifier) ([]*DuplicateGroup, error) {
+	if notifier != nil {
+		notifier.PhaseChan <- DuplicatePhaseScan
+	}
+	bySize := map[int64][]*duplicateCandidate{}
+	visited := map[string]bool{}
+	identities := map[fileIdentity]bool{}
+	for _, src := range option.Src {
+		err := afero.Walk(AppFs, src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsPermission(err) {
+					return nil
+				}
+				return err
+			}
+			if notifier != nil && notifier.StopFlag {
+				return DuplicateInterrupt
+			}
+			if !info.Mode().IsRegular() || info.Size() == 0 || info.Size() < option.MinSize {
+				return nil
+			}
+			if visited[path] {
+				return nil
+			}
+			visited[path] = true
+			if inode := util.FileInode(info); inode != 0 {
+				identity := fileIdentity{device: util.FileDevice(info), inode: inode}
+				if identities[identity] {
+					return nil
+				}
+				identities[identity] = true
+			}
+			if notifier != nil {
+				notifier.ScanChan <- path
+			}
+			bySize[info.Size()] = append(bySize[info.Size()], &duplicateCandidate{path: path, info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	groups := make([][]*duplicateCandidate, 0)
+	for _, group := range bySize {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	if notifier != nil {
+		notifier.PhaseChan <- DuplicatePhasePartial
+		notifier.HashTotalChan <- countCandidates(groups)
+	}
+	groups, err := groupCandidates(groups, true, notifier)
+	if err != nil {
+		return nil, err
+	}
+	if notifier != nil {
+		notifier.PhaseChan <- DuplicatePhaseFull
+		notifier.HashTotalChan <- countCandidates(groups)
+	}
+	groups, err = groupCandidates(groups, false, notifier)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*DuplicateGroup, 0)
+	for _, group := range groups {
+		duplicateGroup := &DuplicateGroup{
+			Size:  group[0].info.Size(),
+			Files: make([]*DuplicateFile, 0),
+		}
+		for _, candidate := range group {
+			duplicateGroup.Files = append(duplicateGroup.Files, &DuplicateFile{
+				Path:    candidate.path,
+				ModTime: candidate.info.ModTime(),
+			})
+		}
+		duplicateGroup.Hash, _ = GetCachedFileHash(group[0].path, group[0].info, false)
+		result = append(result, duplicateGroup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Wasted() > result[j].Wasted()
+	})
+	for idx, group := range result {
+		group.Id = idx
+	}
+	return result, nil
+}
+
+type ResolveDuplicateOption struct {
+	Action   string
+	Keep     string
+	KeepPath string
+	Username string
+	// real path to display path of scanned directories, recorded with trashed files
+	DisplayPath map[string]string
+}
+
+type ResolveDuplicateResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+func (g *DuplicateGroup) keepFile(keep string, keepPath string) (*DuplicateFile, error) {
+	var target *DuplicateFile
+	for _, file := range g.Files {
+		switch keep {
+		case DuplicateKeepNewest:
+			if target == nil || file.ModTime.After(target.ModTime) {
+				target = file
+			}
+		case DuplicateKeepOldest:
+			if target == nil || file.ModTime.Before(target.ModTime) {
+				target = file
+			}
+		case DuplicateKeepPath:
+			if filepath.Clean(file.Path) == filepath.Clean(keepPath) {
+				target = file
+			}
+		default:
+			return nil, UnknownDuplicateKeepOpt
+		}
+	}
+	if target == nil {
+		return nil, DuplicateKeepNotFound
+	}
+	return target, nil
+}
+
+func checkDuplicateUnchanged(file *DuplicateFile, size int64) (os.FileInfo, error) {
+	stat, err := AppFs.Stat(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() != size || !stat.ModTime().Equal(file.ModTime) {
+		return nil, DuplicateFileChanged
+	}
+	return stat, nil
+}
+
+// freedSize return size freed by removing path of file, nothing is freed if file has other hard links
+func freedSize(info os.FileInfo) int64 {
+	if util.FileLinkCount(info) > 1 {
+		return 0
+	}
+	return info.Size()
+}
+
+func duplicateDisplayPath(target string, mapping map[string]string) string {
+	for realPath, displayPath := range mapping {
+		if util.IsSubPath(realPath, target) {
+			return strings.Replace(target, realPath, displayPath, 1)
+		}
+	}
+	return target
+}
+
+func replaceWithHardlink(keep string, target string) error {
+	tmpPath := fmt.Sprintf("%s.youfile-link", target)
+	err := os.Link(keep, tmpPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, target)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// ResolveDuplicate keep one file of group and apply action to the others
+func ResolveDuplicate(group *DuplicateGroup, option ResolveDuplicateOption) ([]*ResolveDuplicateResult, error) {
+	if option.Action != DuplicateActionDelete && option.Action != DuplicateActionHardlink && option.Action != DuplicateActionTrash {
+		return nil, UnknownDuplicateAction
+	}
+	keep, err := group.keepFile(option.Keep, option.KeepPath)
+	if err != nil {
+		return nil, err
+	}
+	keepStat, err := checkDuplicateUnchanged(keep, group.Size)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*ResolveDuplicateResult, 0)
+	for _, file := range group.Files {
+		if file == keep {
+			continue
+		}
+		result := &ResolveDuplicateResult{Path: file.Path}
+		results = append(results, result)
+		var stat os.FileInfo
+		stat, err = checkDuplicateUnchanged(file, group.Size)
+		if err == nil {
+			freed := freedSize(stat)
+			switch option.Action {
+			case DuplicateActionDelete:
+				err = AppFs.Remove(file.Path)
+				if err == nil {
+					AddQuotaUsage(option.Username, file.Path, -freed)
+				}
+			case DuplicateActionHardlink:
+				// linked to kept file since scan, nothing to do
+				if os.SameFile(keepStat, stat) {
+					break
+				}
+				err = replaceWithHardlink(keep.Path, file.Path)
+				if err == nil {
+					AddQuotaUsage(option.Username, file.Path, -freed)
+				}
+			case DuplicateActionTrash:
+				var item *database.TrashItem
+				item, err = MoveToTrash(file.Path, duplicateDisplayPath(file.Path, option.DisplayPath), option.Username)
+				if err == nil {
+					AddQuotaUsage(option.Username, file.Path, -freed)
+					AddQuotaUsage(option.Username, item.Path, freed)
+				}
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	group.Resolved = true
+	return results, nil
+}
@@ -2,4 +2,5 @@ package service
 
 import "github.com/spf13/afero"
 
-var AppFs = afero.NewOsFs()
+// AppFs is filesystem used by service, archive can be browsed as read-only directory
+var AppFs afero.Fs = NewArchiveFs(afero.NewOsFs())
@@ -0,0 +1,760 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"github.com/spf13/afero"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ArchiveFsReadOnly       = errors.New("archive is read only")
+	ArchiveEntryEncrypted   = errors.New("archive entry is encrypted")
+	UnknownArchiveFsFormat  = errors.New("unknown archive format")
+	archiveFsExtensions     = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"}
+	archiveFsCompressedTars = map[string]func(r io.Reader) (io.Reader, error){
+		".tar.gz":  gzipReader,
+		".tgz":     gzipReader,
+		".tar.bz2": bzip2Reader,
+		".tbz2":    bzip2Reader,
+		".tar.xz":  xzReader,
+		".txz":     xzReader,
+	}
+)
+
+const archiveFsCacheSize = 16
+
+func gzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+func bzip2Reader(r io.Reader) (io.Reader, error) {
+	return bzip2.NewReader(r), nil
+}
+func xzReader(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(r)
+}
+
+// archiveFsFormat return archive extension of name, empty if name is not an archive can be browsed
+func archiveFsFormat(name string) string {
+	name = strings.ToLower(name)
+	format := ""
+	for _, ext := range archiveFsExtensions {
+		// .tar.gz should win over .gz like extensions
+		if strings.HasSuffix(name, ext) && len(ext) > len(format) {
+			format = ext
+		}
+	}
+	return format
+}
+
+// ArchiveFs wrap filesystem to browse zip and tar archive as read-only directory,
+// e.g. /data/photos.zip/2020/a.jpg is entry 2020/a.jpg of /data/photos.zip.
+// Index of archive is cached until archive changed.
+type ArchiveFs struct {
+	base  afero.Fs
+	cache map[string]*archiveIndex
+	sync.Mutex
+}
+
+func NewArchiveFs(base afero.Fs) *ArchiveFs {
+	return &ArchiveFs{
+		base:  base,
+		cache: map[string]*archiveIndex{},
+	}
+}
+
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *archiveFileInfo) Name() string       { return i.name }
+func (i *archiveFileInfo) Size() int64        { return i.size }
+func (i *archiveFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *archiveFileInfo) ModTime() time.Time { return i.modTime }
+func (i *archiveFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *archiveFileInfo) Sys() interface{}   { return nil }
+
+type archiveNode struct {
+	info     *archiveFileInfo
+	children []string
+	// offset of content in archive file, -1 if content is compressed
+	offset int64
+	open   func() (io.ReadCloser, error)
+}
+
+type archiveIndex struct {
+	path    string
+	size    int64
+	modTime time.Time
+	// kept open to read entries, closed once index is evicted and no opened entry use it
+	file  afero.File
+	nodes map[string]*archiveNode
+	// opened entries use file
+	refs    int
+	evicted bool
+	lock    sync.Mutex
+}
+
+func (i *archiveIndex) acquire() {
+	i.lock.Lock()
+	i.refs += 1
+	i.lock.Unlock()
+}
+
+func (i *archiveIndex) release() {
+	i.lock.Lock()
+	i.refs -= 1
+	unused := i.evicted && i.refs == 0
+	i.lock.Unlock()
+	if unused {
+		i.file.Close()
+	}
+}
+
+// evict mark index removed from cache, file is closed now if no entry use it
+func (i *archiveIndex) evict() {
+	i.lock.Lock()
+	i.evicted = true
+	unused := i.refs == 0
+	i.lock.Unlock()
+	if unused {
+		i.file.Close()
+	}
+}
+
+func (i *archiveIndex) addNode(name string, node *archiveNode) {
+	if _, exist := i.nodes[name]; exist {
+		// implicit directory created by child before
+		if node.info.IsDir() {
+			i.nodes[name].info = node.info
+			return
+		}
+	}
+	parent := path.Dir(name)
+	if parent == "." {
+		parent = ""
+	}
+	if _, exist := i.nodes[parent]; !exist {
+		i.addNode(parent, &archiveNode{
+			info: &archiveFileInfo{name: path.Base(parent), mode: os.ModeDir | 0755, modTime: i.modTime},
+		})
+	}
+	if _, exist := i.nodes[name]; !exist {
+		i.nodes[parent].children = append(i.nodes[parent].children, path.Base(name))
+	}
+	i.nodes[name] = node
+}
+
+func newArchiveEntryInfo(name string, size int64, mode os.FileMode, modTime time.Time) *archiveFileInfo {
+	perm := mode.Perm()
+	if mode.IsDir() {
+		if perm == 0 {
+			perm = 0755
+		}
+		return &archiveFileInfo{name: path.Base(name), mode: os.ModeDir | perm, modTime: modTime}
+	}
+	if perm == 0 {
+		perm = 0644
+	}
+	return &archiveFileInfo{name: path.Base(name), size: size, mode: perm, modTime: modTime}
+}
+
+func (i *archiveIndex) readZip() error {
+	reader, err := zip.NewReader(i.file, i.size)
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		name := cleanEntryPath(file.Name)
+		if len(name) == 0 {
+			continue
+		}
+		mode := file.Mode()
+		if strings.HasSuffix(file.Name, "/") {
+			mode |= os.ModeDir
+		}
+		node := &archiveNode{
+			info:   newArchiveEntryInfo(name, int64(file.UncompressedSize64), mode, file.Modified),
+			offset: -1,
+		}
+		zipFile := file
+		switch {
+		case zipFile.Flags&0x1 != 0:
+			node.open = func() (io.ReadCloser, error) {
+				return nil, ArchiveEntryEncrypted
+			}
+		case zipFile.Method == zip.Store:
+			node.offset, err = zipFile.DataOffset()
+			if err != nil {
+				return err
+			}
+		default:
+			node.open = zipFile.Open
+		}
+		i.addNode(name, node)
+	}
+	return nil
+}
+
+type countReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (i *archiveIndex) readTar(fs afero.Fs, format string) error {
+	var tarReader *tar.Reader
+	var offset func() int64
+	decompress, compressed := archiveFsCompressedTars[format]
+	if compressed {
+		// offset of compressed tar is position in decompressed stream, entry is read by skip to it
+		decompressed, err := decompress(i.file)
+		if err != nil {
+			return err
+		}
+		counter := &countReader{reader: decompressed}
+		tarReader = tar.NewReader(counter)
+		offset = func() int64 {
+			return counter.count
+		}
+	} else {
+		tarReader = tar.NewReader(i.file)
+		offset = func() int64 {
+			position, _ := i.file.Seek(0, io.SeekCurrent)
+			return position
+		}
+	}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := cleanEntryPath(header.Name)
+		if len(name) == 0 {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA && header.Typeflag != tar.TypeDir {
+			// links and special files are not readable in archive
+			continue
+		}
+		node := &archiveNode{
+			info:   newArchiveEntryInfo(name, header.Size, header.FileInfo().Mode(), header.ModTime),
+			offset: offset(),
+		}
+		if compressed {
+			node.open = compressedTarEntryOpener(fs, i.path, decompress, node.offset, header.Size)
+			node.offset = -1
+		}
+		i.addNode(name, node)
+	}
+	return nil
+}
+
+func compressedTarEntryOpener(fs afero.Fs, archivePath string, decompress func(r io.Reader) (io.Reader, error), offset int64, size int64) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		file, err := fs.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		decompressed, err := decompress(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		_, err = io.CopyN(ioutil.Discard, decompressed, offset)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &archiveStreamReader{Reader: io.LimitReader(decompressed, size), file: file}, nil
+	}
+}
+
+type archiveStreamReader struct {
+	io.Reader
+	file afero.File
+}
+
+func (r *archiveStreamReader) Close() error {
+	return r.file.Close()
+}
+
+func (a *ArchiveFs) buildIndex(archivePath string, info os.FileInfo) (*archiveIndex, error) {
+	file, err := a.base.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	index := &archiveIndex{
+		path:    archivePath,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		file:    file,
+		nodes:   map[string]*archiveNode{},
+	}
+	index.nodes[""] = &archiveNode{
+		info: &archiveFileInfo{name: info.Name(), mode: os.ModeDir | 0755, modTime: info.ModTime()},
+	}
+	format := archiveFsFormat(archivePath)
+	switch format {
+	case ".zip":
+		err = index.readZip()
+	case "":
+		err = UnknownArchiveFsFormat
+	default:
+		err = index.readTar(a.base, format)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	for _, node := range index.nodes {
+		sort.Strings(node.children)
+	}
+	return index, nil
+}
+
+// getIndex return index of archive, release must be called when index is not used
+func (a *ArchiveFs) getIndex(archivePath string) (*archiveIndex, error) {
+	info, err := a.base.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	a.Lock()
+	index, exist := a.cache[archivePath]
+	if exist && index.size == info.Size() && index.modTime.Equal(info.ModTime()) {
+		index.acquire()
+		a.Unlock()
+		return index, nil
+	}
+	a.Unlock()
+	index, err = a.buildIndex(archivePath, info)
+	if err != nil {
+		return nil, err
+	}
+	a.Lock()
+	if outdated, exist := a.cache[archivePath]; exist {
+		delete(a.cache, archivePath)
+		outdated.evict()
+	}
+	if len(a.cache) >= archiveFsCacheSize {
+		for key, evicted := range a.cache {
+			delete(a.cache, key)
+			evicted.evict()
+			break
+		}
+	}
+	a.cache[archivePath] = index
+	index.acquire()
+	a.Unlock()
+	return index, nil
+}
+
+// splitArchivePath return archive file and entry path in it, archive path is empty if name is not inside archive
+func (a *ArchiveFs) splitArchivePath(name string) (string, string) {
+	parts := strings.Split(filepath.Clean(name), string(filepath.Separator))
+	for idx := 0; idx < len(parts)-1; idx++ {
+		if len(archiveFsFormat(parts[idx])) == 0 {
+			continue
+		}
+		candidate := strings.Join(parts[:idx+1], string(filepath.Separator))
+		info, err := a.base.Stat(candidate)
+		if err != nil {
+			return "", ""
+		}
+		if info.Mode().IsRegular() {
+			return candidate, strings.Join(parts[idx+1:], "/")
+		}
+	}
+	return "", ""
+}
+
+func (a *ArchiveFs) readOnlyError(op string, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: ArchiveFsReadOnly}
+}
+
+func (a *ArchiveFs) isInArchive(name string) bool {
+	archivePath, _ := a.splitArchivePath(name)
+	return len(archivePath) > 0
+}
+
+func (a *ArchiveFs) openEntry(name string, archivePath string, entry string) (*archiveFile, error) {
+	index, err := a.getIndex(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	node, exist := index.nodes[entry]
+	if !exist {
+		index.release()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &archiveFile{name: name, entry: entry, index: index, node: node}, nil
+}
+
+func (a *ArchiveFs) Create(name string) (afero.File, error) {
+	if a.isInArchive(name) {
+		return nil, a.readOnlyError("create", name)
+	}
+	return a.base.Create(name)
+}
+
+func (a *ArchiveFs) Mkdir(name string, perm os.FileMode) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("mkdir", name)
+	}
+	return a.base.Mkdir(name, perm)
+}
+
+func (a *ArchiveFs) MkdirAll(name string, perm os.FileMode) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("mkdir", name)
+	}
+	return a.base.MkdirAll(name, perm)
+}
+
+func (a *ArchiveFs) Open(name string) (afero.File, error) {
+	archivePath, entry := a.splitArchivePath(name)
+	if len(archivePath) > 0 {
+		return a.openEntry(name, archivePath, entry)
+	}
+	file, err := a.base.Open(name)
+	if err != nil || len(archiveFsFormat(name)) == 0 {
+		return file, err
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return file, nil
+	}
+	// archive itself can be read as file, or list as directory
+	return &archiveRootFile{File: file, fs: a, name: name}, nil
+}
+
+func (a *ArchiveFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if !a.isInArchive(name) {
+		return a.base.OpenFile(name, flag, perm)
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, a.readOnlyError("open", name)
+	}
+	return a.Open(name)
+}
+
+func (a *ArchiveFs) Remove(name string) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("remove", name)
+	}
+	return a.base.Remove(name)
+}
+
+func (a *ArchiveFs) RemoveAll(name string) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("remove", name)
+	}
+	return a.base.RemoveAll(name)
+}
+
+func (a *ArchiveFs) Rename(oldname, newname string) error {
+	if a.isInArchive(oldname) || a.isInArchive(newname) {
+		return a.readOnlyError("rename", oldname)
+	}
+	return a.base.Rename(oldname, newname)
+}
+
+func (a *ArchiveFs) Stat(name string) (os.FileInfo, error) {
+	archivePath, entry := a.splitArchivePath(name)
+	if len(archivePath) == 0 {
+		return a.base.Stat(name)
+	}
+	file, err := a.openEntry(name, archivePath, entry)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+func (a *ArchiveFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if a.isInArchive(name) {
+		info, err := a.Stat(name)
+		return info, false, err
+	}
+	if lstater, ok := a.base.(afero.Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	info, err := a.base.Stat(name)
+	return info, false, err
+}
+
+func (a *ArchiveFs) Name() string {
+	return "ArchiveFs"
+}
+
+func (a *ArchiveFs) Chmod(name string, mode os.FileMode) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("chmod", name)
+	}
+	return a.base.Chmod(name, mode)
+}
+
+func (a *ArchiveFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if a.isInArchive(name) {
+		return a.readOnlyError("chtimes", name)
+	}
+	return a.base.Chtimes(name, atime, mtime)
+}
+
+// archiveEntryReader read compressed entry by stream, seek backward restart the stream
+type archiveEntryReader struct {
+	open      func() (io.ReadCloser, error)
+	size      int64
+	reader    io.ReadCloser
+	readerPos int64
+	pos       int64
+}
+
+func (r *archiveEntryReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.reader == nil || r.pos < r.readerPos {
+		r.Close()
+		reader, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+		r.readerPos = 0
+	}
+	if r.pos > r.readerPos {
+		skipped, err := io.CopyN(ioutil.Discard, r.reader, r.pos-r.readerPos)
+		r.readerPos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.reader.Read(p)
+	r.readerPos += int64(n)
+	r.pos = r.readerPos
+	return n, err
+}
+
+func (r *archiveEntryReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *archiveEntryReader) ReadAt(p []byte, off int64) (int, error) {
+	_, err := r.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r, p)
+}
+
+func (r *archiveEntryReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
+
+type archiveContentReader interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// archiveFile is entry of archive opened as afero.File
+type archiveFile struct {
+	name      string
+	entry     string
+	index     *archiveIndex
+	node      *archiveNode
+	content   archiveContentReader
+	dirOffset int
+	closed    bool
+}
+
+func (f *archiveFile) getContent() (archiveContentReader, error) {
+	if f.node.info.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.content == nil {
+		if f.node.offset >= 0 {
+			f.content = io.NewSectionReader(f.index.file, f.node.offset, f.node.info.size)
+		} else {
+			f.content = &archiveEntryReader{open: f.node.open, size: f.node.info.size}
+		}
+	}
+	return f.content, nil
+}
+
+func (f *archiveFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer f.index.release()
+	if closer, ok := f.content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	content, err := f.getContent()
+	if err != nil {
+		return 0, err
+	}
+	return content.Read(p)
+}
+
+func (f *archiveFile) ReadAt(p []byte, off int64) (int, error) {
+	content, err := f.getContent()
+	if err != nil {
+		return 0, err
+	}
+	return content.ReadAt(p, off)
+}
+
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	content, err := f.getContent()
+	if err != nil {
+		return 0, err
+	}
+	return content.Seek(offset, whence)
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: ArchiveFsReadOnly}
+}
+
+func (f *archiveFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.Write(p)
+}
+
+func (f *archiveFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *archiveFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: ArchiveFsReadOnly}
+}
+
+func (f *archiveFile) Sync() error {
+	return nil
+}
+
+func (f *archiveFile) Name() string {
+	return f.name
+}
+
+func (f *archiveFile) Stat() (os.FileInfo, error) {
+	return f.node.info, nil
+}
+
+func (f *archiveFile) Readdirnames(count int) ([]string, error) {
+	if !f.node.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	names := f.node.children[f.dirOffset:]
+	if count > 0 {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		if len(names) > count {
+			names = names[:count]
+		}
+	}
+	f.dirOffset += len(names)
+	return names, nil
+}
+
+func (f *archiveFile) Readdir(count int) ([]os.FileInfo, error) {
+	names, err := f.Readdirnames(count)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, f.index.nodes[path.Join(f.entry, name)].info)
+	}
+	return infos, nil
+}
+
+// archiveRootFile is archive file opened from base filesystem, Readdir list entries in root of archive
+type archiveRootFile struct {
+	afero.File
+	fs   *ArchiveFs
+	name string
+	root *archiveFile
+}
+
+func (f *archiveRootFile) getRoot() (*archiveFile, error) {
+	if f.root == nil {
+		index, err := f.fs.getIndex(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.root = &archiveFile{name: f.name, index: index, node: index.nodes[""]}
+	}
+	return f.root, nil
+}
+
+func (f *archiveRootFile) Close() error {
+	if f.root != nil {
+		f.root.Close()
+	}
+	return f.File.Close()
+}
+
+func (f *archiveRootFile) Readdir(count int) ([]os.FileInfo, error) {
+	root, err := f.getRoot()
+	if err != nil {
+		return nil, err
+	}
+	return root.Readdir(count)
+}
+
+func (f *archiveRootFile) Readdirnames(count int) ([]string, error) {
+	root, err := f.getRoot()
+	if err != nil {
+		return nil, err
+	}
+	return root.Readdirnames(count)
+}
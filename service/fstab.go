@@ -1,18 +1,42 @@
 package service
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/d-tux/go-fstab"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"youfile/config"
 )
 
 var DefaultFstab Fstab = Fstab{}
 
+var fstabLogger = logrus.WithField("scope", "fstab")
+
+// fstabLock serialize write and reload of fstab
+var fstabLock sync.Mutex
+
+// fstabMountsLock guard entries of fstab, they are read by background workers while handlers change them
+var fstabMountsLock sync.RWMutex
+
+var (
+	FstabInvalid      = errors.New("fstab is invalid")
+	FstabDryRunFailed = errors.New("fake mount of fstab failed")
+	FstabRolledBack   = errors.New("reload of fstab failed, fstab is rolled back")
+)
+
 type Fstab struct {
 	Mounts fstab.Mounts
+	// backup of fstab before last save, restored if reload failed
+	lastBackup string
+	// mount points of entries added or changed by last save, only they are mounted by reload
+	changed []string
 }
 
 func LoadFstab() error {
@@ -20,10 +44,42 @@ func LoadFstab() error {
 	if err != nil {
 		return err
 	}
+	fstabMountsLock.Lock()
 	DefaultFstab.Mounts = mounts
+	fstabMountsLock.Unlock()
 	return nil
 }
 
+// entries return copy of fstab entries, so it can be read while entries are changed
+func (f *Fstab) entries() fstab.Mounts {
+	fstabMountsLock.RLock()
+	defer fstabMountsLock.RUnlock()
+	mounts := make(fstab.Mounts, 0, len(f.Mounts))
+	for _, mount := range f.Mounts {
+		entry := *mount
+		entry.MntOps = map[string]string{}
+		for key, value := range mount.MntOps {
+			entry.MntOps[key] = value
+		}
+		mounts = append(mounts, &entry)
+	}
+	return mounts
+}
+
+// GetManagedMounts return fstab entries of mount points managed by YouFile
+func GetManagedMounts() fstab.Mounts {
+	mounts := fstab.Mounts{}
+	for _, mount := range DefaultFstab.entries() {
+		for _, point := range config.Instance.MountPoints {
+			if point == mount.File {
+				mounts = append(mounts, mount)
+				break
+			}
+		}
+	}
+	return mounts
+}
+
 type AddMountOption struct {
 	Spec    string            `json:"spec"`
 	File    string            `json:"file"`
@@ -33,22 +89,89 @@ type AddMountOption struct {
 	PassNo  int               `json:"pass_no"`
 }
 
-func (f *Fstab) AddMount(option *AddMountOption) {
+// AddMount add mount to fstab, password in options of cifs is moved to credentials file
+func (f *Fstab) AddMount(option *AddMountOption) error {
 	for _, mount := range f.Mounts {
 		if mount.File == option.File {
-			return
+			return nil
+		}
+	}
+	mntOps := map[string]string{}
+	for key, value := range option.MntOps {
+		mntOps[key] = value
+	}
+	if option.VfsType == "cifs" {
+		err := secureCIFSMntOps(option.File, mntOps)
+		if err != nil {
+			return err
 		}
 	}
+	fstabMountsLock.Lock()
+	defer fstabMountsLock.Unlock()
 	f.Mounts = append(f.Mounts, &fstab.Mount{
 		Spec:    option.Spec,
 		File:    option.File,
 		VfsType: option.VfsType,
-		MntOps:  option.MntOps,
+		MntOps:  mntOps,
 		Freq:    option.Freq,
 		PassNo:  option.PassNo,
 	})
+	return nil
+}
+
+// AddProviderMount validate option then add it as mount of provider
+func (f *Fstab) AddProviderMount(provider MountProvider, option MountOption) error {
+	err := option.Validate()
+	if err != nil {
+		return err
+	}
+	for _, mount := range f.Mounts {
+		if mount.File == option.GetMountPath() {
+			return MountPathExist
+		}
+	}
+	_, err = prepareMountOption(option, false)
+	if err != nil {
+		return err
+	}
+	return f.AddMount(&AddMountOption{
+		Spec:    option.Spec(),
+		File:    option.GetMountPath(),
+		VfsType: provider.VfsType(),
+		MntOps:  option.MntOps(),
+	})
+}
+
+// credentialUsage return mount paths of entries use credentials file
+func (f *Fstab) credentialUsage(path string) []string {
+	files := make([]string, 0)
+	for _, mount := range f.Mounts {
+		if mount.MntOps["credentials"] == path {
+			files = append(files, mount.File)
+		}
+	}
+	return files
+}
+
+// replaceCredentialPath point entries use credentials file to new file then save fstab
+func (f *Fstab) replaceCredentialPath(oldPath string, newPath string) error {
+	if len(f.credentialUsage(oldPath)) == 0 {
+		return nil
+	}
+	fstabMountsLock.Lock()
+	for _, mount := range f.Mounts {
+		if mount.MntOps["credentials"] == oldPath {
+			mount.MntOps["credentials"] = newPath
+		}
+	}
+	fstabMountsLock.Unlock()
+	return f.Save()
 }
+
+// RemoveMount remove entry from fstab, mount point is detached by DetachMount after fstab is saved
 func (f *Fstab) RemoveMount(file string) error {
+	fstabMountsLock.Lock()
+	defer fstabMountsLock.Unlock()
 	index := -1
 	for mindex, mount := range f.Mounts {
 		if mount.File == file {
@@ -58,36 +181,383 @@ func (f *Fstab) RemoveMount(file string) error {
 	if index != -1 {
 		f.Mounts[index] = f.Mounts[len(f.Mounts)-1]
 		f.Mounts = f.Mounts[:len(f.Mounts)-1]
-		err := UmountFS(file, "-l")
-		if err != nil {
-			return err
-		}
 	}
 	return nil
 }
+
+// formatMount serialize mount to line of fstab, options are sorted so same entry give same line
+func formatMount(mount *fstab.Mount) string {
+	mntOps := mntOpsString(mount.MntOps)
+	if len(mntOps) == 0 {
+		mntOps = "defaults"
+	}
+	return fmt.Sprintf("%s %s %s %s %d %d", mount.Spec, mount.File, mount.VfsType, mntOps, mount.Freq, mount.PassNo)
+}
+
+func (f *Fstab) content() []byte {
+	var buf bytes.Buffer
+	for _, mount := range f.Mounts {
+		buf.WriteString(formatMount(mount))
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// writeFstabFile replace file by content through temp file in same directory, so fstab is never half written
+func writeFstabFile(path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), ".fstab")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(file.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// DryRun validate entries then run fake mount of all entries, nothing is written or mounted
+func (f *Fstab) DryRun() error {
+	err := f.Validate()
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile("", "fstab")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(f.content())
+	file.Close()
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("mount", "--fake", "--fstab", file.Name(), "-a").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", FstabDryRunFailed, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// changedMountPoints return mount points of entries in mounts which are not in previous or differ from it
+func changedMountPoints(previous fstab.Mounts, mounts fstab.Mounts) []string {
+	lines := map[string]string{}
+	for _, mount := range previous {
+		lines[filepath.Clean(mount.File)] = formatMount(mount)
+	}
+	changed := make([]string, 0)
+	for _, mount := range mounts {
+		if line, exist := lines[filepath.Clean(mount.File)]; !exist || line != formatMount(mount) {
+			changed = append(changed, mount.File)
+		}
+	}
+	return changed
+}
+
+// Save check entries by dry run, backup current fstab then replace it atomically.
+// Nothing is written or backed up when fstab file is same as entries
 func (f *Fstab) Save() error {
-	file, err := os.Create(config.Instance.FstabPath)
+	fstabLock.Lock()
+	defer fstabLock.Unlock()
+	err := f.DryRun()
+	if err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(config.Instance.FstabPath)
+	if err == nil && bytes.Equal(current, f.content()) {
+		return nil
+	}
+	previous, err := fstab.ParseFile(config.Instance.FstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	backup, err := backupFstab()
+	if err != nil {
+		return err
+	}
+	err = writeFstabFile(config.Instance.FstabPath, f.content())
+	if err != nil {
+		return err
+	}
+	f.lastBackup = backup
+	f.changed = changedMountPoints(previous, f.Mounts)
+	return nil
+}
+
+// isReloadSkipped return true if entry is not mounted by reload, same as entries skipped by mount -a
+func isReloadSkipped(mount *fstab.Mount) bool {
+	_, noAuto := mount.MntOps["noauto"]
+	return noAuto || mount.VfsType == "swap" || mount.File == "none"
+}
+
+// mountFstabEntry mount entry of fstab file, entry already mounted is remounted to apply its options
+func mountFstabEntry(file string, mounted bool) error {
+	args := []string{"--fstab", config.Instance.FstabPath}
+	if mounted {
+		args = append(args, "-o", "remount")
+	}
+	out, err := exec.Command("mount", append(args, file)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", file, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Reload mount entries added or changed by last save, fstab is rolled back to backup made by last save
+// if any of them failed, and entries newly mounted by reload are unmounted
+func (f *Fstab) Reload() error {
+	fstabLock.Lock()
+	defer fstabLock.Unlock()
+	changed := f.changed
+	f.changed = nil
+	mountInfo, err := ReadMountInfo()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	w := bufio.NewWriter(file)
+	newlyMounted := make([]string, 0)
+	remounted := make([]string, 0)
+	problems := make([]string, 0)
 	for _, mount := range f.Mounts {
-		_, err = fmt.Fprintln(w, fmt.Sprintf(mount.String()))
+		isChanged := false
+		for _, file := range changed {
+			if file == mount.File {
+				isChanged = true
+				break
+			}
+		}
+		if !isChanged || isReloadSkipped(mount) {
+			continue
+		}
+		_, mounted := mountInfo[filepath.Clean(mount.File)]
+		err = mountFstabEntry(mount.File, mounted)
 		if err != nil {
-			return err
+			problems = append(problems, err.Error())
+			continue
+		}
+		if mounted {
+			remounted = append(remounted, mount.File)
+		} else {
+			newlyMounted = append(newlyMounted, mount.File)
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Println("fstab is reloaded")
+		f.lastBackup = ""
+		return nil
+	}
+	reloadErr := errors.New(strings.Join(problems, "; "))
+	if len(f.lastBackup) == 0 {
+		return reloadErr
+	}
+	rollbackErr := f.rollback(newlyMounted, remounted)
+	if rollbackErr != nil {
+		return fmt.Errorf("%v, rollback failed: %v", reloadErr, rollbackErr)
+	}
+	return fmt.Errorf("%w: %v", FstabRolledBack, reloadErr)
+}
+
+// MountAll mount every entry which is not mounted like mount -a, e.g. to bring back dropped mounts.
+// Fstab is not changed so nothing is rolled back, failed entries are reported together
+func (f *Fstab) MountAll() error {
+	return f.mountUnmounted(func(mount *fstab.Mount) bool {
+		return true
+	})
+}
+
+// mountUnmounted mount entries accepted by filter which are not mounted, entries skipped by mount -a are not mounted
+func (f *Fstab) mountUnmounted(filter func(mount *fstab.Mount) bool) error {
+	fstabLock.Lock()
+	defer fstabLock.Unlock()
+	mountInfo, err := ReadMountInfo()
+	if err != nil {
+		return err
+	}
+	problems := make([]string, 0)
+	for _, mount := range f.entries() {
+		if isReloadSkipped(mount) || !filter(mount) {
+			continue
+		}
+		if _, mounted := mountInfo[filepath.Clean(mount.File)]; mounted {
+			continue
+		}
+		err = mountFstabEntry(mount.File, false)
+		if err != nil {
+			problems = append(problems, err.Error())
 		}
 	}
-	return w.Flush()
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
 }
 
-func (f *Fstab) Reload() error {
-	out, err := exec.Command("mount", "--fstab", config.Instance.FstabPath, "-a").Output()
+// rollback restore fstab from backup made by last save, unmount entries newly mounted by reload and
+// remount entries remounted by reload with restored options. Must be called with lock held
+func (f *Fstab) rollback(newlyMounted []string, remounted []string) error {
+	backup := f.lastBackup
+	f.lastBackup = ""
+	content, err := ioutil.ReadFile(backup)
 	if err != nil {
 		return err
 	}
-	fmt.Println("fstab is reloaded")
-	output := string(out[:])
-	fmt.Println(output)
+	err = writeFstabFile(config.Instance.FstabPath, content)
+	if err != nil {
+		return err
+	}
+	mounts, err := fstab.ParseFile(config.Instance.FstabPath)
+	if err != nil {
+		return err
+	}
+	fstabMountsLock.Lock()
+	f.Mounts = mounts
+	fstabMountsLock.Unlock()
+	fstabLogger.WithField("backup", backup).Warn("fstab is rolled back")
+	problems := make([]string, 0)
+	for _, file := range newlyMounted {
+		err = UmountFS(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+		}
+	}
+	for _, mount := range f.Mounts {
+		for _, file := range remounted {
+			if file == mount.File {
+				err = mountFstabEntry(mount.File, true)
+				if err != nil {
+					problems = append(problems, err.Error())
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// vfs types which are not filesystem of kernel or mount helper
+var specialVfsTypes = []string{"auto", "swap", "none", "ignore"}
+
+// mount helpers are searched in these directories
+var mountHelperDirs = []string{"/sbin", "/usr/sbin", "/bin", "/usr/bin"}
+
+// readKernelFilesystems return filesystems supported by kernel, nil if it can not be read
+func readKernelFilesystems() map[string]bool {
+	content, err := ioutil.ReadFile("/proc/filesystems")
+	if err != nil {
+		return nil
+	}
+	filesystems := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			filesystems[fields[len(fields)-1]] = true
+		}
+	}
+	return filesystems
+}
+
+func hasMountHelper(vfsType string) bool {
+	for _, dir := range mountHelperDirs {
+		if _, err := os.Stat(filepath.Join(dir, "mount."+vfsType)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isVfsTypeSupported check filesystem is supported by kernel or has mount helper, fuse filesystems need fuse helper
+func isVfsTypeSupported(vfsType string, kernelFilesystems map[string]bool) bool {
+	for _, specialVfsType := range specialVfsTypes {
+		if vfsType == specialVfsType {
+			return true
+		}
+	}
+	if kernelFilesystems == nil {
+		return true
+	}
+	// comma separated types are tried in order
+	for _, item := range strings.Split(vfsType, ",") {
+		if kernelFilesystems[item] || hasMountHelper(item) {
+			continue
+		}
+		if strings.HasPrefix(item, "fuse.") && (hasMountHelper("fuse") || hasMountHelper("fuse3")) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Validate check fields, mount point and vfs type of each entry, and that no mount point is used twice
+func (f *Fstab) Validate() error {
+	problems := make([]string, 0)
+	kernelFilesystems := readKernelFilesystems()
+	// mounted point exists, and stat on stale network mount may hang
+	mountInfo, err := ReadMountInfo()
+	if err != nil {
+		return err
+	}
+	files := map[string]bool{}
+	for _, mount := range f.Mounts {
+		if err := validateMountField("spec", mount.Spec); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", mount.File, err))
+		}
+		if err := validateMountField("mount point", mount.File); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", mount.Spec, err))
+			continue
+		}
+		if err := validateMountField("vfs type", mount.VfsType); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", mount.File, err))
+		} else if !isVfsTypeSupported(mount.VfsType, kernelFilesystems) {
+			problems = append(problems, fmt.Sprintf("%s: vfs type %s is not supported", mount.File, mount.VfsType))
+		}
+		for key, value := range mount.MntOps {
+			if strings.ContainsAny(key+value, " \t\r\n") {
+				problems = append(problems, fmt.Sprintf("%s: option %s must not contain space", mount.File, key))
+			}
+		}
+		if mount.VfsType == "swap" || mount.File == "none" {
+			continue
+		}
+		if !filepath.IsAbs(mount.File) {
+			problems = append(problems, fmt.Sprintf("%s: mount point must be absolute", mount.File))
+			continue
+		}
+		file := filepath.Clean(mount.File)
+		if files[file] {
+			problems = append(problems, fmt.Sprintf("%s: mount point is duplicated", mount.File))
+		}
+		files[file] = true
+		if _, noAuto := mount.MntOps["noauto"]; noAuto {
+			continue
+		}
+		if _, mounted := mountInfo[file]; mounted {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s: mount point is not an existing directory", mount.File))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", FstabInvalid, strings.Join(problems, "; "))
+	}
 	return nil
 }
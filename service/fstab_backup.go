@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"github.com/d-tux/go-fstab"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+	"youfile/config"
+)
+
+var FstabBackupNotFound = errors.New("fstab backup not found")
+
+const fstabBackupTimeFormat = "20060102-150405.000000"
+
+var fstabBackupPattern = regexp.MustCompile(`^fstab-\d{8}-\d{6}\.\d{6}$`)
+
+type FstabBackup struct {
+	Name string
+	Time time.Time
+	Size int64
+}
+
+func fstabBackupDir() string {
+	return config.Instance.FstabBackupPath
+}
+
+// GetFstabBackups return backups of fstab, newest first
+func GetFstabBackups() ([]*FstabBackup, error) {
+	items, err := ioutil.ReadDir(fstabBackupDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*FstabBackup{}, nil
+		}
+		return nil, err
+	}
+	backups := make([]*FstabBackup, 0)
+	for _, item := range items {
+		if item.IsDir() || !fstabBackupPattern.MatchString(item.Name()) {
+			continue
+		}
+		backupTime, err := time.ParseInLocation(fstabBackupTimeFormat, item.Name()[len("fstab-"):], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, &FstabBackup{Name: item.Name(), Time: backupTime, Size: item.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// backupFstab copy current fstab to backup directory and remove backups over limit,
+// return path of backup, empty if fstab not exist
+func backupFstab() (string, error) {
+	content, err := ioutil.ReadFile(config.Instance.FstabPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	err = os.MkdirAll(fstabBackupDir(), 0700)
+	if err != nil {
+		return "", err
+	}
+	backupPath := filepath.Join(fstabBackupDir(), "fstab-"+time.Now().Format(fstabBackupTimeFormat))
+	err = ioutil.WriteFile(backupPath, content, 0600)
+	if err != nil {
+		return "", err
+	}
+	keep := config.Instance.FstabKeepBackup
+	if keep <= 0 {
+		return backupPath, nil
+	}
+	backups, err := GetFstabBackups()
+	if err != nil {
+		return "", err
+	}
+	for idx := keep; idx < len(backups); idx++ {
+		err = os.Remove(filepath.Join(fstabBackupDir(), backups[idx].Name))
+		if err != nil {
+			fstabLogger.Error(err)
+		}
+	}
+	return backupPath, nil
+}
+
+// RestoreFstabBackup replace fstab by backup after dry run of it, current fstab is backed up first.
+// Reload should be called after, it rolls back to current fstab if failed
+func RestoreFstabBackup(name string) error {
+	if !fstabBackupPattern.MatchString(name) {
+		return FstabBackupNotFound
+	}
+	backupPath := filepath.Join(fstabBackupDir(), name)
+	mounts, err := fstab.ParseFile(backupPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return FstabBackupNotFound
+		}
+		return err
+	}
+	restored := &Fstab{Mounts: mounts}
+	err = restored.Save()
+	if err != nil {
+		return err
+	}
+	fstabMountsLock.Lock()
+	DefaultFstab.Mounts = restored.Mounts
+	fstabMountsLock.Unlock()
+	DefaultFstab.lastBackup = restored.lastBackup
+	DefaultFstab.changed = restored.changed
+	return nil
+}
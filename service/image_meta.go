@@ -0,0 +1,387 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+	"html"
+	"image"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"youfile/database"
+	"youfile/util"
+)
+
+var ImageMetaExtensions = []string{".jpg", ".jpeg", ".tif", ".tiff", ".png", ".heic", ".heif"}
+
+// metadata of jpeg, png and heic is near the head of file
+const imageMetaHeadBytes = 4 * 1024 * 1024
+
+var (
+	xmpPacketPattern      = regexp.MustCompile(`(?s)<x:xmpmeta.*?</x:xmpmeta>`)
+	xmpTitlePattern       = regexp.MustCompile(`(?s)<dc:title>\s*<rdf:Alt>\s*<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpDescriptionPattern = regexp.MustCompile(`(?s)<dc:description>\s*<rdf:Alt>\s*<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpSubjectPattern     = regexp.MustCompile(`(?s)<dc:subject>\s*<rdf:Bag>(.*?)</rdf:Bag>`)
+	xmpListItemPattern    = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+)
+
+// IPTC datasets of application record
+const (
+	iptcObjectName = 5
+	iptcKeywords   = 25
+	iptcCaption    = 120
+)
+
+func IsImageMetaSupported(path string) bool {
+	return linq.From(ImageMetaExtensions).Contains(strings.ToLower(filepath.Ext(path)))
+}
+
+// ImageMetaFilter match images by capture date and camera, zero value match all images
+type ImageMetaFilter struct {
+	CaptureFrom *time.Time
+	CaptureTo   *time.Time
+	// part of camera make or model, case insensitive
+	Camera string
+}
+
+func (f *ImageMetaFilter) IsEmpty() bool {
+	return f.CaptureFrom == nil && f.CaptureTo == nil && len(f.Camera) == 0
+}
+
+func (f *ImageMetaFilter) Match(path string) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	if !IsImageMetaSupported(path) {
+		return false
+	}
+	meta, err := GetImageMeta(path)
+	if err != nil {
+		return false
+	}
+	if f.CaptureFrom != nil || f.CaptureTo != nil {
+		if meta.CaptureAt == nil {
+			return false
+		}
+		if f.CaptureFrom != nil && meta.CaptureAt.Before(*f.CaptureFrom) {
+			return false
+		}
+		if f.CaptureTo != nil && !meta.CaptureAt.Before(*f.CaptureTo) {
+			return false
+		}
+	}
+	if len(f.Camera) > 0 {
+		camera := strings.ToLower(meta.CameraMake + " " + meta.CameraModel)
+		if !strings.Contains(camera, strings.ToLower(f.Camera)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isImageMetaValid(meta *database.ImageMeta, info os.FileInfo) bool {
+	return meta.Size == info.Size() &&
+		meta.ModTime.Equal(info.ModTime()) &&
+		meta.Inode == util.FileInode(info)
+}
+
+// GetImageMeta return metadata of image, metadata is read from file only when not cached or file changed
+func GetImageMeta(path string) (*database.ImageMeta, error) {
+	info, err := AppFs.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var cached []database.ImageMeta
+	err = database.Instance.Where("path = ?", path).Order("id").Find(&cached).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(cached) > 0 && isImageMetaValid(&cached[len(cached)-1], info) {
+		return &cached[len(cached)-1], nil
+	}
+	meta, err := extractImageMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	meta.Path = path
+	meta.Size = info.Size()
+	meta.ModTime = info.ModTime()
+	meta.Inode = util.FileInode(info)
+	err = database.Instance.Create(meta).Error
+	if err != nil {
+		return nil, err
+	}
+	for idx := range cached {
+		err = database.Instance.Unscoped().Delete(&cached[idx]).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+func extractImageMeta(path string) (*database.ImageMeta, error) {
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head, err := ioutil.ReadAll(io.LimitReader(file, imageMetaHeadBytes))
+	if err != nil {
+		return nil, err
+	}
+	meta := &database.ImageMeta{}
+	if imageConfig, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		meta.Width = imageConfig.Width
+		meta.Height = imageConfig.Height
+	}
+	var x *exif.Exif
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		x, _ = exif.Decode(bytes.NewReader(head))
+		readIptc(meta, head)
+	case ".tif", ".tiff":
+		// exif of tiff can be anywhere in file
+		if _, err = file.Seek(0, io.SeekStart); err == nil {
+			x, _ = exif.Decode(file)
+		}
+	case ".png":
+		if chunk := findPngChunk(head, "eXIf"); chunk != nil {
+			x, _ = exif.Decode(bytes.NewReader(chunk))
+		}
+	case ".heic", ".heif":
+		// exif item of heic start with offset to tiff header then "Exif\0\0"
+		if idx := bytes.Index(head, []byte("Exif\x00\x00")); idx >= 0 {
+			x, _ = exif.Decode(bytes.NewReader(head[idx:]))
+		}
+	}
+	if x != nil {
+		readExif(meta, x)
+	}
+	if packet := xmpPacketPattern.Find(head); packet != nil {
+		readXmp(meta, packet)
+	}
+	return meta, nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// exifRat return numerator and denominator of rational tag, denominator is 0 if tag not exist or invalid
+func exifRat(x *exif.Exif, name exif.FieldName) (int64, int64) {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.RatVal {
+		return 0, 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil {
+		return 0, 0
+	}
+	return num, den
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	num, den := exifRat(x, name)
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+func readExif(meta *database.ImageMeta, x *exif.Exif) {
+	// parser panics on rational with zero denominator, keep fields read before it
+	defer func() {
+		recover()
+	}()
+	meta.CameraMake = exifString(x, exif.Make)
+	meta.CameraModel = exifString(x, exif.Model)
+	meta.LensModel = exifString(x, exif.LensModel)
+	meta.Orientation = exifInt(x, exif.Orientation)
+	meta.ISO = exifInt(x, exif.ISOSpeedRatings)
+	meta.FNumber = exifFloat(x, exif.FNumber)
+	meta.FocalLength = exifFloat(x, exif.FocalLength)
+	if num, den := exifRat(x, exif.ExposureTime); den != 0 {
+		meta.ExposureTime = big.NewRat(num, den).RatString()
+	}
+	if captureAt, err := x.DateTime(); err == nil {
+		meta.CaptureAt = &captureAt
+	}
+	if lat, long, err := x.LatLong(); err == nil {
+		meta.Latitude = &lat
+		meta.Longitude = &long
+	}
+	// dimension of heic can not be read from container
+	if meta.Width == 0 || meta.Height == 0 {
+		meta.Width = exifInt(x, exif.PixelXDimension)
+		meta.Height = exifInt(x, exif.PixelYDimension)
+	}
+}
+
+func readXmp(meta *database.ImageMeta, packet []byte) {
+	if match := xmpTitlePattern.FindSubmatch(packet); match != nil {
+		meta.Title = html.UnescapeString(string(match[1]))
+	}
+	if match := xmpDescriptionPattern.FindSubmatch(packet); match != nil {
+		meta.Description = html.UnescapeString(string(match[1]))
+	}
+	if match := xmpSubjectPattern.FindSubmatch(packet); match != nil {
+		keywords := make([]string, 0)
+		for _, item := range xmpListItemPattern.FindAllSubmatch(match[1], -1) {
+			keywords = append(keywords, html.UnescapeString(string(item[1])))
+		}
+		meta.Keywords = mergeImageKeywords(meta.Keywords, keywords)
+	}
+}
+
+func mergeImageKeywords(current string, keywords []string) string {
+	result := make([]string, 0)
+	if len(current) > 0 {
+		result = strings.Split(current, ",")
+	}
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		if len(keyword) > 0 && !linq.From(result).Contains(keyword) {
+			result = append(result, keyword)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// findPngChunk return data of first chunk with type in png
+func findPngChunk(content []byte, chunkType string) []byte {
+	offset := 8
+	for offset+8 <= len(content) {
+		length := int(binary.BigEndian.Uint32(content[offset : offset+4]))
+		name := string(content[offset+4 : offset+8])
+		start := offset + 8
+		if length < 0 || start+length > len(content) {
+			return nil
+		}
+		if name == chunkType {
+			return content[start : start+length]
+		}
+		if name == "IDAT" || name == "IEND" {
+			// exif must be placed before image data
+			return nil
+		}
+		// skip data and crc
+		offset = start + length + 4
+	}
+	return nil
+}
+
+// readIptc read IPTC IIM from photoshop resource block in APP13 segment of jpeg
+func readIptc(meta *database.ImageMeta, content []byte) {
+	offset := 2
+	for offset+4 <= len(content) && content[offset] == 0xff {
+		marker := content[offset+1]
+		// image data start from SOS
+		if marker == 0xda {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(content[offset+2 : offset+4]))
+		start := offset + 4
+		end := offset + 2 + length
+		if length < 2 || end > len(content) {
+			return
+		}
+		segment := content[start:end]
+		if marker == 0xed && bytes.HasPrefix(segment, []byte("Photoshop 3.0\x00")) {
+			if data := findPhotoshopResource(segment[len("Photoshop 3.0\x00"):], 0x0404); data != nil {
+				readIptcRecords(meta, data)
+			}
+			return
+		}
+		offset = end
+	}
+}
+
+func findPhotoshopResource(content []byte, id uint16) []byte {
+	offset := 0
+	for offset+7 <= len(content) && string(content[offset:offset+4]) == "8BIM" {
+		resourceId := binary.BigEndian.Uint16(content[offset+4 : offset+6])
+		// pascal string of name, padded to even size
+		nameLength := int(content[offset+6]) + 1
+		if nameLength%2 != 0 {
+			nameLength += 1
+		}
+		sizeOffset := offset + 6 + nameLength
+		if sizeOffset+4 > len(content) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(content[sizeOffset : sizeOffset+4]))
+		start := sizeOffset + 4
+		if size < 0 || start+size > len(content) {
+			return nil
+		}
+		if resourceId == id {
+			return content[start : start+size]
+		}
+		offset = start + size
+		if size%2 != 0 {
+			offset += 1
+		}
+	}
+	return nil
+}
+
+func readIptcRecords(meta *database.ImageMeta, content []byte) {
+	keywords := make([]string, 0)
+	offset := 0
+	for offset+5 <= len(content) && content[offset] == 0x1c {
+		record := content[offset+1]
+		dataset := content[offset+2]
+		size := int(binary.BigEndian.Uint16(content[offset+3 : offset+5]))
+		start := offset + 5
+		// extended dataset is not used by text fields
+		if size&0x8000 != 0 || start+size > len(content) {
+			break
+		}
+		value := strings.ToValidUTF8(string(content[start:start+size]), "")
+		if record == 2 {
+			switch dataset {
+			case iptcObjectName:
+				if len(meta.Title) == 0 {
+					meta.Title = value
+				}
+			case iptcCaption:
+				if len(meta.Description) == 0 {
+					meta.Description = value
+				}
+			case iptcKeywords:
+				keywords = append(keywords, value)
+			}
+		}
+		offset = start + size
+	}
+	meta.Keywords = mergeImageKeywords(meta.Keywords, keywords)
+}
@@ -3,29 +3,30 @@ package service
 import (
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"youfile/config"
 )
 
-type MountCIFSOption struct {
-	MountPath  string `json:"mount_path"`
-	RemotePath string `json:"remote_path"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
-}
-
-func MountCIFS(option MountCIFSOption) error {
-	parts := make([]string, 0)
-	parts = append(parts, "-t", "cifs")
-	if len(option.Username) > 0 && len(option.Password) > 0 {
-		parts = append(parts, "-o", fmt.Sprintf("username=%s,password=%s,dir_mode=0777,file_mode=0777", option.Username, option.Password))
-	}
-	parts = append(parts, option.RemotePath, option.MountPath)
-	out, err := exec.Command("mount", parts...).Output()
+// Mount mount filesystem of provider now, it is not written to fstab
+func Mount(provider MountProvider, option MountOption) error {
+	err := option.Validate()
 	if err != nil {
 		return err
 	}
-	fmt.Println(fmt.Sprintf("mount %s : %s", option.RemotePath, option.MountPath))
-	output := string(out[:])
-	fmt.Println(output)
+	// mount.cifs only read credentials file when mounting
+	cleanup, err := prepareMountOption(option, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	out, err := exec.Command(
+		"mount", "-t", provider.VfsType(), "-o", mntOpsString(option.MntOps()), option.Spec(), option.GetMountPath(),
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Println(fmt.Sprintf("mount %s : %s", option.Spec(), option.GetMountPath()))
 	return nil
 }
 
@@ -42,3 +43,32 @@ func UmountFS(dir string, extra ...string) error {
 	fmt.Println(output)
 	return nil
 }
+
+// DetachMount lazily unmount mount point removed from fstab and forget its status, called after fstab is saved
+func DetachMount(file string) error {
+	DefaultMountMonitor.Forget(file)
+	mountInfo, err := ReadMountInfo()
+	if err != nil {
+		return err
+	}
+	if _, mounted := mountInfo[filepath.Clean(file)]; !mounted {
+		return nil
+	}
+	return UmountFS(file, "-l")
+}
+
+// RemountFS mount fstab entry again, stale mount is detached first
+func RemountFS(file string, mounted bool) error {
+	if mounted {
+		err := UmountFS(file, "-l")
+		if err != nil {
+			return err
+		}
+	}
+	out, err := exec.Command("mount", "--fstab", config.Instance.FstabPath, file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Println(fmt.Sprintf("remount %s", file))
+	return nil
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/d-tux/go-fstab"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+var (
+	MountCredentialNotFound = errors.New("mount credential not found")
+	MountCredentialInUse    = errors.New("mount credential is used by fstab")
+	MasterKeyNotSet         = errors.New("master key is not set")
+)
+
+var mountCredentialLogger = logrus.WithField("scope", "mount_credential")
+
+var credentialNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+type SaveMountCredentialOption struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Domain   string `json:"domain"`
+	// mount path of credential created from mount options
+	mountPath string
+}
+
+func (o *SaveMountCredentialOption) Validate() error {
+	if !credentialNamePattern.MatchString(o.Name) {
+		return errors.New("name must only contain letters, digits, dot, dash and underscore")
+	}
+	if len(o.Username) == 0 {
+		return errors.New("username is required")
+	}
+	for name, value := range map[string]string{"username": o.Username, "password": o.Password, "domain": o.Domain} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s must not contain line break", name)
+		}
+	}
+	return nil
+}
+
+// credentialNameOfMountPath return name of credential created for mount, e.g. mnt_nas for /mnt/nas
+func credentialNameOfMountPath(mountPath string) string {
+	name := strings.Trim(filepath.ToSlash(filepath.Clean(mountPath)), "/")
+	name = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`).ReplaceAllString(name, "_")
+	if len(name) == 0 {
+		return "root"
+	}
+	return name
+}
+
+// uniqueCredentialName return name not used by any credential, number is appended if name is used
+func uniqueCredentialName(name string) (string, error) {
+	result := name
+	for idx := 2; ; idx++ {
+		_, err := GetMountCredential(result)
+		if err == MountCredentialNotFound {
+			return result, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		result = fmt.Sprintf("%s_%d", name, idx)
+	}
+}
+
+// credentialFilePath return credentials file of name, file of encrypted credential is decrypted to runtime directory
+func credentialFilePath(name string, encrypted bool) (string, error) {
+	dir := config.Instance.Mount.CredentialPath
+	if encrypted {
+		dir = config.Instance.Mount.RuntimeCredentialPath
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".cred"), nil
+}
+
+// writeCredentialFile write credentials file readable by owner only
+func writeCredentialFile(path string, username string, password string, domain string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	content := fmt.Sprintf("username=%s\npassword=%s\n", username, password)
+	if len(domain) > 0 {
+		content += fmt.Sprintf("domain=%s\n", domain)
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), ".credential")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	// temp file is created with mode 0600
+	_, err = file.WriteString(content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// writeTemporaryCredentialFile write credentials file used by one mount, it must be removed after mount
+func writeTemporaryCredentialFile(username string, password string, domain string) (string, error) {
+	dir, err := filepath.Abs(config.Instance.Mount.RuntimeCredentialPath)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	file, err := ioutil.TempFile(dir, ".mount")
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	err = writeCredentialFile(file.Name(), username, password, domain)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func GetMountCredential(name string) (*database.MountCredential, error) {
+	var credential database.MountCredential
+	err := database.Instance.Where("name = ?", name).Find(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	if credential.ID == 0 {
+		return nil, MountCredentialNotFound
+	}
+	return &credential, nil
+}
+
+func GetMountCredentials() ([]database.MountCredential, error) {
+	var credentials []database.MountCredential
+	err := database.Instance.Order("name").Find(&credentials).Error
+	return credentials, err
+}
+
+// SaveMountCredential create credential or rotate password of existing one,
+// password is encrypted by master key if it is set
+func SaveMountCredential(option *SaveMountCredentialOption) (*database.MountCredential, error) {
+	err := option.Validate()
+	if err != nil {
+		return nil, err
+	}
+	credential, err := GetMountCredential(option.Name)
+	if err != nil && err != MountCredentialNotFound {
+		return nil, err
+	}
+	if credential == nil {
+		credential = &database.MountCredential{Name: option.Name, MountPath: option.mountPath}
+	}
+	oldPath := credential.Path
+	masterKey := config.Instance.MasterKey
+	credential.Username = option.Username
+	credential.Domain = option.Domain
+	credential.Encrypted = len(masterKey) > 0
+	credential.Password = ""
+	if credential.Encrypted {
+		credential.Password, err = util.EncryptText(masterKey, option.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	credential.Path, err = credentialFilePath(credential.Name, credential.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+	err = writeCredentialFile(credential.Path, option.Username, option.Password, option.Domain)
+	if err != nil {
+		return nil, err
+	}
+	err = database.Instance.Save(credential).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(oldPath) > 0 && oldPath != credential.Path {
+		// master key is set or unset since last save, move fstab entries to new file
+		os.Remove(oldPath)
+		err = DefaultFstab.replaceCredentialPath(oldPath, credential.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return credential, nil
+}
+
+// RemoveMountCredential remove credential and its file, credential used by fstab can not be removed
+func RemoveMountCredential(name string) error {
+	credential, err := GetMountCredential(name)
+	if err != nil {
+		return err
+	}
+	if len(DefaultFstab.credentialUsage(credential.Path)) > 0 {
+		return MountCredentialInUse
+	}
+	err = database.Instance.Unscoped().Delete(credential).Error
+	if err != nil {
+		return err
+	}
+	err = os.Remove(credential.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// GetMountCredentialUsage return mount paths in fstab use credential
+func GetMountCredentialUsage(credential *database.MountCredential) []string {
+	return DefaultFstab.credentialUsage(credential.Path)
+}
+
+// RestoreMountCredentials decrypt encrypted credentials to runtime directory, then mount managed entries use them.
+// Runtime directory is empty at boot, so these entries failed to mount by system
+func RestoreMountCredentials() error {
+	var credentials []database.MountCredential
+	err := database.Instance.Where("encrypted = ?", true).Find(&credentials).Error
+	if err != nil {
+		return err
+	}
+	if len(credentials) == 0 {
+		return nil
+	}
+	masterKey := config.Instance.MasterKey
+	if len(masterKey) == 0 {
+		return MasterKeyNotSet
+	}
+	restored := map[string]bool{}
+	for _, credential := range credentials {
+		password, err := util.DecryptText(masterKey, credential.Password)
+		if err != nil {
+			mountCredentialLogger.WithField("name", credential.Name).Error(err)
+			continue
+		}
+		err = writeCredentialFile(credential.Path, credential.Username, password, credential.Domain)
+		if err != nil {
+			return err
+		}
+		restored[credential.Path] = true
+	}
+	return DefaultFstab.mountUnmounted(func(mount *fstab.Mount) bool {
+		if !restored[mount.MntOps["credentials"]] {
+			return false
+		}
+		for _, point := range config.Instance.MountPoints {
+			if point == mount.File {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// saveMountPathCredential save credential given with mount options, return credentials file.
+// Credential created for mount path before is rotated, credential created by user is never replaced
+func saveMountPathCredential(mountPath string, username string, password string, domain string) (string, error) {
+	mountPath = filepath.Clean(mountPath)
+	var existing database.MountCredential
+	err := database.Instance.Where("mount_path = ?", mountPath).Find(&existing).Error
+	if err != nil {
+		return "", err
+	}
+	name := existing.Name
+	if existing.ID == 0 {
+		name, err = uniqueCredentialName(credentialNameOfMountPath(mountPath))
+		if err != nil {
+			return "", err
+		}
+	}
+	credential, err := SaveMountCredential(&SaveMountCredentialOption{
+		Name:      name,
+		Username:  username,
+		Password:  password,
+		Domain:    domain,
+		mountPath: mountPath,
+	})
+	if err != nil {
+		return "", err
+	}
+	return credential.Path, nil
+}
+
+// secureCIFSMntOps move username and password in options of cifs mount to credentials file
+func secureCIFSMntOps(mountPath string, ops map[string]string) error {
+	password, hasPassword := ops["password"]
+	if !hasPassword {
+		password, hasPassword = ops["pass"]
+	}
+	if !hasPassword {
+		return nil
+	}
+	username := ops["username"]
+	if len(username) == 0 {
+		username = ops["user"]
+	}
+	domain := ops["domain"]
+	if len(domain) == 0 {
+		domain = ops["dom"]
+	}
+	path, err := saveMountPathCredential(mountPath, username, password, domain)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"username", "user", "password", "pass", "domain", "dom"} {
+		delete(ops, key)
+	}
+	ops["credentials"] = path
+	return nil
+}
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"github.com/d-tux/go-fstab"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"youfile/config"
+	"youfile/util"
+)
+
+var mountLogger = logrus.WithField("scope", "mount")
+
+var MountProbeTimeout = errors.New("mount is not responding")
+
+const (
+	MountHealthOk = "Ok"
+	// mounted but probe failed with stale handle or timeout
+	MountHealthStale     = "Stale"
+	MountHealthError     = "Error"
+	MountHealthUnmounted = "Unmounted"
+)
+
+// filesystem types of network mounts, which may become stale
+var networkFsTypes = []string{"cifs", "smb3", "smbfs", "nfs", "nfs4", "fuse.sshfs", "davfs", "fuse.davfs", "9p"}
+
+func isNetworkFsType(fsType string) bool {
+	for _, networkFsType := range networkFsTypes {
+		if fsType == networkFsType {
+			return true
+		}
+	}
+	return false
+}
+
+// MountInfo is entry of /proc/self/mountinfo
+type MountInfo struct {
+	MountPoint string
+	FsType     string
+	Source     string
+	Options    string
+}
+
+// unescapeMountInfo decode octal escape of space, tab, newline and backslash in mountinfo
+func unescapeMountInfo(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var builder strings.Builder
+	for idx := 0; idx < len(value); idx++ {
+		if value[idx] == '\\' && idx+3 < len(value) {
+			if code, err := strconv.ParseUint(value[idx+1:idx+4], 8, 8); err == nil {
+				builder.WriteByte(byte(code))
+				idx += 3
+				continue
+			}
+		}
+		builder.WriteByte(value[idx])
+	}
+	return builder.String()
+}
+
+func parseMountInfo(reader io.Reader) (map[string]*MountInfo, error) {
+	mounts := map[string]*MountInfo{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		separator := -1
+		for idx, field := range fields {
+			if field == "-" {
+				separator = idx
+				break
+			}
+		}
+		if separator < 6 || len(fields) < separator+3 {
+			continue
+		}
+		mountPoint := unescapeMountInfo(fields[4])
+		// later entry is mounted over earlier one on same point
+		mounts[mountPoint] = &MountInfo{
+			MountPoint: mountPoint,
+			FsType:     fields[separator+1],
+			Source:     unescapeMountInfo(fields[separator+2]),
+			Options:    fields[5],
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// ReadMountInfo return mounted filesystems by mount point, empty on system without /proc
+func ReadMountInfo() (map[string]*MountInfo, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]*MountInfo{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	return parseMountInfo(file)
+}
+
+type MountStatus struct {
+	File    string
+	Spec    string
+	VfsType string
+	Mounted bool
+	// filesystem type and source actually mounted
+	FsType    string
+	Source    string
+	ReadOnly  bool
+	Network   bool
+	Health    string
+	Error     string
+	Total     uint64
+	Free      uint64
+	Available uint64
+	Latency   time.Duration
+	CheckAt   time.Time
+	// entry is not mounted at boot, so it is not expected to be mounted when first checked
+	noAuto bool
+}
+
+// MountMonitorNotifier is called when health of mount changes, remount is only tried if auto remount is enabled
+type MountMonitorNotifier struct {
+	OnDrop    func(status *MountStatus)
+	OnRecover func(status *MountStatus)
+	OnRemount func(status *MountStatus, err error)
+}
+
+type mountProbeResult struct {
+	usage   *util.DiskUsageInfo
+	latency time.Duration
+	err     error
+}
+
+type MountMonitor struct {
+	statuses map[string]*MountStatus
+	// mount points with probe not returned yet, hung probe is not started again
+	probing map[string]bool
+	// mount points unmounted by user, they are not seen as dropped until mounted again
+	unmounted map[string]bool
+	notifier  *MountMonitorNotifier
+	sync.Mutex
+}
+
+var DefaultMountMonitor = &MountMonitor{
+	statuses:  map[string]*MountStatus{},
+	probing:   map[string]bool{},
+	unmounted: map[string]bool{},
+}
+
+func (m *MountMonitor) SetNotifier(notifier *MountMonitorNotifier) {
+	m.Lock()
+	defer m.Unlock()
+	m.notifier = notifier
+}
+
+// probe read usage and directory of mount point, stale network mount may block forever so it is bounded by timeout
+func (m *MountMonitor) probe(mountPoint string) (*util.DiskUsageInfo, time.Duration, error) {
+	m.Lock()
+	if m.probing[mountPoint] {
+		m.Unlock()
+		return nil, 0, MountProbeTimeout
+	}
+	m.probing[mountPoint] = true
+	m.Unlock()
+	resultChan := make(chan *mountProbeResult, 1)
+	go func() {
+		start := time.Now()
+		result := &mountProbeResult{}
+		result.usage, result.err = util.DiskUsage(mountPoint)
+		if result.err == nil {
+			var dir *os.File
+			dir, result.err = os.Open(mountPoint)
+			if result.err == nil {
+				_, result.err = dir.Readdirnames(1)
+				if result.err == io.EOF {
+					result.err = nil
+				}
+				dir.Close()
+			}
+		}
+		result.latency = time.Since(start)
+		m.Lock()
+		delete(m.probing, mountPoint)
+		m.Unlock()
+		resultChan <- result
+	}()
+	timeout := time.Duration(config.Instance.Mount.ProbeTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	select {
+	case result := <-resultChan:
+		return result.usage, result.latency, result.err
+	case <-time.After(timeout):
+		return nil, timeout, MountProbeTimeout
+	}
+}
+
+func (m *MountMonitor) checkMount(mount *fstab.Mount, mountInfo map[string]*MountInfo) *MountStatus {
+	status := &MountStatus{
+		File:    mount.File,
+		Spec:    mount.Spec,
+		VfsType: mount.VfsType,
+		Network: isNetworkFsType(mount.VfsType),
+		Health:  MountHealthUnmounted,
+		CheckAt: time.Now(),
+	}
+	_, status.noAuto = mount.MntOps["noauto"]
+	info, mounted := mountInfo[filepath.Clean(mount.File)]
+	if !mounted {
+		return status
+	}
+	status.Mounted = true
+	status.FsType = info.FsType
+	status.Source = info.Source
+	status.ReadOnly = strings.HasPrefix(info.Options, "ro")
+	status.Network = status.Network || isNetworkFsType(info.FsType)
+	usage, latency, err := m.probe(mount.File)
+	if status.Network {
+		status.Latency = latency
+	}
+	switch {
+	case err == nil:
+		status.Health = MountHealthOk
+		status.Total = usage.Total
+		status.Free = usage.Free
+		status.Available = usage.Available
+	case err == MountProbeTimeout || util.IsStaleFileError(err):
+		status.Health = MountHealthStale
+		status.Error = err.Error()
+	default:
+		status.Health = MountHealthError
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// Check probe mounts in parallel and save statuses, notifier is called for mounts whose health changed
+func (m *MountMonitor) Check(mounts fstab.Mounts) ([]*MountStatus, error) {
+	mountInfo, err := ReadMountInfo()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*MountStatus, len(mounts))
+	var wg sync.WaitGroup
+	for idx, mount := range mounts {
+		wg.Add(1)
+		go func(idx int, mount *fstab.Mount) {
+			defer wg.Done()
+			statuses[idx] = m.checkMount(mount, mountInfo)
+		}(idx, mount)
+	}
+	wg.Wait()
+	for _, status := range statuses {
+		m.update(status)
+	}
+	return statuses, nil
+}
+
+// update save status and notify change of health, mount is seen as dropped when it was ok and now is not,
+// or when it is already down at first check, e.g. at start. Unmount by user is not a drop
+func (m *MountMonitor) update(status *MountStatus) {
+	file := filepath.Clean(status.File)
+	m.Lock()
+	previous := m.statuses[status.File]
+	m.statuses[status.File] = status
+	isExpected := m.unmounted[file]
+	if status.Mounted && previous != nil && !previous.Mounted {
+		delete(m.unmounted, file)
+		isExpected = false
+	}
+	notifier := m.notifier
+	m.Unlock()
+	if previous != nil && previous.Health == status.Health {
+		return
+	}
+	if !status.Mounted && isExpected {
+		mountLogger.WithField("mount", status.File).Info("mount is unmounted by user")
+		return
+	}
+	var isDropped, isRecovered bool
+	if previous == nil {
+		// noauto entry is not mounted at boot, it is not dropped if not mounted yet
+		isDropped = status.Health != MountHealthOk && (status.Mounted || !status.noAuto)
+	} else {
+		isDropped = previous.Health == MountHealthOk
+		isRecovered = status.Health == MountHealthOk
+	}
+	if isDropped {
+		mountLogger.WithField("mount", status.File).Warn("mount dropped: " + status.Health)
+		if notifier != nil && notifier.OnDrop != nil {
+			notifier.OnDrop(status)
+		}
+		// error other than stale handle or unmount, e.g. permission denied, is not fixed by remount
+		isRemountable := status.Health == MountHealthStale || status.Health == MountHealthUnmounted
+		if config.Instance.Mount.AutoRemount && isRemountable {
+			go func() {
+				err := RemountFS(status.File, status.Mounted)
+				if err != nil {
+					mountLogger.WithField("mount", status.File).Error(err)
+				}
+				if notifier != nil && notifier.OnRemount != nil {
+					notifier.OnRemount(status, err)
+				}
+			}()
+		}
+	}
+	if isRecovered && notifier != nil && notifier.OnRecover != nil {
+		notifier.OnRecover(status)
+	}
+}
+
+// Umount unmount mount point for user, monitor does not see it as dropped until it is mounted again
+func (m *MountMonitor) Umount(file string) error {
+	file = filepath.Clean(file)
+	m.Lock()
+	isExpected := m.unmounted[file]
+	m.unmounted[file] = true
+	m.Unlock()
+	err := UmountFS(file)
+	m.Lock()
+	defer m.Unlock()
+	if err != nil {
+		if !isExpected {
+			delete(m.unmounted, file)
+		}
+		return err
+	}
+	// record unmount now, so mark is cleared when mounted again even before next check
+	for statusFile, status := range m.statuses {
+		if filepath.Clean(statusFile) == file {
+			m.statuses[statusFile] = &MountStatus{
+				File:    status.File,
+				Spec:    status.Spec,
+				VfsType: status.VfsType,
+				Network: isNetworkFsType(status.VfsType),
+				Health:  MountHealthUnmounted,
+				CheckAt: time.Now(),
+				noAuto:  status.noAuto,
+			}
+		}
+	}
+	return nil
+}
+
+// Forget remove status of mount point, called when it is removed from fstab
+func (m *MountMonitor) Forget(file string) {
+	m.Lock()
+	defer m.Unlock()
+	for statusFile := range m.statuses {
+		if filepath.Clean(statusFile) == filepath.Clean(file) {
+			delete(m.statuses, statusFile)
+		}
+	}
+	delete(m.unmounted, filepath.Clean(file))
+}
+
+// prune remove statuses of mount points not in mounts, e.g. entries removed from fstab by other program
+func (m *MountMonitor) prune(mounts fstab.Mounts) {
+	files := map[string]bool{}
+	for _, mount := range mounts {
+		files[mount.File] = true
+	}
+	m.Lock()
+	defer m.Unlock()
+	for file := range m.statuses {
+		if !files[file] {
+			delete(m.statuses, file)
+			delete(m.unmounted, filepath.Clean(file))
+		}
+	}
+}
+
+// IsHealthy return false if last check found mount not ok, mount not checked yet is seen as healthy
+func (m *MountMonitor) IsHealthy(file string) bool {
+	m.Lock()
+	defer m.Unlock()
+	status, exist := m.statuses[file]
+	return !exist || status.Health == MountHealthOk
+}
+
+// Statuses return last checked status of mounts, mounts not checked yet are checked now.
+// Mounts are checked on every call if monitor is not running
+func (m *MountMonitor) Statuses(mounts fstab.Mounts) ([]*MountStatus, error) {
+	if config.Instance.Mount.MonitorInterval <= 0 {
+		return m.Check(mounts)
+	}
+	unchecked := fstab.Mounts{}
+	m.Lock()
+	for _, mount := range mounts {
+		if _, exist := m.statuses[mount.File]; !exist {
+			unchecked = append(unchecked, mount)
+		}
+	}
+	m.Unlock()
+	if len(unchecked) > 0 {
+		_, err := m.Check(unchecked)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.Lock()
+	defer m.Unlock()
+	statuses := make([]*MountStatus, 0, len(mounts))
+	for _, mount := range mounts {
+		statuses = append(statuses, m.statuses[mount.File])
+	}
+	return statuses, nil
+}
+
+// StartMountMonitor check health of managed mounts at interval in background
+func StartMountMonitor() {
+	interval := config.Instance.Mount.MonitorInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		for {
+			mounts := GetManagedMounts()
+			DefaultMountMonitor.prune(mounts)
+			_, err := DefaultMountMonitor.Check(mounts)
+			if err != nil {
+				mountLogger.Error(err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,494 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	MountProviderNotFound = errors.New("mount provider not found")
+	MountPathExist        = errors.New("mount path already in fstab")
+)
+
+// MountOption is typed option of provider, it must be validated before mount or written to fstab
+type MountOption interface {
+	Validate() error
+	GetMountPath() string
+	SetMountPath(path string)
+	// Spec return first field of fstab, e.g. //server/share
+	Spec() string
+	MntOps() map[string]string
+}
+
+// preparedMountOption is option which write files used by mount, e.g. credentials.
+// Files written for temporary mount are removed by returned cleanup
+type preparedMountOption interface {
+	prepare(temporary bool) (func(), error)
+}
+
+// prepareMountOption write files of validated option, called before option is mounted or written to fstab.
+// Cleanup must be called after temporary mount is done
+func prepareMountOption(option MountOption, temporary bool) (func(), error) {
+	if prepared, ok := option.(preparedMountOption); ok {
+		return prepared.prepare(temporary)
+	}
+	return func() {}, nil
+}
+
+type MountProvider interface {
+	Name() string
+	VfsType() string
+	NewOption() MountOption
+}
+
+var MountProviders = []MountProvider{
+	&CIFSMountProvider{},
+	&NFSMountProvider{vfsType: "nfs"},
+	&NFSMountProvider{vfsType: "nfs4"},
+	&SSHFSMountProvider{},
+	&WebDAVMountProvider{},
+}
+
+func GetMountProvider(name string) (MountProvider, error) {
+	for _, provider := range MountProviders {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+	return nil, MountProviderNotFound
+}
+
+// GetMountProviderByVfsType return provider of fstab entry, nil if filesystem is not managed by provider
+func GetMountProviderByVfsType(vfsType string) MountProvider {
+	for _, provider := range MountProviders {
+		if provider.VfsType() == vfsType {
+			return provider
+		}
+	}
+	return nil
+}
+
+var modePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// validateMountField check value can be written as field of fstab
+func validateMountField(name string, value string) error {
+	if len(value) == 0 {
+		return fmt.Errorf("%s is required", name)
+	}
+	if strings.ContainsAny(value, " \t\r\n") || strings.HasPrefix(value, "#") {
+		return fmt.Errorf("%s must not contain space or start with #", name)
+	}
+	return nil
+}
+
+// validateMountOptionValue check value can be written in comma separated mount options
+func validateMountOptionValue(name string, value string) error {
+	if strings.ContainsAny(value, " \t\r\n,\"'") {
+		return fmt.Errorf("%s must not contain space, comma or quote", name)
+	}
+	return nil
+}
+
+// BaseMountOption contain options shared by all providers
+type BaseMountOption struct {
+	MountPath string `json:"mount_path"`
+	ReadOnly  bool   `json:"read_only"`
+}
+
+func (o *BaseMountOption) GetMountPath() string {
+	return o.MountPath
+}
+
+func (o *BaseMountOption) SetMountPath(path string) {
+	o.MountPath = path
+}
+
+func (o *BaseMountOption) validate() error {
+	err := validateMountField("mount path", o.MountPath)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(o.MountPath) {
+		return errors.New("mount path must be absolute")
+	}
+	o.MountPath = filepath.Clean(o.MountPath)
+	return nil
+}
+
+// mntOps return options shared by all providers, network filesystems wait for network at boot
+func (o *BaseMountOption) mntOps() map[string]string {
+	ops := map[string]string{"_netdev": ""}
+	if o.ReadOnly {
+		ops["ro"] = ""
+	}
+	return ops
+}
+
+// OwnerMountOption map owner and mode of files for filesystems without unix permission
+type OwnerMountOption struct {
+	Uid      string `json:"uid"`
+	Gid      string `json:"gid"`
+	DirMode  string `json:"dir_mode"`
+	FileMode string `json:"file_mode"`
+}
+
+func (o *OwnerMountOption) validate() error {
+	for name, value := range map[string]string{"uid": o.Uid, "gid": o.Gid} {
+		if len(value) == 0 {
+			continue
+		}
+		if err := validateMountOptionValue(name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]string{"dir_mode": o.DirMode, "file_mode": o.FileMode} {
+		if len(value) > 0 && !modePattern.MatchString(value) {
+			return fmt.Errorf("%s must be octal mode, e.g. 0755", name)
+		}
+	}
+	return nil
+}
+
+func (o *OwnerMountOption) apply(ops map[string]string) {
+	for name, value := range map[string]string{"uid": o.Uid, "gid": o.Gid, "dir_mode": o.DirMode, "file_mode": o.FileMode} {
+		if len(value) > 0 {
+			ops[name] = value
+		}
+	}
+}
+
+// mntOpsString join options in order of key, so same options give same command
+func mntOpsString(ops map[string]string) string {
+	keys := make([]string, 0, len(ops))
+	for key := range ops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if len(ops[key]) > 0 {
+			parts = append(parts, key+"="+ops[key])
+		} else {
+			parts = append(parts, key)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+type CIFSMountProvider struct{}
+
+func (p *CIFSMountProvider) Name() string {
+	return "cifs"
+}
+
+func (p *CIFSMountProvider) VfsType() string {
+	return "cifs"
+}
+
+func (p *CIFSMountProvider) NewOption() MountOption {
+	return &CIFSMountOption{}
+}
+
+type CIFSMountOption struct {
+	BaseMountOption
+	OwnerMountOption
+	// share in form of //server/share
+	RemotePath string `json:"remote_path"`
+	// name of saved credential, or username and password to save as credential of mount path
+	Credentials string `json:"credentials"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Domain      string `json:"domain"`
+	// smb protocol version, e.g. 3.0
+	Version        string `json:"vers"`
+	credentialFile string
+}
+
+func (o *CIFSMountOption) Validate() error {
+	err := o.BaseMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = o.OwnerMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = validateMountField("remote path", o.RemotePath)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(o.RemotePath, "//") {
+		return errors.New("remote path must be in form of //server/share")
+	}
+	if len(o.Credentials) > 0 && len(o.Username) > 0 {
+		return errors.New("credentials and username can not be both set")
+	}
+	if strings.ContainsAny(o.Username+o.Password+o.Domain, "\r\n") {
+		return errors.New("username, password and domain must not contain line break")
+	}
+	return validateMountOptionValue("vers", o.Version)
+}
+
+// prepare save username and password to credentials file, so they never appear in command line or fstab.
+// Temporary mount use credentials file removed after mount instead of saved credential
+func (o *CIFSMountOption) prepare(temporary bool) (func(), error) {
+	cleanup := func() {}
+	if len(o.Credentials) > 0 {
+		credential, err := GetMountCredential(o.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		o.credentialFile = credential.Path
+		return cleanup, nil
+	}
+	if len(o.Username) == 0 {
+		return cleanup, nil
+	}
+	if temporary {
+		path, err := writeTemporaryCredentialFile(o.Username, o.Password, o.Domain)
+		if err != nil {
+			return nil, err
+		}
+		o.credentialFile = path
+		return func() {
+			os.Remove(path)
+		}, nil
+	}
+	path, err := saveMountPathCredential(o.MountPath, o.Username, o.Password, o.Domain)
+	if err != nil {
+		return nil, err
+	}
+	o.credentialFile = path
+	return cleanup, nil
+}
+
+func (o *CIFSMountOption) Spec() string {
+	return o.RemotePath
+}
+
+func (o *CIFSMountOption) MntOps() map[string]string {
+	ops := o.BaseMountOption.mntOps()
+	o.OwnerMountOption.apply(ops)
+	if len(o.credentialFile) > 0 {
+		ops["credentials"] = o.credentialFile
+	} else {
+		ops["guest"] = ""
+	}
+	if len(o.Version) > 0 {
+		ops["vers"] = o.Version
+	}
+	return ops
+}
+
+type NFSMountProvider struct {
+	vfsType string
+}
+
+func (p *NFSMountProvider) Name() string {
+	return p.vfsType
+}
+
+func (p *NFSMountProvider) VfsType() string {
+	return p.vfsType
+}
+
+func (p *NFSMountProvider) NewOption() MountOption {
+	return &NFSMountOption{isNFS4: p.vfsType == "nfs4"}
+}
+
+type NFSMountOption struct {
+	BaseMountOption
+	Server string `json:"server"`
+	// exported directory, e.g. /srv/share
+	Export string `json:"export"`
+	// protocol version, e.g. 3, 4.1
+	Version string `json:"vers"`
+	isNFS4  bool
+}
+
+func (o *NFSMountOption) Validate() error {
+	err := o.BaseMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = validateMountField("server", o.Server)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(o.Server, ":/@") && !strings.HasPrefix(o.Server, "[") {
+		return errors.New("server must be host name or address")
+	}
+	err = validateMountField("export", o.Export)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(o.Export, "/") {
+		return errors.New("export must be absolute path")
+	}
+	if len(o.Version) > 0 {
+		if _, err = strconv.ParseFloat(o.Version, 64); err != nil {
+			return errors.New("vers must be version number, e.g. 4.1")
+		}
+		if o.isNFS4 && !strings.HasPrefix(o.Version, "4") {
+			return errors.New("vers of nfs4 must be 4 or later")
+		}
+	}
+	return nil
+}
+
+func (o *NFSMountOption) Spec() string {
+	return o.Server + ":" + o.Export
+}
+
+func (o *NFSMountOption) MntOps() map[string]string {
+	ops := o.BaseMountOption.mntOps()
+	if len(o.Version) > 0 {
+		ops["vers"] = o.Version
+	}
+	return ops
+}
+
+type SSHFSMountProvider struct{}
+
+func (p *SSHFSMountProvider) Name() string {
+	return "sshfs"
+}
+
+func (p *SSHFSMountProvider) VfsType() string {
+	return "fuse.sshfs"
+}
+
+func (p *SSHFSMountProvider) NewOption() MountOption {
+	return &SSHFSMountOption{}
+}
+
+type SSHFSMountOption struct {
+	BaseMountOption
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Username   string `json:"username"`
+	RemotePath string `json:"remote_path"`
+	// private key used to login, mount at boot can not ask for password
+	IdentityFile string `json:"identity_file"`
+	// allow users other than the one mount it to access files
+	AllowOther bool `json:"allow_other"`
+}
+
+func (o *SSHFSMountOption) Validate() error {
+	err := o.BaseMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = validateMountField("host", o.Host)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(o.Host, ":/@") && !strings.HasPrefix(o.Host, "[") {
+		return errors.New("host must be host name or address")
+	}
+	if o.Port < 0 || o.Port > 65535 {
+		return errors.New("port must be between 1 and 65535")
+	}
+	if strings.ContainsAny(o.Username, ":/@ \t") {
+		return errors.New("username is invalid")
+	}
+	if len(o.RemotePath) > 0 {
+		if err = validateMountField("remote path", o.RemotePath); err != nil {
+			return err
+		}
+	}
+	if len(o.IdentityFile) > 0 {
+		if err = validateMountOptionValue("identity file", o.IdentityFile); err != nil {
+			return err
+		}
+		if !filepath.IsAbs(o.IdentityFile) {
+			return errors.New("identity file must be absolute path")
+		}
+	}
+	return nil
+}
+
+func (o *SSHFSMountOption) Spec() string {
+	spec := o.Host + ":" + o.RemotePath
+	if len(o.Username) > 0 {
+		spec = o.Username + "@" + spec
+	}
+	return spec
+}
+
+func (o *SSHFSMountOption) MntOps() map[string]string {
+	ops := o.BaseMountOption.mntOps()
+	// keep mount alive when connection is dropped
+	ops["reconnect"] = ""
+	if o.Port > 0 {
+		ops["port"] = strconv.Itoa(o.Port)
+	}
+	if len(o.IdentityFile) > 0 {
+		ops["IdentityFile"] = o.IdentityFile
+	}
+	if o.AllowOther {
+		ops["allow_other"] = ""
+	}
+	return ops
+}
+
+type WebDAVMountProvider struct{}
+
+func (p *WebDAVMountProvider) Name() string {
+	return "davfs"
+}
+
+func (p *WebDAVMountProvider) VfsType() string {
+	return "davfs"
+}
+
+func (p *WebDAVMountProvider) NewOption() MountOption {
+	return &WebDAVMountOption{}
+}
+
+// WebDAVMountOption mount by davfs2, credentials are read from secrets file of davfs2
+type WebDAVMountOption struct {
+	BaseMountOption
+	OwnerMountOption
+	Url string `json:"url"`
+}
+
+func (o *WebDAVMountOption) Validate() error {
+	err := o.BaseMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = o.OwnerMountOption.validate()
+	if err != nil {
+		return err
+	}
+	err = validateMountField("url", o.Url)
+	if err != nil {
+		return err
+	}
+	davUrl, err := url.Parse(o.Url)
+	if err != nil || (davUrl.Scheme != "http" && davUrl.Scheme != "https") || len(davUrl.Host) == 0 {
+		return errors.New("url must be http or https url")
+	}
+	if davUrl.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	return nil
+}
+
+func (o *WebDAVMountOption) Spec() string {
+	return o.Url
+}
+
+func (o *WebDAVMountOption) MntOps() map[string]string {
+	ops := o.BaseMountOption.mntOps()
+	o.OwnerMountOption.apply(ops)
+	return ops
+}
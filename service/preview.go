@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/saintfish/chardet"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"youfile/config"
+)
+
+var (
+	PreviewNotSupported = errors.New("preview of file is not supported")
+	PdfRendererNotFound = errors.New("pdf renderer not found")
+)
+
+const (
+	PreviewTypeImage = "Image"
+	PreviewTypeText  = "Text"
+)
+
+const (
+	textPreviewMaxBytes = 64 * 1024
+	textPreviewMaxLines = 200
+	// edge of image rendered from text, scaled down to each thumbnail size
+	textThumbnailEdge = 480
+)
+
+var TextPreviewExtensions = []string{
+	".txt", ".log", ".md", ".markdown", ".csv", ".json", ".xml", ".yaml", ".yml", ".toml", ".ini", ".conf",
+	".go", ".py", ".js", ".ts", ".jsx", ".tsx", ".java", ".kt", ".c", ".h", ".cpp", ".hpp", ".cs", ".rs",
+	".rb", ".php", ".swift", ".sh", ".bat", ".ps1", ".sql", ".html", ".css", ".scss", ".vue", ".lua",
+}
+
+func isPdf(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".pdf"
+}
+
+func isTextPreviewSupported(path string) bool {
+	return linq.From(TextPreviewExtensions).Contains(strings.ToLower(filepath.Ext(path)))
+}
+
+// findPdfRenderer return path of pdftoppm in config or in PATH
+func findPdfRenderer() string {
+	if len(config.Instance.Thumbnail.PdfRenderer) > 0 {
+		return config.Instance.Thumbnail.PdfRenderer
+	}
+	if binPath, err := exec.LookPath("pdftoppm"); err == nil {
+		return binPath
+	}
+	return ""
+}
+
+// renderPdf render first page of pdf to image no larger than edge of large thumbnail
+func renderPdf(path string) (image.Image, error) {
+	renderer := findPdfRenderer()
+	if len(renderer) == 0 {
+		return nil, PdfRendererNotFound
+	}
+	tempDir, err := ioutil.TempDir("", "youfile-pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	edge := config.Instance.Thumbnail.Sizes[config.ThumbnailSizeLarge]
+	if edge <= 0 {
+		edge = textThumbnailEdge
+	}
+	output := filepath.Join(tempDir, "page")
+	err = runThumbnailConverter(
+		renderer, "-f", "1", "-l", "1", "-singlefile", "-png", "-scale-to", strconv.Itoa(edge), path, output,
+	)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(output + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+// detectTextEncoding return name of encoding of text, utf-8 is preferred when content is valid in it
+func detectTextEncoding(content []byte) string {
+	if bytes.HasPrefix(content, []byte{0xff, 0xfe}) {
+		return "utf-16le"
+	}
+	if bytes.HasPrefix(content, []byte{0xfe, 0xff}) {
+		return "utf-16be"
+	}
+	if utf8.Valid(content) {
+		return "utf-8"
+	}
+	result, err := chardet.NewTextDetector().DetectBest(content)
+	if err != nil {
+		return "utf-8"
+	}
+	name := strings.ToLower(result.Charset)
+	if name == "gb-18030" {
+		return "gb18030"
+	}
+	return name
+}
+
+func decodeText(content []byte, encodingName string) (string, error) {
+	switch encodingName {
+	case "utf-8":
+		return string(bytes.TrimPrefix(content, []byte{0xef, 0xbb, 0xbf})), nil
+	case "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().String(string(content))
+	case "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder().String(string(content))
+	}
+	encoding, err := htmlindex.Get(encodingName)
+	if err != nil {
+		// encoding not supported, show invalid characters as replacement
+		return strings.ToValidUTF8(string(content), "\uFFFD"), nil
+	}
+	return encoding.NewDecoder().String(string(content))
+}
+
+// trimIncompleteRune remove bytes of last utf-8 character if it is incomplete
+func trimIncompleteRune(content []byte) []byte {
+	for i := len(content) - 1; i >= 0 && i >= len(content)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(content[i]) {
+			if !utf8.FullRune(content[i:]) {
+				return content[:i]
+			}
+			break
+		}
+	}
+	return content
+}
+
+type TextPreview struct {
+	Text      string
+	Encoding  string
+	Truncated bool
+}
+
+// readTextPreview read head of text file in utf-8, content after max bytes or max lines is truncated
+func readTextPreview(path string) (*TextPreview, error) {
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(file, textPreviewMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	preview := &TextPreview{}
+	if len(content) > textPreviewMaxBytes {
+		content = content[:textPreviewMaxBytes]
+		preview.Truncated = true
+		// utf-8 content cut in the middle of character is still detected as utf-8
+		if trimmed := trimIncompleteRune(content); utf8.Valid(trimmed) {
+			content = trimmed
+		}
+	}
+	preview.Encoding = detectTextEncoding(content)
+	text, err := decodeText(content, preview.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if preview.Truncated {
+		// drop last line which may be cut in the middle of character
+		if idx := strings.LastIndex(text, "\n"); idx >= 0 {
+			text = text[:idx]
+		}
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) > textPreviewMaxLines {
+		lines = lines[:textPreviewMaxLines]
+		preview.Truncated = true
+	}
+	preview.Text = strings.Join(lines, "\n")
+	return preview, nil
+}
+
+// renderTextImage draw head lines of text file on white page
+func renderTextImage(path string) (image.Image, error) {
+	preview, err := readTextPreview(path)
+	if err != nil {
+		return nil, err
+	}
+	page := image.NewRGBA(image.Rect(0, 0, textThumbnailEdge, textThumbnailEdge))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	face := basicfont.Face7x13
+	drawer := &font.Drawer{Dst: page, Src: image.Black, Face: face}
+	const margin = 8
+	maxColumns := (textThumbnailEdge - margin*2) / face.Advance
+	y := margin + face.Ascent
+	for _, line := range strings.Split(preview.Text, "\n") {
+		if y > textThumbnailEdge-margin {
+			break
+		}
+		line = strings.ReplaceAll(line, "\t", "    ")
+		if runes := []rune(line); len(runes) > maxColumns {
+			line = string(runes[:maxColumns])
+		}
+		drawer.Dot = fixed.P(margin, y)
+		drawer.DrawString(line)
+		y += face.Height
+	}
+	return page, nil
+}
+
+// highlightText render text to html snippet with inline style, language is detected by file name or content
+func highlightText(name string, text string) (string, string, error) {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(text)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	iterator, err := lexer.Tokenise(nil, text)
+	if err != nil {
+		return "", "", err
+	}
+	var buf bytes.Buffer
+	err = html.New(html.TabWidth(4)).Format(&buf, styles.Get("github"), iterator)
+	if err != nil {
+		return "", "", err
+	}
+	return buf.String(), lexer.Config().Name, nil
+}
+
+type Preview struct {
+	Type string
+	// name of thumbnail for image preview
+	Thumbnail string
+	Html      string
+	Language  string
+	Encoding  string
+	Truncated bool
+}
+
+// GetFilePreview return highlighted snippet of text file, or thumbnail of image and pdf
+func GetFilePreview(path string, size string) (*Preview, error) {
+	if isTextPreviewSupported(path) {
+		textPreview, err := readTextPreview(path)
+		if err != nil {
+			return nil, err
+		}
+		snippet, language, err := highlightText(filepath.Base(path), textPreview.Text)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{
+			Type:      PreviewTypeText,
+			Html:      snippet,
+			Language:  language,
+			Encoding:  textPreview.Encoding,
+			Truncated: textPreview.Truncated,
+		}, nil
+	}
+	if !isThumbnailSupported(path) {
+		return nil, PreviewNotSupported
+	}
+	if _, exist := config.Instance.Thumbnail.Sizes[size]; !exist {
+		return nil, ThumbnailSizeNotFound
+	}
+	thumbnail, err := GetFileThumbnail(path, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(thumbnail) == 0 {
+		// generate now, preview is requested for single file
+		thumbnail, err = generateFileThumbnail(path)
+		if err != nil {
+			return nil, err
+		}
+		thumbnail, err = ThumbnailPath(thumbnail, size)
+		if err != nil {
+			return nil, err
+		}
+		thumbnail = filepath.Base(thumbnail)
+	}
+	return &Preview{Type: PreviewTypeImage, Thumbnail: thumbnail}, nil
+}
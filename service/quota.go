@@ -0,0 +1,284 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+var quotaLogger = logrus.WithField("scope", "quota")
+var quotaLock sync.Mutex
+
+var (
+	QuotaNotFound         = errors.New("quota not found")
+	QuotaPermissionDenied = errors.New("permission denied to manage quota")
+)
+
+type QuotaExceedError struct {
+	Root    string
+	Limit   int64
+	Used    int64
+	Require int64
+}
+
+func (e *QuotaExceedError) Error() string {
+	return fmt.Sprintf("quota exceeded on %s: used %d of %d, require %d", e.Root, e.Used, e.Limit, e.Require)
+}
+
+type SaveQuotaOption struct {
+	Username string
+	Path     string
+	Root     string
+	Limit    int64
+}
+
+func SaveQuota(option SaveQuotaOption) (*database.Quota, error) {
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+	root := filepath.Clean(option.Root)
+	var quota database.Quota
+	err := database.Instance.Where("username = ? AND root = ?", option.Username, root).
+		Attrs(database.Quota{Username: option.Username, Root: root}).
+		FirstOrInit(&quota).Error
+	if err != nil {
+		return nil, err
+	}
+	quota.Path = option.Path
+	quota.Limit = option.Limit
+	err = database.Instance.Save(&quota).Error
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func GetQuota(id uint) (*database.Quota, error) {
+	var quota database.Quota
+	err := database.Instance.Find(&quota, id).Error
+	if err != nil {
+		return nil, err
+	}
+	if quota.ID == 0 {
+		return nil, QuotaNotFound
+	}
+	return &quota, nil
+}
+
+// IsQuotaAdmin check user can manage quotas of all users, everyone is admin when auth is disabled
+func IsQuotaAdmin(username string) bool {
+	if !config.Instance.YouPlusAuth {
+		return true
+	}
+	for _, admin := range config.Instance.Quota.Admins {
+		if admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSaveQuotaPermission check user can save quota, user who is not admin can only add
+// or lower own quota, raise it would bypass the limit
+func CheckSaveQuotaPermission(username string, option SaveQuotaOption) error {
+	if IsQuotaAdmin(username) {
+		return nil
+	}
+	if option.Username != username {
+		return QuotaPermissionDenied
+	}
+	var quota database.Quota
+	err := database.Instance.Where("username = ? AND root = ?", option.Username, filepath.Clean(option.Root)).Find(&quota).Error
+	if err != nil {
+		return err
+	}
+	if quota.ID != 0 && option.Limit > quota.Limit {
+		return QuotaPermissionDenied
+	}
+	return nil
+}
+
+func RemoveQuota(id uint) error {
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+	return database.Instance.Unscoped().Delete(&database.Quota{}, id).Error
+}
+
+// GetUserQuotas return quotas of user, include quotas shared by all user
+func GetUserQuotas(username string) ([]database.Quota, error) {
+	var quotas []database.Quota
+	err := database.Instance.Where("username = ? OR username = ?", username, "").Find(&quotas).Error
+	return quotas, err
+}
+
+func matchQuotas(quotas []database.Quota, target string) []*database.Quota {
+	result := make([]*database.Quota, 0)
+	for idx := range quotas {
+		if util.IsSubPath(quotas[idx].Root, target) {
+			result = append(result, &quotas[idx])
+		}
+	}
+	return result
+}
+
+// CheckQuota check quotas of user can hold the change, requirement is a mapping of path to size delta.
+// with warn enforce mode, exceed quota return as warning instead of error
+func CheckQuota(username string, requirement map[string]int64) (warning error, err error) {
+	if !config.Instance.Quota.Enable {
+		return nil, nil
+	}
+	quotas, err := GetUserQuotas(username)
+	if err != nil {
+		return nil, err
+	}
+	require := map[uint]int64{}
+	for target, delta := range requirement {
+		for _, quota := range matchQuotas(quotas, target) {
+			require[quota.ID] += delta
+		}
+	}
+	for _, quota := range quotas {
+		delta := require[quota.ID]
+		if delta <= 0 || quota.Used+delta <= quota.Limit {
+			continue
+		}
+		exceedErr := &QuotaExceedError{Root: quota.Path, Limit: quota.Limit, Used: quota.Used, Require: delta}
+		if config.Instance.Quota.Enforce == config.QuotaEnforceWarn {
+			return exceedErr, nil
+		}
+		return nil, exceedErr
+	}
+	return nil, nil
+}
+
+// AddQuotaUsage apply size delta to quotas which contain the target
+func AddQuotaUsage(username string, target string, delta int64) {
+	if !config.Instance.Quota.Enable || delta == 0 {
+		return
+	}
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+	quotas, err := GetUserQuotas(username)
+	if err != nil {
+		quotaLogger.Error(err)
+		return
+	}
+	for _, quota := range matchQuotas(quotas, target) {
+		quota.Used += delta
+		if quota.Used < 0 {
+			quota.Used = 0
+		}
+		err = database.Instance.Model(quota).Update("used", quota.Used).Error
+		if err != nil {
+			quotaLogger.Error(err)
+		}
+	}
+}
+
+// FileWriteDelta return size delta of overwrite target with new content
+func FileWriteDelta(target string, size int64) int64 {
+	stat, err := AppFs.Stat(target)
+	if err != nil {
+		return size
+	}
+	return size - stat.Size()
+}
+
+// scanRootSize return size of files under root, paths hard linked together are counted once
+func scanRootSize(root string) (int64, error) {
+	var size int64 = 0
+	identities := map[fileIdentity]bool{}
+	err := afero.Walk(AppFs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if inode := util.FileInode(info); inode != 0 && util.FileLinkCount(info) > 1 {
+			identity := fileIdentity{device: util.FileDevice(info), inode: inode}
+			if identities[identity] {
+				return nil
+			}
+			identities[identity] = true
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// ReconcileQuota rescan quota roots to correct usage drift of incremental accounting.
+// Shared quotas take the real size of root, user quotas can not exceed it.
+func ReconcileQuota() error {
+	var quotas []database.Quota
+	err := database.Instance.Find(&quotas).Error
+	if err != nil {
+		return err
+	}
+	rootSize := map[string]int64{}
+	for _, quota := range quotas {
+		if _, scanned := rootSize[quota.Root]; scanned {
+			continue
+		}
+		size, err := scanRootSize(quota.Root)
+		if err != nil {
+			quotaLogger.WithField("root", quota.Root).Error(err)
+			continue
+		}
+		rootSize[quota.Root] = size
+	}
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+	// reload quotas, usage may be changed while scanning
+	err = database.Instance.Find(&quotas).Error
+	if err != nil {
+		return err
+	}
+	scanAt := time.Now()
+	for _, quota := range quotas {
+		size, scanned := rootSize[quota.Root]
+		if !scanned {
+			continue
+		}
+		used := quota.Used
+		if len(quota.Username) == 0 || used > size {
+			used = size
+		}
+		err = database.Instance.Model(&quota).Updates(map[string]interface{}{
+			"used":    used,
+			"scan_at": &scanAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func StartQuotaScanner() {
+	interval := config.Instance.Quota.ScanInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		for {
+			err := ReconcileQuota()
+			if err != nil {
+				quotaLogger.Error(err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"youfile/database"
+)
+
+const (
+	ScheduleTaskCopy        = TaskTypeCopy
+	ScheduleTaskSync        = TaskTypeSync
+	ScheduleTaskArchive     = TaskTypeArchive
+	ScheduleTaskCleanup     = "Cleanup"
+	ScheduleTaskArchiveTest = TaskTypeArchiveTest
+
+	ScheduleRunSkipped = "Skipped"
+)
+
+var (
+	UnknownScheduleTaskType = errors.New("unknown schedule task type")
+	ScheduleSourceRequired  = errors.New("schedule source is required")
+	ScheduleTargetRequired  = errors.New("schedule target is required")
+	ScheduleCleanupDays     = errors.New("cleanup age must be greater than zero")
+	ScheduleJobNotFound     = errors.New("schedule job not found")
+)
+
+var scheduleLogger = logrus.WithField("scope", "schedule")
+
+// ScheduleJobOption is stored as json with job, paths are real path.
+// Target of archive can contain {date} and {time} placeholder to keep every output.
+type ScheduleJobOption struct {
+	Sources       []string          `json:"sources"`
+	Target        string            `json:"target,omitempty"`
+	OnDuplicate   string            `json:"on_duplicate,omitempty"`
+	Mode          string            `json:"mode,omitempty"`
+	Compare       string            `json:"compare,omitempty"`
+	Conflict      string            `json:"conflict,omitempty"`
+	OlderThanDays int               `json:"older_than_days,omitempty"`
+	DisplayPath   map[string]string `json:"display_path,omitempty"`
+}
+
+func (o *ScheduleJobOption) Validate(taskType string) error {
+	if len(o.Sources) == 0 {
+		return ScheduleSourceRequired
+	}
+	switch taskType {
+	case ScheduleTaskCopy, ScheduleTaskArchive:
+		if len(o.Target) == 0 {
+			return ScheduleTargetRequired
+		}
+	case ScheduleTaskSync:
+		if len(o.Target) == 0 {
+			return ScheduleTargetRequired
+		}
+		return o.syncOption().Validate()
+	case ScheduleTaskCleanup:
+		if o.OlderThanDays <= 0 {
+			return ScheduleCleanupDays
+		}
+	case ScheduleTaskArchiveTest:
+	default:
+		return UnknownScheduleTaskType
+	}
+	return nil
+}
+
+func (o *ScheduleJobOption) syncOption() *SyncOption {
+	return &SyncOption{
+		Source:   o.Sources[0],
+		Target:   o.Target,
+		Mode:     o.Mode,
+		Compare:  o.Compare,
+		Conflict: o.Conflict,
+	}
+}
+
+func (o *ScheduleJobOption) archiveTarget(now time.Time) string {
+	target := strings.ReplaceAll(o.Target, "{date}", now.Format("20060102"))
+	return strings.ReplaceAll(target, "{time}", now.Format("150405"))
+}
+
+func ParseScheduleJobOption(job *database.ScheduleJob) (*ScheduleJobOption, error) {
+	var option ScheduleJobOption
+	err := json.Unmarshal([]byte(job.Options), &option)
+	if err != nil {
+		return nil, err
+	}
+	return &option, nil
+}
+
+type Scheduler struct {
+	cron    *cron.Cron
+	entries map[uint]cron.EntryID
+	running map[uint]bool
+	sync.Mutex
+}
+
+var DefaultScheduler = &Scheduler{
+	cron:    cron.New(),
+	entries: map[uint]cron.EntryID{},
+	running: map[uint]bool{},
+}
+
+// StartScheduler register all enabled jobs and start cron
+func StartScheduler() error {
+	var jobs []database.ScheduleJob
+	err := database.Instance.Where("enable = ?", true).Find(&jobs).Error
+	if err != nil {
+		return err
+	}
+	for idx := range jobs {
+		err = DefaultScheduler.register(&jobs[idx])
+		if err != nil {
+			scheduleLogger.WithField("job", jobs[idx].ID).Error(err)
+		}
+	}
+	DefaultScheduler.cron.Start()
+	return nil
+}
+
+func (s *Scheduler) register(job *database.ScheduleJob) error {
+	s.unregister(job.ID)
+	if !job.Enable {
+		return database.Instance.Model(job).Update("next_run_at", nil).Error
+	}
+	schedule, err := cron.ParseStandard(job.Cron)
+	if err != nil {
+		return err
+	}
+	jobId := job.ID
+	s.Lock()
+	s.entries[jobId] = s.cron.Schedule(schedule, cron.FuncJob(func() {
+		s.runJob(jobId)
+	}))
+	s.Unlock()
+	next := schedule.Next(time.Now())
+	job.NextRunAt = &next
+	return database.Instance.Model(job).Update("next_run_at", &next).Error
+}
+
+func (s *Scheduler) unregister(jobId uint) {
+	s.Lock()
+	defer s.Unlock()
+	if entryId, exist := s.entries[jobId]; exist {
+		s.cron.Remove(entryId)
+		delete(s.entries, jobId)
+	}
+}
+
+func (s *Scheduler) nextRunAt(jobId uint) *time.Time {
+	s.Lock()
+	defer s.Unlock()
+	entryId, exist := s.entries[jobId]
+	if !exist {
+		return nil
+	}
+	next := s.cron.Entry(entryId).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+func (s *Scheduler) IsRunning(jobId uint) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.running[jobId]
+}
+
+// runJob run task of job and wait it done, run is skipped when last run of job is not finished
+func (s *Scheduler) runJob(jobId uint) {
+	var job database.ScheduleJob
+	err := database.Instance.First(&job, jobId).Error
+	if err != nil {
+		scheduleLogger.WithField("job", jobId).Error(err)
+		return
+	}
+	logger := scheduleLogger.WithField("job", job.ID)
+	run := &database.ScheduleRun{
+		JobId:   job.ID,
+		Status:  TaskStateRunning,
+		StartAt: time.Now(),
+	}
+	s.Lock()
+	if s.running[job.ID] {
+		s.Unlock()
+		run.Status = ScheduleRunSkipped
+		run.Error = "last run is not finished"
+		run.StopAt = &run.StartAt
+		err = database.Instance.Create(run).Error
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	s.running[job.ID] = true
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.running, job.ID)
+		s.Unlock()
+	}()
+	err = database.Instance.Create(run).Error
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	err = database.Instance.Model(&job).Updates(map[string]interface{}{
+		"last_run_at": &run.StartAt,
+		"next_run_at": s.nextRunAt(job.ID),
+	}).Error
+	if err != nil {
+		logger.Error(err)
+	}
+	task, err := createScheduleTask(&job)
+	if err == nil && task != nil {
+		database.Instance.Model(run).Update("task_id", task.GetId())
+		task.Run()
+		err = task.GetError()
+	}
+	stopAt := time.Now()
+	run.StopAt = &stopAt
+	run.Status = TaskStateComplete
+	if err != nil {
+		run.Status = TaskStateError
+		run.Error = err.Error()
+		logger.Error(err)
+	}
+	err = database.Instance.Model(run).Updates(map[string]interface{}{
+		"status":  run.Status,
+		"error":   run.Error,
+		"stop_at": run.StopAt,
+	}).Error
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// createScheduleTask create task in DefaultTask for job, return nil task if there is nothing to do
+func createScheduleTask(job *database.ScheduleJob) (Task, error) {
+	option, err := ParseScheduleJobOption(job)
+	if err != nil {
+		return nil, err
+	}
+	err = option.Validate(job.TaskType)
+	if err != nil {
+		return nil, err
+	}
+	switch job.TaskType {
+	case ScheduleTaskCopy:
+		copyOptions := make([]*CopyOption, 0)
+		for _, source := range option.Sources {
+			copyOptions = append(copyOptions, &CopyOption{
+				Src:  source,
+				Dest: filepath.Join(option.Target, filepath.Base(source)),
+			})
+		}
+		return DefaultTask.NewCopyTask(&NewCopyTaskOption{
+			Options:     copyOptions,
+			DisplayPath: option.DisplayPath,
+			Username:    job.Username,
+			OnDuplicate: option.OnDuplicate,
+		}), nil
+	case ScheduleTaskSync:
+		return DefaultTask.NewSyncTask(&NewSyncTaskOption{
+			SyncOption:  *option.syncOption(),
+			DisplayPath: option.DisplayPath,
+			Username:    job.Username,
+		}), nil
+	case ScheduleTaskArchive:
+		return DefaultTask.NewArchiveTask(&NewArchiveTaskOption{
+			Sources:  option.Sources,
+			Target:   option.archiveTarget(time.Now()),
+			Username: job.Username,
+		}), nil
+	case ScheduleTaskArchiveTest:
+		return DefaultTask.NewArchiveTestTask(&NewArchiveTestTaskOption{
+			Sources:     option.Sources,
+			DisplayPath: option.DisplayPath,
+			Username:    job.Username,
+		}), nil
+	case ScheduleTaskCleanup:
+		expired, err := findExpiredFiles(option.Sources, time.Now().AddDate(0, 0, -option.OlderThanDays))
+		if err != nil {
+			return nil, err
+		}
+		if len(expired) == 0 {
+			return nil, nil
+		}
+		return DefaultTask.NewDeleteFileTask(&NewDeleteFileTaskOption{
+			Src:               expired,
+			DisplaySrcMapping: option.DisplayPath,
+			Username:          job.Username,
+		}), nil
+	}
+	return nil, UnknownScheduleTaskType
+}
+
+// findExpiredFiles return regular files in roots not modified since deadline
+func findExpiredFiles(roots []string, deadline time.Time) ([]string, error) {
+	result := make([]string, 0)
+	for _, root := range roots {
+		err := afero.Walk(AppFs, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsPermission(err) {
+					return nil
+				}
+				return err
+			}
+			if info.Mode().IsRegular() && info.ModTime().Before(deadline) {
+				result = append(result, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+type SaveScheduleJobOption struct {
+	Id       uint
+	Name     string
+	Username string
+	Cron     string
+	TaskType string
+	Enable   bool
+	Option   *ScheduleJobOption
+}
+
+func SaveScheduleJob(option SaveScheduleJobOption) (*database.ScheduleJob, error) {
+	_, err := cron.ParseStandard(option.Cron)
+	if err != nil {
+		return nil, err
+	}
+	err = option.Option.Validate(option.TaskType)
+	if err != nil {
+		return nil, err
+	}
+	rawOption, err := json.Marshal(option.Option)
+	if err != nil {
+		return nil, err
+	}
+	job := database.ScheduleJob{}
+	if option.Id != 0 {
+		job, err = GetScheduleJob(option.Id, option.Username)
+		if err != nil {
+			return nil, err
+		}
+	}
+	job.Name = option.Name
+	job.Username = option.Username
+	job.Cron = option.Cron
+	job.TaskType = option.TaskType
+	job.Enable = option.Enable
+	job.Options = string(rawOption)
+	err = database.Instance.Save(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DefaultScheduler.register(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func GetScheduleJob(id uint, username string) (database.ScheduleJob, error) {
+	var job database.ScheduleJob
+	err := database.Instance.Where("id = ? AND username = ?", id, username).First(&job).Error
+	if err != nil {
+		return job, ScheduleJobNotFound
+	}
+	return job, nil
+}
+
+func GetScheduleJobs(username string) ([]database.ScheduleJob, error) {
+	var jobs []database.ScheduleJob
+	err := database.Instance.Where("username = ?", username).Find(&jobs).Error
+	return jobs, err
+}
+
+func RemoveScheduleJob(id uint, username string) error {
+	job, err := GetScheduleJob(id, username)
+	if err != nil {
+		return err
+	}
+	DefaultScheduler.unregister(job.ID)
+	err = database.Instance.Unscoped().Where("job_id = ?", job.ID).Delete(&database.ScheduleRun{}).Error
+	if err != nil {
+		return err
+	}
+	return database.Instance.Unscoped().Delete(&job).Error
+}
+
+// RunScheduleJob trigger job immediately without wait it done
+func RunScheduleJob(id uint, username string) error {
+	job, err := GetScheduleJob(id, username)
+	if err != nil {
+		return err
+	}
+	go DefaultScheduler.runJob(job.ID)
+	return nil
+}
+
+func GetScheduleRuns(jobId uint, page int, pageSize int) ([]database.ScheduleRun, int64, error) {
+	var runs []database.ScheduleRun
+	var count int64
+	query := database.Instance.Model(&database.ScheduleRun{}).Where("job_id = ?", jobId)
+	err := query.Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&runs).Error
+	return runs, count, err
+}
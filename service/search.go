@@ -23,11 +23,12 @@ var (
 	StopWithInterrupt = errors.New("received interrupt")
 )
 
-func SearchFile(src string, targetName string, notifier *SearchFileNotifier, limit int) ([]TargetFile, error) {
+// SearchFile find files with name contains target name, files also match filter when filter is not nil
+func SearchFile(src string, targetName string, filter *ImageMetaFilter, notifier *SearchFileNotifier, limit int) ([]TargetFile, error) {
 	result := make([]TargetFile, 0)
 	err := afero.Walk(AppFs, src, func(path string, info os.FileInfo, err error) error {
 		basename := filepath.Base(path)
-		if strings.Contains(basename, targetName) {
+		if strings.Contains(basename, targetName) && (filter == nil || filter.Match(path)) {
 			if notifier != nil {
 				notifier.HitChan <- TargetFile{
 					Path: path,
@@ -0,0 +1,507 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"youfile/database"
+	"youfile/util"
+)
+
+const (
+	SyncModeMirror        = "mirror"
+	SyncModeUpdate        = "update"
+	SyncModeBidirectional = "bidirectional"
+
+	SyncCompareSizeTime = "sizeTime"
+	SyncCompareChecksum = "checksum"
+
+	SyncConflictNewer  = "newer"
+	SyncConflictSource = "source"
+	SyncConflictTarget = "target"
+	SyncConflictSkip   = "skip"
+
+	SyncActionAdd      = "add"
+	SyncActionChange   = "change"
+	SyncActionDelete   = "delete"
+	SyncActionConflict = "conflict"
+
+	SyncDirectionToTarget = "toTarget"
+	SyncDirectionToSource = "toSource"
+
+	// modify time precision of some network filesystem is 2 seconds
+	syncTimeTolerance = 2 * time.Second
+)
+
+var (
+	UnknownSyncMode     = errors.New("unknown sync mode")
+	UnknownSyncCompare  = errors.New("unknown sync compare method")
+	UnknownSyncConflict = errors.New("unknown sync conflict rule")
+	SyncInterrupt       = errors.New("sync interrupt")
+	SyncSourceNotFound  = errors.New("sync source is not an existing directory")
+	SyncTargetNotFound  = errors.New("sync target is not an existing directory")
+	SyncRootUnavailable = errors.New("sync root is on mount which is not mounted or not healthy")
+	SyncRootOverlap     = errors.New("sync source and target must not be same or inside each other")
+	SyncFailed          = errors.New("some entries are not synced")
+)
+
+type SyncOption struct {
+	Source   string
+	Target   string
+	Mode     string
+	Compare  string
+	Conflict string
+}
+
+func (o *SyncOption) Validate() error {
+	switch o.Mode {
+	case SyncModeMirror, SyncModeUpdate, SyncModeBidirectional:
+	default:
+		return UnknownSyncMode
+	}
+	if len(o.Compare) == 0 {
+		o.Compare = SyncCompareSizeTime
+	}
+	if o.Compare != SyncCompareSizeTime && o.Compare != SyncCompareChecksum {
+		return UnknownSyncCompare
+	}
+	if len(o.Conflict) == 0 {
+		o.Conflict = SyncConflictNewer
+	}
+	switch o.Conflict {
+	case SyncConflictNewer, SyncConflictSource, SyncConflictTarget, SyncConflictSkip:
+	default:
+		return UnknownSyncConflict
+	}
+	return nil
+}
+
+type SyncDiffItem struct {
+	Path          string    `json:"path"`
+	IsDir         bool      `json:"is_dir"`
+	Action        string    `json:"action"`
+	Direction     string    `json:"direction,omitempty"`
+	SourceSize    int64     `json:"source_size"`
+	TargetSize    int64     `json:"target_size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+	TargetModTime time.Time `json:"target_mod_time"`
+	Skip          bool      `json:"skip"`
+	typeChanged   bool
+}
+
+// TransferSize return size of data need to be copied
+func (i *SyncDiffItem) TransferSize() int64 {
+	if i.Skip || i.IsDir || i.Action == SyncActionDelete {
+		return 0
+	}
+	if i.Direction == SyncDirectionToSource {
+		return i.TargetSize
+	}
+	return i.SourceSize
+}
+
+type SyncDiff struct {
+	Items    []*SyncDiffItem
+	Added    int
+	Changed  int
+	Deleted  int
+	Conflict int
+	Skipped  int
+	Size     int64
+}
+
+type SyncNotifier struct {
+	ScanChan chan string
+	StopFlag bool
+}
+
+func readSyncTree(root string, notifier *SyncNotifier) (map[string]os.FileInfo, error) {
+	tree := map[string]os.FileInfo{}
+	exist, err := afero.DirExists(AppFs, root)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return tree, nil
+	}
+	err = afero.Walk(AppFs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if notifier != nil {
+			if notifier.StopFlag {
+				return SyncInterrupt
+			}
+			notifier.ScanChan <- path
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		tree[rel] = info
+		return nil
+	})
+	return tree, err
+}
+
+type syncBaselineEntry struct {
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func findSyncBaseline(option *SyncOption) (*database.SyncBaseline, error) {
+	var baseline database.SyncBaseline
+	err := database.Instance.Where("source = ? AND target = ?", filepath.Clean(option.Source), filepath.Clean(option.Target)).
+		Attrs(database.SyncBaseline{Source: filepath.Clean(option.Source), Target: filepath.Clean(option.Target)}).
+		FirstOrInit(&baseline).Error
+	return &baseline, err
+}
+
+// loadSyncBaseline return tree of last bidirectional sync, empty if source and target never synced
+func loadSyncBaseline(option *SyncOption) (map[string]*syncBaselineEntry, error) {
+	tree := map[string]*syncBaselineEntry{}
+	baseline, err := findSyncBaseline(option)
+	if err != nil || len(baseline.Tree) == 0 {
+		return tree, err
+	}
+	err = json.Unmarshal([]byte(baseline.Tree), &tree)
+	return tree, err
+}
+
+// SaveSyncBaseline save current tree of source as baseline, next bidirectional sync use it
+// to tell entries deleted on one side from entries new on the other side
+func SaveSyncBaseline(option *SyncOption) error {
+	sourceTree, err := readSyncTree(option.Source, nil)
+	if err != nil {
+		return err
+	}
+	tree := map[string]*syncBaselineEntry{}
+	for rel, info := range sourceTree {
+		tree[rel] = &syncBaselineEntry{IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+	}
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	baseline, err := findSyncBaseline(option)
+	if err != nil {
+		return err
+	}
+	baseline.Tree = string(raw)
+	return database.Instance.Save(baseline).Error
+}
+
+// isChangedSinceBaseline check entry is not the one synced last time, directory only check type
+func isChangedSinceBaseline(entry *syncBaselineEntry, info os.FileInfo) bool {
+	if entry.IsDir != info.IsDir() {
+		return true
+	}
+	if entry.IsDir {
+		return false
+	}
+	delta := entry.ModTime.Sub(info.ModTime())
+	return entry.Size != info.Size() || delta >= syncTimeTolerance || delta <= -syncTimeTolerance
+}
+
+func isSameSyncFile(option *SyncOption, sourcePath string, sourceInfo os.FileInfo, targetPath string, targetInfo os.FileInfo) (bool, error) {
+	if sourceInfo.Size() != targetInfo.Size() {
+		return false, nil
+	}
+	if option.Compare == SyncCompareChecksum {
+		sourceHash, err := GetCachedFileHash(sourcePath, sourceInfo, false)
+		if err != nil {
+			return false, err
+		}
+		targetHash, err := GetCachedFileHash(targetPath, targetInfo, false)
+		if err != nil {
+			return false, err
+		}
+		return sourceHash == targetHash, nil
+	}
+	delta := sourceInfo.ModTime().Sub(targetInfo.ModTime())
+	return delta < syncTimeTolerance && delta > -syncTimeTolerance, nil
+}
+
+// resolveSyncRoot return absolute path of root with links resolved, path itself if it not exist
+func resolveSyncRoot(root string) string {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return root
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		return resolved
+	}
+	return root
+}
+
+// checkSyncRoots refuse roots which look empty while they are not, missing source or target would make
+// every entry of other side deleted
+func checkSyncRoots(option *SyncOption) error {
+	points, err := unavailableMountPoints()
+	if err != nil {
+		return err
+	}
+	for _, root := range []string{option.Source, option.Target} {
+		for _, point := range points {
+			if util.IsSubPath(point, root) || util.IsSubPath(point, resolveSyncRoot(root)) {
+				return fmt.Errorf("%w: %s", SyncRootUnavailable, point)
+			}
+		}
+	}
+	source := resolveSyncRoot(option.Source)
+	target := resolveSyncRoot(option.Target)
+	if util.IsSubPath(source, target) || util.IsSubPath(target, source) {
+		return SyncRootOverlap
+	}
+	exist, err := afero.DirExists(AppFs, option.Source)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return SyncSourceNotFound
+	}
+	if option.Mode != SyncModeBidirectional {
+		return nil
+	}
+	exist, err = afero.DirExists(AppFs, option.Target)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return SyncTargetNotFound
+	}
+	return nil
+}
+
+// BuildSyncDiff compare source and target tree and produce actions to apply
+func BuildSyncDiff(option *SyncOption, notifier *SyncNotifier) (*SyncDiff, error) {
+	err := option.Validate()
+	if err != nil {
+		return nil, err
+	}
+	err = checkSyncRoots(option)
+	if err != nil {
+		return nil, err
+	}
+	sourceTree, err := readSyncTree(option.Source, notifier)
+	if err != nil {
+		return nil, err
+	}
+	targetTree, err := readSyncTree(option.Target, notifier)
+	if err != nil {
+		return nil, err
+	}
+	baseline := map[string]*syncBaselineEntry{}
+	if option.Mode == SyncModeBidirectional {
+		baseline, err = loadSyncBaseline(option)
+		if err != nil {
+			return nil, err
+		}
+	}
+	diff := &SyncDiff{Items: make([]*SyncDiffItem, 0)}
+	for rel, sourceInfo := range sourceTree {
+		item := &SyncDiffItem{
+			Path:          rel,
+			IsDir:         sourceInfo.IsDir(),
+			SourceSize:    sourceInfo.Size(),
+			SourceModTime: sourceInfo.ModTime(),
+			Direction:     SyncDirectionToTarget,
+		}
+		targetInfo, exist := targetTree[rel]
+		if !exist {
+			item.Action = SyncActionAdd
+			if entry, synced := baseline[rel]; synced && !isChangedSinceBaseline(entry, sourceInfo) {
+				// deleted on target since last sync
+				item.Action = SyncActionDelete
+				item.Direction = SyncDirectionToSource
+			}
+			diff.Items = append(diff.Items, item)
+			continue
+		}
+		item.TargetSize = targetInfo.Size()
+		item.TargetModTime = targetInfo.ModTime()
+		if sourceInfo.IsDir() && targetInfo.IsDir() {
+			continue
+		}
+		if sourceInfo.IsDir() != targetInfo.IsDir() {
+			// file replaced by directory or reverse, always treat as conflict
+			item.Action = SyncActionConflict
+			item.typeChanged = true
+			diff.Items = append(diff.Items, item)
+			continue
+		}
+		same, err := isSameSyncFile(option, filepath.Join(option.Source, rel), sourceInfo, filepath.Join(option.Target, rel), targetInfo)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			continue
+		}
+		item.Action = SyncActionChange
+		if option.Mode == SyncModeBidirectional {
+			item.Action = SyncActionConflict
+		}
+		if option.Mode == SyncModeUpdate && !sourceInfo.ModTime().After(targetInfo.ModTime()) {
+			item.Skip = true
+		}
+		diff.Items = append(diff.Items, item)
+	}
+	for rel, targetInfo := range targetTree {
+		if _, exist := sourceTree[rel]; exist {
+			continue
+		}
+		item := &SyncDiffItem{
+			Path:          rel,
+			IsDir:         targetInfo.IsDir(),
+			TargetSize:    targetInfo.Size(),
+			TargetModTime: targetInfo.ModTime(),
+		}
+		switch option.Mode {
+		case SyncModeMirror:
+			item.Action = SyncActionDelete
+			item.Direction = SyncDirectionToTarget
+		case SyncModeBidirectional:
+			item.Action = SyncActionAdd
+			item.Direction = SyncDirectionToSource
+			if entry, synced := baseline[rel]; synced && !isChangedSinceBaseline(entry, targetInfo) {
+				// deleted on source since last sync
+				item.Action = SyncActionDelete
+				item.Direction = SyncDirectionToTarget
+			}
+		default:
+			continue
+		}
+		diff.Items = append(diff.Items, item)
+	}
+	keepSyncDirOfChangedEntries(diff)
+	for _, item := range diff.Items {
+		if item.Action == SyncActionConflict {
+			resolveSyncConflict(option, item)
+		}
+	}
+	// parent directory must be created before children, and removed after them
+	sort.Slice(diff.Items, func(i, j int) bool {
+		iDelete := diff.Items[i].Action == SyncActionDelete
+		jDelete := diff.Items[j].Action == SyncActionDelete
+		if iDelete != jDelete {
+			return !iDelete
+		}
+		if iDelete {
+			return diff.Items[i].Path > diff.Items[j].Path
+		}
+		return diff.Items[i].Path < diff.Items[j].Path
+	})
+	for _, item := range diff.Items {
+		if item.Skip {
+			diff.Skipped += 1
+			continue
+		}
+		switch item.Action {
+		case SyncActionAdd:
+			diff.Added += 1
+		case SyncActionChange:
+			diff.Changed += 1
+		case SyncActionDelete:
+			diff.Deleted += 1
+		case SyncActionConflict:
+			diff.Conflict += 1
+		}
+		diff.Size += item.TransferSize()
+	}
+	return diff, nil
+}
+
+// keepSyncDirOfChangedEntries turn delete of directory into add when entry in it is changed
+// on the side it is deleted from, change always win over delete
+func keepSyncDirOfChangedEntries(diff *SyncDiff) {
+	for _, item := range diff.Items {
+		if item.Action != SyncActionDelete || !item.IsDir {
+			continue
+		}
+		prefix := item.Path + string(filepath.Separator)
+		for _, other := range diff.Items {
+			if other.Action != SyncActionAdd || !strings.HasPrefix(other.Path, prefix) {
+				continue
+			}
+			// delete toward source mean the entry is copied toward target
+			if (item.Direction == SyncDirectionToSource) == (other.Direction == SyncDirectionToTarget) {
+				item.Action = SyncActionAdd
+				if item.Direction == SyncDirectionToSource {
+					item.Direction = SyncDirectionToTarget
+				} else {
+					item.Direction = SyncDirectionToSource
+				}
+				break
+			}
+		}
+	}
+}
+
+func resolveSyncConflict(option *SyncOption, item *SyncDiffItem) {
+	defer func() {
+		if item.typeChanged && item.Direction == SyncDirectionToSource {
+			item.IsDir = !item.IsDir
+		}
+	}()
+	if option.Mode != SyncModeBidirectional {
+		// one-way sync, source always win
+		item.Direction = SyncDirectionToTarget
+		return
+	}
+	switch option.Conflict {
+	case SyncConflictSource:
+		item.Direction = SyncDirectionToTarget
+	case SyncConflictTarget:
+		item.Direction = SyncDirectionToSource
+	case SyncConflictNewer:
+		item.Direction = SyncDirectionToTarget
+		if item.TargetModTime.After(item.SourceModTime) {
+			item.Direction = SyncDirectionToSource
+		}
+	default:
+		item.Skip = true
+	}
+}
+
+// ApplySyncItem apply one diff item, file content is transferred by CopyFile
+func ApplySyncItem(option *SyncOption, item *SyncDiffItem, notifier *CopyFileNotifier) error {
+	from := filepath.Join(option.Source, item.Path)
+	to := filepath.Join(option.Target, item.Path)
+	modTime := item.SourceModTime
+	if item.Direction == SyncDirectionToSource {
+		from, to = to, from
+		modTime = item.TargetModTime
+	}
+	if item.Action == SyncActionDelete {
+		return AppFs.RemoveAll(to)
+	}
+	if item.Action == SyncActionConflict {
+		// type of entry changed, remove the old one first
+		toInfo, err := AppFs.Stat(to)
+		if err == nil && toInfo.IsDir() != item.IsDir {
+			err = AppFs.RemoveAll(to)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if item.IsDir {
+		return AppFs.MkdirAll(to, os.ModePerm)
+	}
+	err := CopyFile(from, to, notifier, "overwrite")
+	if err != nil {
+		return err
+	}
+	// keep modify time, or next compare will find it changed again
+	return AppFs.Chtimes(to, modTime, modTime)
+}
@@ -10,16 +10,23 @@ import (
 var DefaultTask = NewTaskPool()
 
 const (
-	TaskTypeCopy      = "Copy"
-	TaskTypeMove      = "Move"
-	TaskTypeSearch    = "Search"
-	TaskTypeDelete    = "Delete"
-	TaskTypeUnarchive = "Unarchive"
-	TaskTypeArchive   = "Archive"
-	TaskStateRunning  = "Running"
-	TaskStateComplete = "Complete"
-	TaskStateError    = "Error"
-	TaskStateAnalyze  = "Analyze"
+	TaskTypeCopy           = "Copy"
+	TaskTypeMove           = "Move"
+	TaskTypeSearch         = "Search"
+	TaskTypeDelete         = "Delete"
+	TaskTypeUnarchive      = "Unarchive"
+	TaskTypeArchive        = "Archive"
+	TaskTypeDiskUsage      = "DiskUsage"
+	TaskTypeFindDuplicates = "FindDuplicates"
+	TaskTypeSync           = "Sync"
+	TaskTypeArchiveTest    = "ArchiveTest"
+	TaskTypeAudioTag       = "AudioTag"
+	TaskStateRunning       = "Running"
+	TaskStateComplete      = "Complete"
+	TaskStateError         = "Error"
+	TaskStateAnalyze       = "Analyze"
+	TaskStateNeedPassword  = "NeedPassword"
+	TaskStateWaiting       = "Waiting"
 )
 
 type Task interface {
@@ -149,6 +156,26 @@ func (q *TaskQueryBuilder) Query() []Task {
 					if _, ok := i.(*ExtractTask); ok {
 						return true
 					}
+				case TaskTypeDiskUsage:
+					if _, ok := i.(*DiskUsageTask); ok {
+						return true
+					}
+				case TaskTypeFindDuplicates:
+					if _, ok := i.(*FindDuplicatesTask); ok {
+						return true
+					}
+				case TaskTypeSync:
+					if _, ok := i.(*SyncTask); ok {
+						return true
+					}
+				case TaskTypeArchiveTest:
+					if _, ok := i.(*ArchiveTestTask); ok {
+						return true
+					}
+				case TaskTypeAudioTag:
+					if _, ok := i.(*AudioTagTask); ok {
+						return true
+					}
 				}
 			}
 			return false
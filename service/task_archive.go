@@ -1,46 +1,85 @@
 package service
 
 import (
-	"github.com/mholt/archiver/v3"
-	"github.com/sirupsen/logrus"
+	"errors"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var ExtractTaskNotWaitingPassword = errors.New("task is not waiting for password")
+
 type ExtractInput struct {
-	Input    string
-	Output   string
-	Password string
+	Input     string
+	Output    string
+	Password  string
+	Selection *ExtractSelection
+	// volumes of archive set, filled when task created
+	Volumes []string
 }
 type ExtractTaskOption struct {
 	OnComplete            func(id string)
+	OnError               func(task *ExtractTask)
 	OnFileExtractComplete func(id string, output string)
-	DisplayPath           map[string]string
+	// task is waiting for password by SupplyPassword
+	OnNeedPassword func(task *ExtractTask)
+	// try passwords saved by user before ask for password
+	UseSavedPasswords bool
+	DisplayPath       map[string]string
 }
 type ExtractTask struct {
 	TaskInfo
-	Input      []*ExtractInput    `json:"-"`
-	Option     *ExtractTaskOption `json:"-"`
-	OnComplete func(id string)    `json:"-"`
-	Output     *ExtractTaskOutput
+	Input        []*ExtractInput    `json:"-"`
+	Option       *ExtractTaskOption `json:"-"`
+	Output       *ExtractTaskOutput
+	passwordChan chan extractPasswordReply
 	sync.Mutex
 }
+type extractPasswordReply struct {
+	password string
+	save     bool
+}
+type ExtractInputState struct {
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	TotalSize     int64  `json:"total_size"`
+	CompleteSize  int64  `json:"complete_size"`
+	TotalEntry    int64  `json:"total_entry"`
+	CompleteEntry int64  `json:"complete_entry"`
+}
 type ExtractTaskOutput struct {
-	Complete int `json:"complete"`
-	Total    int `json:"total"`
+	Complete      int                  `json:"complete"`
+	Total         int                  `json:"total"`
+	TotalSize     int64                `json:"total_size"`
+	CompleteSize  int64                `json:"complete_size"`
+	CompleteEntry int64                `json:"complete_entry"`
+	CurrentEntry  string               `json:"current_entry"`
+	Progress      float64              `json:"progress"`
+	Speed         int64                `json:"speed"`
+	Inputs        []*ExtractInputState `json:"inputs"`
 }
 
 func (t *TaskPool) NewExtractTask(input []*ExtractInput, option ExtractTaskOption, username string) *ExtractTask {
 	taskInfo := t.createTask(username)
 	taskInfo.Type = TaskTypeUnarchive
 	taskInfo.Status = TaskStateRunning
+	input = dedupExtractVolumes(input)
 	task := &ExtractTask{
-		TaskInfo: taskInfo,
-		Input:    input,
-		Option:   &option,
+		TaskInfo:     taskInfo,
+		Input:        input,
+		Option:       &option,
+		passwordChan: make(chan extractPasswordReply, 1),
 	}
 	o := &ExtractTaskOutput{
 		Total:    len(input),
 		Complete: 0,
+		Inputs:   make([]*ExtractInputState, 0),
+	}
+	for range input {
+		o.Inputs = append(o.Inputs, &ExtractInputState{Status: TaskStateWaiting})
 	}
 	task.Output = o
 	t.Lock()
@@ -48,71 +87,650 @@ func (t *TaskPool) NewExtractTask(input []*ExtractInput, option ExtractTaskOptio
 	t.Unlock()
 	return task
 }
+
+// dedupExtractVolumes fill volumes of inputs and drop input extracting volume set already in list,
+// e.g. movie.part1.rar and movie.part2.rar selected together
+func dedupExtractVolumes(input []*ExtractInput) []*ExtractInput {
+	result := make([]*ExtractInput, 0)
+	exist := map[string]bool{}
+	for _, extractInput := range input {
+		volumes, err := ResolveArchiveVolumes(extractInput.Input)
+		if err != nil {
+			// error is reported when input extracted
+			result = append(result, extractInput)
+			continue
+		}
+		extractInput.Volumes = volumes.Volumes
+		key := volumes.First + "\x00" + extractInput.Output
+		if exist[key] {
+			continue
+		}
+		exist[key] = true
+		result = append(result, extractInput)
+	}
+	return result
+}
+
+// updateInputState copy progress of notifier to state of input, should be called with lock held
+func (t *ExtractTask) updateInputState(state *ExtractInputState, notifier *ArchiveNotifier) {
+	state.TotalSize = atomic.LoadInt64(&notifier.TotalSize)
+	state.CompleteSize = atomic.LoadInt64(&notifier.CompleteSize)
+	state.TotalEntry = atomic.LoadInt64(&notifier.TotalEntry)
+	state.CompleteEntry = atomic.LoadInt64(&notifier.CompleteEntry)
+	t.Output.CurrentEntry = notifier.CurrentEntry()
+	var progress float64
+	t.Output.TotalSize = 0
+	t.Output.CompleteSize = 0
+	t.Output.CompleteEntry = 0
+	for _, inputState := range t.Output.Inputs {
+		t.Output.TotalSize += inputState.TotalSize
+		t.Output.CompleteSize += inputState.CompleteSize
+		t.Output.CompleteEntry += inputState.CompleteEntry
+		switch {
+		case inputState.Status == TaskStateComplete:
+			progress += 1
+		case inputState.TotalSize > 0:
+			progress += float64(inputState.CompleteSize) / float64(inputState.TotalSize)
+		}
+	}
+	t.Output.Progress = progress / float64(len(t.Output.Inputs))
+	if t.Output.Progress > 1 {
+		t.Output.Progress = 1
+	}
+}
+
+func isArchiveNeedPassword(err error) bool {
+	return err == ArchivePasswordRequired || err == ArchivePasswordIncorrect
+}
+
+// SupplyPassword continue task waiting for password of input, input is skipped if password is empty.
+// Password is added to saved list of user if save is true and it is correct.
+func (t *ExtractTask) SupplyPassword(password string, save bool) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.Status != TaskStateNeedPassword {
+		return ExtractTaskNotWaitingPassword
+	}
+	select {
+	case t.passwordChan <- extractPasswordReply{password: password, save: save}:
+		return nil
+	default:
+		// password is supplied already
+		return ExtractTaskNotWaitingPassword
+	}
+}
+
+// waitPassword keep task in NeedPassword state until password supplied, return false if task interrupted
+func (t *ExtractTask) waitPassword(state *ExtractInputState, err error, stopChan chan struct{}) (extractPasswordReply, bool) {
+	t.Lock()
+	state.Status = TaskStateNeedPassword
+	state.Error = err.Error()
+	t.Status = TaskStateNeedPassword
+	t.Unlock()
+	if t.Option.OnNeedPassword != nil {
+		t.Option.OnNeedPassword(t)
+	}
+	select {
+	case reply := <-t.passwordChan:
+		t.Lock()
+		state.Status = TaskStateRunning
+		t.Status = TaskStateRunning
+		t.Unlock()
+		return reply, true
+	case <-stopChan:
+		return extractPasswordReply{}, false
+	}
+}
+
 func (t *ExtractTask) Run() {
 	t.Lock()
 	t.Status = TaskStateRunning
 	t.Unlock()
-	for _, input := range t.Input {
-		err := ExtractArchive(ExtractFileOption{
-			Input:    input.Input,
-			Output:   input.Output,
-			Password: input.Password,
+	var notifier *ArchiveNotifier
+	var state *ExtractInputState
+	stopFlag := false
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		var lastComplete int64 = 0
+		for {
+			select {
+			case <-ticker.C:
+				t.Lock()
+				if notifier != nil {
+					t.updateInputState(state, notifier)
+				}
+				t.Output.Speed = t.Output.CompleteSize - lastComplete
+				lastComplete = t.Output.CompleteSize
+				t.Unlock()
+			case <-t.InterruptChan:
+				t.Lock()
+				if !stopFlag {
+					stopFlag = true
+					close(stopChan)
+				}
+				notifier.Stop()
+				t.Unlock()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	// extract input with password, progress of last try is dropped
+	extract := func(input *ExtractInput, password string) error {
+		t.Lock()
+		notifier = &ArchiveNotifier{}
+		currentNotifier := notifier
+		t.Unlock()
+		return ExtractArchive(ExtractFileOption{
+			Input:     input.Input,
+			Output:    input.Output,
+			Password:  password,
+			Selection: input.Selection,
+			Notifier:  currentNotifier,
 		})
+	}
+	isStop := func() bool {
+		t.Lock()
+		defer t.Unlock()
+		return stopFlag
+	}
+	var firstErr error
+	for idx, input := range t.Input {
+		t.Lock()
+		if stopFlag {
+			t.Unlock()
+			break
+		}
+		state = t.Output.Inputs[idx]
+		state.Status = TaskStateRunning
+		t.Unlock()
+		err := extract(input, input.Password)
+		if isArchiveNeedPassword(err) && t.Option.UseSavedPasswords {
+			for _, password := range getSavedArchivePasswords(t.Username) {
+				if password == input.Password {
+					continue
+				}
+				if isStop() {
+					break
+				}
+				err = extract(input, password)
+				if !isArchiveNeedPassword(err) {
+					input.Password = password
+					break
+				}
+			}
+		}
+		for isArchiveNeedPassword(err) && !isStop() {
+			reply, ok := t.waitPassword(state, err, stopChan)
+			if !ok || len(reply.password) == 0 {
+				break
+			}
+			err = extract(input, reply.password)
+			if err == nil {
+				input.Password = reply.password
+				if reply.save {
+					_, saveErr := SaveArchivePassword(t.Username, filepath.Base(input.Input), reply.password)
+					if saveErr != nil {
+						archivePasswordLogger.Error(saveErr)
+					}
+				}
+			}
+		}
+		t.Lock()
 		if err != nil {
-			logrus.Error(err)
+			state.Status = TaskStateError
+			state.Error = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			state.Status = TaskStateComplete
+			state.Error = ""
+			t.Output.Complete += 1
 		}
-		t.Output.Complete += 1
-		if t.Option.OnFileExtractComplete != nil {
+		t.updateInputState(state, notifier)
+		t.Unlock()
+		if err == nil && t.Option.OnFileExtractComplete != nil {
 			t.Option.OnFileExtractComplete(t.Id, input.Output)
 		}
 	}
 	t.Lock()
+	interrupted := stopFlag
+	t.Output.Speed = 0
+	t.Output.CurrentEntry = ""
+	t.Unlock()
+	close(doneChan)
+	if interrupted {
+		t.AbortError(ArchiveInterrupt)
+		return
+	}
+	if firstErr != nil {
+		t.AbortError(firstErr)
+		return
+	}
+	t.Lock()
 	t.Status = TaskStateComplete
-	if t.OnComplete != nil {
-		t.OnComplete(t.Id)
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnComplete != nil {
+		t.Option.OnComplete(t.Id)
 	}
+}
+
+func (t *ExtractTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
 	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
+}
 
+type NewArchiveTaskOption struct {
+	Sources []string
+	Target  string
+	// format of target, inferred from name of target if empty
+	Format        string
+	Level         int
+	Password      string
+	EncryptHeader bool
+	Excludes      []string
+	// split target into volumes of size, not split if 0
+	VolumeSize int64
+	Username   string
+	OnComplete func(id string, target string)
+	OnError    func(task *ArchiveTask)
 }
 
 type ArchiveTask struct {
 	TaskInfo
-	Sources    []string                       `json:"sources"`
-	Target     string                         `json:"target"`
-	OnComplete func(id string, target string) `json:"-"`
+	Sources       []string `json:"sources"`
+	Target        string   `json:"target"`
+	Format        string   `json:"format"`
+	Level         int      `json:"level"`
+	Excludes      []string `json:"excludes"`
+	EncryptHeader bool     `json:"encrypt_header"`
+	VolumeSize    int64    `json:"volume_size"`
+	password      string
+	OnComplete    func(id string, target string) `json:"-"`
+	OnError       func(task *ArchiveTask)        `json:"-"`
+	Output        *ArchiveTaskOutput
 	sync.Mutex
 }
 
-func (t *TaskPool) NewArchiveTask(source []string, target string, OnComplete func(id string, target string), username string) *ArchiveTask {
-	taskInfo := t.createTask(username)
+type ArchiveTaskOutput struct {
+	TotalSize     int64   `json:"total_size"`
+	CompleteSize  int64   `json:"complete_size"`
+	TotalEntry    int64   `json:"total_entry"`
+	CompleteEntry int64   `json:"complete_entry"`
+	CurrentEntry  string  `json:"current_entry"`
+	Progress      float64 `json:"progress"`
+	Speed         int64   `json:"speed"`
+	// files created for target, more than one if target split
+	Volumes []string `json:"volumes"`
+}
+
+func (t *TaskPool) NewArchiveTask(option *NewArchiveTaskOption) *ArchiveTask {
+	taskInfo := t.createTask(option.Username)
 	taskInfo.Type = TaskTypeArchive
-	taskInfo.Status = TaskStateRunning
+	taskInfo.Status = TaskStateAnalyze
 	task := &ArchiveTask{
-		TaskInfo:   taskInfo,
-		Sources:    source,
-		Target:     target,
-		OnComplete: OnComplete,
+		TaskInfo:      taskInfo,
+		Sources:       option.Sources,
+		Target:        option.Target,
+		Format:        option.Format,
+		Level:         option.Level,
+		Excludes:      option.Excludes,
+		EncryptHeader: option.EncryptHeader,
+		VolumeSize:    option.VolumeSize,
+		password:      option.Password,
+		OnComplete:    option.OnComplete,
+		OnError:       option.OnError,
+		Output:        &ArchiveTaskOutput{Volumes: []string{}},
 	}
 	t.Lock()
 	t.Tasks = append(t.Tasks, task)
 	t.Unlock()
 	return task
 }
+
+func (t *ArchiveTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.OnError != nil {
+		t.OnError(t)
+	}
+}
+
+// updateOutput copy progress of notifier to output, should be called with lock held
+func (t *ArchiveTask) updateOutput(notifier *ArchiveNotifier) {
+	t.Output.TotalSize = atomic.LoadInt64(&notifier.TotalSize)
+	t.Output.CompleteSize = atomic.LoadInt64(&notifier.CompleteSize)
+	t.Output.TotalEntry = atomic.LoadInt64(&notifier.TotalEntry)
+	t.Output.CompleteEntry = atomic.LoadInt64(&notifier.CompleteEntry)
+	t.Output.CurrentEntry = notifier.CurrentEntry()
+	if t.Output.TotalSize > 0 {
+		t.Output.Progress = float64(t.Output.CompleteSize) / float64(t.Output.TotalSize)
+	}
+}
+
 func (t *ArchiveTask) Run() {
+	notifier := &ArchiveNotifier{}
+	doneChan := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		var lastComplete int64 = 0
+		for {
+			select {
+			case <-ticker.C:
+				t.Lock()
+				t.updateOutput(notifier)
+				t.Output.Speed = t.Output.CompleteSize - lastComplete
+				lastComplete = t.Output.CompleteSize
+				t.Unlock()
+			case <-t.InterruptChan:
+				notifier.Stop()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	defer close(doneChan)
+	totalSize, totalEntry, err := analyzeCompressSource(t.Sources, t.Excludes)
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	notifier.SetTotal(totalSize, totalEntry)
 	t.Lock()
 	t.Status = TaskStateRunning
+	t.updateOutput(notifier)
+	t.Unlock()
+	err = CompressArchive(CompressFileOption{
+		Sources:       t.Sources,
+		Output:        t.Target,
+		Format:        t.Format,
+		Level:         t.Level,
+		Password:      t.password,
+		Excludes:      t.Excludes,
+		EncryptHeader: t.EncryptHeader,
+		VolumeSize:    t.VolumeSize,
+		Notifier:      notifier,
+	})
+	t.Lock()
+	t.updateOutput(notifier)
+	t.Output.Speed = 0
+	t.Output.CurrentEntry = ""
 	t.Unlock()
-	err := archiver.Archive(t.Sources, t.Target)
 	if err != nil {
-		t.Lock()
-		t.Error = err
-		t.Status = TaskStateError
-		t.Unlock()
+		t.AbortError(err)
+		return
 	}
+	volumes := ArchiveOutputVolumes(t.Target)
 	t.Lock()
+	t.Output.Volumes = volumes
+	t.Output.Progress = 1
 	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
 	if t.OnComplete != nil {
 		t.OnComplete(t.Id, t.Target)
 	}
+}
+
+var ArchiveTestFailed = errors.New("archive test found broken archive")
+
+type NewArchiveTestTaskOption struct {
+	// archives or folders contain archives
+	Sources     []string
+	Password    string
+	DisplayPath map[string]string
+	Username    string
+	OnComplete  func(task *ArchiveTestTask)
+	OnError     func(task *ArchiveTestTask)
+}
+
+// ArchiveTestTask verify archives without extract them
+type ArchiveTestTask struct {
+	TaskInfo
+	Sources  []string                  `json:"sources"`
+	Option   *NewArchiveTestTaskOption `json:"-"`
+	Archives []string                  `json:"-"`
+	Output   *ArchiveTestTaskOutput
+	sync.Mutex
+}
+
+type ArchiveTestState struct {
+	Path          string                `json:"path"`
+	Status        string                `json:"status"`
+	Error         string                `json:"error,omitempty"`
+	WrongPassword bool                  `json:"wrong_password"`
+	Failures      []*ArchiveTestFailure `json:"failures"`
+	TotalSize     int64                 `json:"total_size"`
+	CompleteSize  int64                 `json:"complete_size"`
+}
+
+type ArchiveTestTaskOutput struct {
+	Complete     int                 `json:"complete"`
+	Total        int                 `json:"total"`
+	Failed       int                 `json:"failed"`
+	TotalSize    int64               `json:"total_size"`
+	CompleteSize int64               `json:"complete_size"`
+	CurrentEntry string              `json:"current_entry"`
+	Progress     float64             `json:"progress"`
+	Speed        int64               `json:"speed"`
+	Archives     []*ArchiveTestState `json:"archives"`
+}
+
+func (t *TaskPool) NewArchiveTestTask(option *NewArchiveTestTaskOption) *ArchiveTestTask {
+	taskInfo := t.createTask(option.Username)
+	taskInfo.Type = TaskTypeArchiveTest
+	taskInfo.Status = TaskStateAnalyze
+	task := &ArchiveTestTask{
+		TaskInfo: taskInfo,
+		Sources:  option.Sources,
+		Option:   option,
+		Archives: []string{},
+		Output: &ArchiveTestTaskOutput{
+			Archives: []*ArchiveTestState{},
+		},
+	}
+	t.Lock()
+	t.Tasks = append(t.Tasks, task)
+	t.Unlock()
+	return task
+}
+
+// findTestArchives return first volume of archives in sources, folders are searched recursively
+func findTestArchives(sources []string) ([]string, error) {
+	archives := make([]string, 0)
+	exist := map[string]bool{}
+	addArchive := func(path string, explicit bool) {
+		volumes, err := ResolveArchiveVolumes(path)
+		if err != nil {
+			if explicit {
+				// error is reported when archive tested
+				archives = append(archives, path)
+			}
+			return
+		}
+		if !explicit && len(ArchiveFormatOf(volumes.Name)) == 0 {
+			return
+		}
+		if exist[volumes.First] {
+			return
+		}
+		exist[volumes.First] = true
+		archives = append(archives, volumes.First)
+	}
+	for _, source := range sources {
+		stat, err := AppFs.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			addArchive(source, true)
+			continue
+		}
+		err = afero.Walk(AppFs, source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsPermission(err) {
+					return nil
+				}
+				return err
+			}
+			if info.Mode().IsRegular() {
+				addArchive(path, false)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return archives, nil
+}
+
+// updateArchiveState copy progress of notifier to state of archive, should be called with lock held
+func (t *ArchiveTestTask) updateArchiveState(state *ArchiveTestState, notifier *ArchiveNotifier) {
+	state.TotalSize = atomic.LoadInt64(&notifier.TotalSize)
+	state.CompleteSize = atomic.LoadInt64(&notifier.CompleteSize)
+	t.Output.CurrentEntry = notifier.CurrentEntry()
+	var progress float64
+	t.Output.TotalSize = 0
+	t.Output.CompleteSize = 0
+	for _, archiveState := range t.Output.Archives {
+		t.Output.TotalSize += archiveState.TotalSize
+		t.Output.CompleteSize += archiveState.CompleteSize
+		switch {
+		case archiveState.Status == TaskStateComplete || archiveState.Status == TaskStateError:
+			progress += 1
+		case archiveState.TotalSize > 0:
+			progress += float64(archiveState.CompleteSize) / float64(archiveState.TotalSize)
+		}
+	}
+	t.Output.Progress = progress / float64(len(t.Output.Archives))
+	if t.Output.Progress > 1 {
+		t.Output.Progress = 1
+	}
+}
+
+func (t *ArchiveTestTask) Run() {
+	var notifier *ArchiveNotifier
+	var state *ArchiveTestState
+	stopFlag := false
+	doneChan := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		var lastComplete int64 = 0
+		for {
+			select {
+			case <-ticker.C:
+				t.Lock()
+				if notifier != nil {
+					t.updateArchiveState(state, notifier)
+				}
+				t.Output.Speed = t.Output.CompleteSize - lastComplete
+				lastComplete = t.Output.CompleteSize
+				t.Unlock()
+			case <-t.InterruptChan:
+				t.Lock()
+				stopFlag = true
+				notifier.Stop()
+				t.Unlock()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	defer close(doneChan)
+	archives, err := findTestArchives(t.Sources)
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	t.Lock()
+	t.Archives = archives
+	t.Output.Total = len(archives)
+	for _, archive := range archives {
+		t.Output.Archives = append(t.Output.Archives, &ArchiveTestState{
+			Path:     archive,
+			Status:   TaskStateWaiting,
+			Failures: []*ArchiveTestFailure{},
+		})
+	}
+	t.Status = TaskStateRunning
 	t.Unlock()
+	for idx, archive := range archives {
+		t.Lock()
+		if stopFlag {
+			t.Unlock()
+			break
+		}
+		notifier = &ArchiveNotifier{}
+		state = t.Output.Archives[idx]
+		state.Status = TaskStateRunning
+		t.Unlock()
+		result, err := TestArchive(archive, t.Option.Password, notifier)
+		t.Lock()
+		if result != nil {
+			state.Failures = result.Failures
+			state.WrongPassword = result.WrongPassword
+		}
+		if err != nil {
+			state.Error = err.Error()
+		}
+		if err != nil || len(state.Failures) > 0 || state.WrongPassword {
+			state.Status = TaskStateError
+			t.Output.Failed += 1
+		} else {
+			state.Status = TaskStateComplete
+		}
+		t.Output.Complete += 1
+		t.updateArchiveState(state, notifier)
+		t.Unlock()
+	}
+	t.Lock()
+	interrupted := stopFlag
+	failed := t.Output.Failed
+	t.Output.Speed = 0
+	t.Output.CurrentEntry = ""
+	t.Unlock()
+	if interrupted {
+		t.AbortError(ArchiveInterrupt)
+		return
+	}
+	if failed > 0 {
+		t.AbortError(ArchiveTestFailed)
+		return
+	}
+	t.Lock()
+	t.Output.Progress = 1
+	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnComplete != nil {
+		t.Option.OnComplete(t)
+	}
+}
+
+func (t *ArchiveTestTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
 }
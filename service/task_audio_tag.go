@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	AudioTagInterrupt   = errors.New("audio tag task interrupted")
+	AudioTagFailed      = errors.New("tag of some files are not written")
+	AudioTagNoUndo      = errors.New("audio tag task has nothing to undo")
+	AudioTagTaskRunning = errors.New("audio tag task is still running")
+)
+
+type AudioTagFileState struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// edit restore tag before this task, nil if file is not written
+	Original *AudioTagEdit `json:"-"`
+}
+
+type AudioTagTaskOutput struct {
+	FileCount int                  `json:"file_count"`
+	Complete  int                  `json:"complete"`
+	Failed    int                  `json:"failed"`
+	Progress  float64              `json:"progress"`
+	Current   string               `json:"current"`
+	Files     []*AudioTagFileState `json:"files"`
+}
+
+type NewAudioTagTaskOption struct {
+	Files []string
+	Edit  *AudioTagEdit
+	// edit of each file, used by undo to restore tags which differ by file
+	FileEdits   map[string]*AudioTagEdit
+	UndoOf      string
+	DisplayPath map[string]string
+	Username    string
+	OnComplete  func(task *AudioTagTask)
+	OnError     func(task *AudioTagTask)
+}
+
+// AudioTagTask write same tag fields to audio files, original values are kept for undo
+type AudioTagTask struct {
+	TaskInfo
+	Option *NewAudioTagTaskOption
+	Output *AudioTagTaskOutput
+	// id of task this task undo
+	UndoOf string `json:"undo_of,omitempty"`
+	sync.Mutex
+}
+
+// NewAudioTagTask create task write tag to files, file given more than once is written once,
+// or the tag written by first pass would be kept as original for undo
+func (t *TaskPool) NewAudioTagTask(option *NewAudioTagTaskOption) *AudioTagTask {
+	files := make([]string, 0, len(option.Files))
+	seen := map[string]bool{}
+	for _, path := range option.Files {
+		if seen[filepath.Clean(path)] {
+			continue
+		}
+		seen[filepath.Clean(path)] = true
+		files = append(files, path)
+	}
+	option.Files = files
+	taskInfo := t.createTask(option.Username)
+	taskInfo.Type = TaskTypeAudioTag
+	taskInfo.Status = TaskStateRunning
+	task := &AudioTagTask{
+		TaskInfo: taskInfo,
+		Option:   option,
+		UndoOf:   option.UndoOf,
+		Output: &AudioTagTaskOutput{
+			FileCount: len(option.Files),
+			Files:     []*AudioTagFileState{},
+		},
+	}
+	for _, path := range option.Files {
+		task.Output.Files = append(task.Output.Files, &AudioTagFileState{Path: path, Status: TaskStateWaiting})
+	}
+	t.Lock()
+	t.Tasks = append(t.Tasks, task)
+	t.Unlock()
+	return task
+}
+
+// NewAudioTagUndoTask create task restore tags of files written by task
+func (t *TaskPool) NewAudioTagUndoTask(task *AudioTagTask, option *NewAudioTagTaskOption) (*AudioTagTask, error) {
+	task.Lock()
+	defer task.Unlock()
+	if task.Status == TaskStateRunning {
+		return nil, AudioTagTaskRunning
+	}
+	option.Files = []string{}
+	option.FileEdits = map[string]*AudioTagEdit{}
+	option.UndoOf = task.Id
+	if option.DisplayPath == nil {
+		option.DisplayPath = task.Option.DisplayPath
+	}
+	for _, file := range task.Output.Files {
+		// original of path is taken before first write of it
+		if _, exist := option.FileEdits[file.Path]; file.Original == nil || exist {
+			continue
+		}
+		option.Files = append(option.Files, file.Path)
+		option.FileEdits[file.Path] = file.Original
+	}
+	if len(option.Files) == 0 {
+		return nil, AudioTagNoUndo
+	}
+	return t.NewAudioTagTask(option), nil
+}
+
+func (t *AudioTagTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
+}
+
+func (t *AudioTagTask) Run() {
+	stopFlag := false
+	doneChan := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.InterruptChan:
+				t.Lock()
+				stopFlag = true
+				t.Unlock()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	defer close(doneChan)
+	for _, state := range t.Output.Files {
+		t.Lock()
+		if stopFlag {
+			t.Unlock()
+			break
+		}
+		state.Status = TaskStateRunning
+		t.Output.Current = state.Path
+		t.Unlock()
+		edit := t.Option.Edit
+		if fileEdit, exist := t.Option.FileEdits[state.Path]; exist {
+			edit = fileEdit
+		}
+		original, err := ReadAudioTag(state.Path)
+		var raw *rawAudioTag
+		if err == nil {
+			raw, err = readRawAudioTag(state.Path)
+		}
+		if err == nil {
+			err = WriteAudioTag(state.Path, edit)
+		}
+		t.Lock()
+		if err != nil {
+			state.Status = TaskStateError
+			state.Error = err.Error()
+			t.Output.Failed += 1
+		} else {
+			state.Status = TaskStateComplete
+			state.Original = edit.Revert(original, raw)
+		}
+		t.Output.Complete += 1
+		t.Output.Progress = float64(t.Output.Complete) / float64(t.Output.FileCount)
+		t.Unlock()
+	}
+	t.Lock()
+	interrupted := stopFlag
+	failed := t.Output.Failed
+	t.Output.Current = ""
+	t.Unlock()
+	if interrupted {
+		t.AbortError(AudioTagInterrupt)
+		return
+	}
+	if failed > 0 {
+		t.AbortError(AudioTagFailed)
+		return
+	}
+	t.Lock()
+	t.Output.Progress = 1
+	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnComplete != nil {
+		t.Option.OnComplete(t)
+	}
+}
@@ -35,6 +35,7 @@ type CopyFileTaskOutput struct {
 	CurrentCopy    string        `json:"current_copy"`
 	Progress       float64       `json:"progress"`
 	Speed          int64         `json:"speed"`
+	QuotaWarning   string        `json:"quota_warning,omitempty"`
 }
 
 func (t *TaskPool) NewCopyTask(option *NewCopyTaskOption) Task {
@@ -74,8 +75,20 @@ func (t *CopyTask) Run() {
 		}
 		infos = append(infos, copyInfo)
 	}
+	requirement := map[string]int64{}
+	for idx, option := range t.Option.Options {
+		requirement[option.Dest] += infos[idx].TotalSize
+	}
+	quotaWarning, err := CheckQuota(t.Username, requirement)
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
 
 	t.Lock()
+	if quotaWarning != nil {
+		t.Output.QuotaWarning = quotaWarning.Error()
+	}
 	t.Output.FileCount = 0
 	t.Output.TotalLength = 0
 	for _, info := range infos {
@@ -145,7 +158,7 @@ func (t *CopyTask) Run() {
 			}
 		}
 	}()
-	for _, option := range t.Option.Options {
+	for idx, option := range t.Option.Options {
 		err := Copy(option.Src, option.Dest, notifier, t.Option.OnDuplicate)
 		if err == util.CopyInterrupt {
 			break
@@ -154,6 +167,7 @@ func (t *CopyTask) Run() {
 			t.AbortError(err)
 			return
 		}
+		AddQuotaUsage(t.Username, option.Dest, infos[idx].TotalSize)
 		if option.OnComplete != nil {
 			option.OnComplete(t.Id)
 		}
@@ -117,7 +117,7 @@ func (t *DeleteFileTask) Run() {
 			}
 		}
 	}()
-	for _, deleteSrc := range t.Output.Src {
+	for idx, deleteSrc := range t.Output.Src {
 		err := Delete(deleteSrc, notifier)
 		if err != nil {
 			if err == DeleteInterrupt {
@@ -126,6 +126,7 @@ func (t *DeleteFileTask) Run() {
 			t.AbortError(err)
 			return
 		}
+		AddQuotaUsage(t.Username, deleteSrc, -infos[idx].TotalSize)
 		if t.Option.OnItemComplete != nil {
 			t.Option.OnItemComplete(t.Id, deleteSrc)
 		}
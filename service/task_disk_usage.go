@@ -0,0 +1,127 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type NewDiskUsageTaskOption struct {
+	Src       string
+	TopN      int
+	OnDone    func(task *DiskUsageTask)
+	OnError   func(task *DiskUsageTask)
+	PathTrans string
+	Username  string
+}
+
+type DiskUsageTaskOutput struct {
+	ScanFile    int64            `json:"scan_file"`
+	ScanDir     int64            `json:"scan_dir"`
+	ScanSize    int64            `json:"scan_size"`
+	CurrentPath string           `json:"current_path"`
+	Speed       int64            `json:"speed"`
+	Result      *DiskUsageResult `json:"-"`
+}
+
+type DiskUsageTask struct {
+	TaskInfo
+	Output *DiskUsageTaskOutput
+	Option *NewDiskUsageTaskOption
+	sync.Mutex
+}
+
+func (t *TaskPool) NewDiskUsageTask(option *NewDiskUsageTaskOption) Task {
+	taskInfo := t.createTask(option.Username)
+	taskInfo.Type = TaskTypeDiskUsage
+	taskInfo.Status = TaskStateAnalyze
+	if option.TopN <= 0 {
+		option.TopN = 20
+	}
+	task := DiskUsageTask{
+		TaskInfo: taskInfo,
+		Output:   &DiskUsageTaskOutput{},
+		Option:   option,
+	}
+	t.Lock()
+	t.Tasks = append(t.Tasks, &task)
+	t.Unlock()
+	return &task
+}
+
+func (t *DiskUsageTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
+}
+
+func (t *DiskUsageTask) Run() {
+	notifier := &DiskUsageNotifier{}
+	doneChan := make(chan struct{})
+	// update info
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		var lastScanFile int64 = 0
+		for {
+			select {
+			case <-ticker.C:
+				scanFile := atomic.LoadInt64(&notifier.ScanFile)
+				t.Lock()
+				t.Output.ScanFile = scanFile
+				t.Output.ScanDir = atomic.LoadInt64(&notifier.ScanDir)
+				t.Output.ScanSize = atomic.LoadInt64(&notifier.ScanSize)
+				if currentPath, ok := notifier.CurrentPath.Load().(string); ok {
+					t.Output.CurrentPath = currentPath
+				}
+				t.Output.Speed = scanFile - lastScanFile
+				t.Unlock()
+				lastScanFile = scanFile
+			case <-t.InterruptChan:
+				notifier.Stop()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	result, err := ScanDiskUsage(t.Option.Src, t.Option.TopN, notifier)
+	doneChan <- struct{}{}
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	t.Lock()
+	t.Output.Result = result
+	t.Output.ScanFile = result.Root.FileCount
+	t.Output.ScanDir = result.Root.DirCount
+	t.Output.ScanSize = result.Root.Size
+	t.Output.CurrentPath = ""
+	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnDone != nil {
+		t.Option.OnDone(t)
+	}
+}
+
+// QueryNode return node of cached result with direct children for drill-down
+func (t *DiskUsageTask) QueryNode(target string, limit int) (*DiskUsageNode, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.Output.Result == nil {
+		return nil, DiskUsageNodeNotFound
+	}
+	if len(target) == 0 {
+		target = t.Option.Src
+	}
+	node, err := t.Output.Result.FindNode(target)
+	if err != nil {
+		return nil, err
+	}
+	return node.Shallow(limit), nil
+}
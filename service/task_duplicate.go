@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"sync"
+)
+
+var DuplicateGroupNotFound = errors.New("duplicate group not found")
+
+type NewFindDuplicatesTaskOption struct {
+	Src         []string
+	MinSize     int64
+	OnDone      func(task *FindDuplicatesTask)
+	OnError     func(task *FindDuplicatesTask)
+	DisplayPath map[string]string
+	Username    string
+}
+
+type FindDuplicatesTaskOutput struct {
+	Phase       string            `json:"phase"`
+	ScanFile    int               `json:"scan_file"`
+	HashTotal   int               `json:"hash_total"`
+	HashFile    int               `json:"hash_file"`
+	CurrentFile string            `json:"current_file"`
+	Progress    float64           `json:"progress"`
+	GroupCount  int               `json:"group_count"`
+	WastedSize  int64             `json:"wasted_size"`
+	Groups      []*DuplicateGroup `json:"-"`
+}
+
+type FindDuplicatesTask struct {
+	TaskInfo
+	Output *FindDuplicatesTaskOutput
+	Option *NewFindDuplicatesTaskOption
+	sync.Mutex
+}
+
+func (t *TaskPool) NewFindDuplicatesTask(option *NewFindDuplicatesTaskOption) Task {
+	taskInfo := t.createTask(option.Username)
+	taskInfo.Type = TaskTypeFindDuplicates
+	taskInfo.Status = TaskStateAnalyze
+	task := FindDuplicatesTask{
+		TaskInfo: taskInfo,
+		Output: &FindDuplicatesTaskOutput{
+			Groups: make([]*DuplicateGroup, 0),
+		},
+		Option: option,
+	}
+	t.Lock()
+	t.Tasks = append(t.Tasks, &task)
+	t.Unlock()
+	return &task
+}
+
+func (t *FindDuplicatesTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
+}
+
+func (t *FindDuplicatesTask) Run() {
+	notifier := &DuplicateNotifier{
+		PhaseChan:     make(chan string),
+		ScanChan:      make(chan string),
+		HashChan:      make(chan string),
+		HashTotalChan: make(chan int),
+	}
+	doneChan := make(chan struct{})
+	// update info
+	go func() {
+		for {
+			select {
+			case phase := <-notifier.PhaseChan:
+				t.Lock()
+				t.Output.Phase = phase
+				t.Output.HashFile = 0
+				t.Output.Progress = 0
+				if phase != DuplicatePhaseScan {
+					t.Status = TaskStateRunning
+				}
+				t.Unlock()
+			case currentFile := <-notifier.ScanChan:
+				t.Lock()
+				t.Output.ScanFile += 1
+				t.Output.CurrentFile = currentFile
+				t.Unlock()
+			case total := <-notifier.HashTotalChan:
+				t.Lock()
+				t.Output.HashTotal = total
+				t.Unlock()
+			case currentFile := <-notifier.HashChan:
+				t.Lock()
+				t.Output.HashFile += 1
+				t.Output.CurrentFile = currentFile
+				if t.Output.HashTotal > 0 {
+					t.Output.Progress = float64(t.Output.HashFile) / float64(t.Output.HashTotal)
+				}
+				t.Unlock()
+			case <-t.InterruptChan:
+				t.Lock()
+				notifier.StopFlag = true
+				t.Unlock()
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	groups, err := FindDuplicates(FindDuplicatesOption{
+		Src:     t.Option.Src,
+		MinSize: t.Option.MinSize,
+	}, notifier)
+	doneChan <- struct{}{}
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	t.Lock()
+	t.Output.Groups = groups
+	t.Output.GroupCount = len(groups)
+	t.Output.WastedSize = 0
+	for _, group := range groups {
+		t.Output.WastedSize += group.Wasted()
+	}
+	t.Output.CurrentFile = ""
+	t.Output.Progress = 1
+	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnDone != nil {
+		t.Option.OnDone(t)
+	}
+}
+
+// GetGroups return page of duplicate groups
+func (t *FindDuplicatesTask) GetGroups(page int, pageSize int) ([]*DuplicateGroup, int) {
+	t.Lock()
+	defer t.Unlock()
+	total := len(t.Output.Groups)
+	if pageSize <= 0 {
+		return t.Output.Groups, total
+	}
+	start := (page - 1) * pageSize
+	if start < 0 {
+		start = 0
+	}
+	if start >= total {
+		return []*DuplicateGroup{}, total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return t.Output.Groups[start:end], total
+}
+
+// Resolve apply action to groups, resolve all groups if groupIds is empty
+func (t *FindDuplicatesTask) Resolve(groupIds []int, option ResolveDuplicateOption) (map[int][]*ResolveDuplicateResult, error) {
+	t.Lock()
+	defer t.Unlock()
+	targets := make([]*DuplicateGroup, 0)
+	if len(groupIds) == 0 {
+		for _, group := range t.Output.Groups {
+			if !group.Resolved {
+				targets = append(targets, group)
+			}
+		}
+	}
+	for _, groupId := range groupIds {
+		if groupId < 0 || groupId >= len(t.Output.Groups) {
+			return nil, DuplicateGroupNotFound
+		}
+		targets = append(targets, t.Output.Groups[groupId])
+	}
+	results := map[int][]*ResolveDuplicateResult{}
+	for _, group := range targets {
+		groupResult, err := ResolveDuplicate(group, option)
+		if err != nil {
+			results[group.Id] = []*ResolveDuplicateResult{{Error: err.Error()}}
+			continue
+		}
+		results[group.Id] = groupResult
+	}
+	t.Output.WastedSize = 0
+	for _, group := range t.Output.Groups {
+		if !group.Resolved {
+			t.Output.WastedSize += group.Wasted()
+		}
+	}
+	return results, nil
+}
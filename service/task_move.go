@@ -74,6 +74,16 @@ func (t *MoveTask) Run() {
 		}
 		infos = append(infos, copyInfo)
 	}
+	requirement := map[string]int64{}
+	for idx, option := range t.Option.Options {
+		requirement[option.Src] -= infos[idx].TotalSize
+		requirement[option.Dest] += infos[idx].TotalSize
+	}
+	_, err := CheckQuota(t.Username, requirement)
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
 
 	t.Lock()
 	t.Output.FileCount = 0
@@ -145,7 +155,7 @@ func (t *MoveTask) Run() {
 			}
 		}
 	}()
-	for _, option := range t.Option.Options {
+	for idx, option := range t.Option.Options {
 		err := Move(option.Src, option.Dest, notifier, t.Option.OnDuplicate)
 		if err == util.CopyInterrupt {
 			break
@@ -154,6 +164,8 @@ func (t *MoveTask) Run() {
 			t.AbortError(err)
 			return
 		}
+		AddQuotaUsage(t.Username, option.Src, -infos[idx].TotalSize)
+		AddQuotaUsage(t.Username, option.Dest, infos[idx].TotalSize)
 		if option.OnComplete != nil {
 			option.OnComplete(t.Id)
 		}
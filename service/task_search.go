@@ -13,6 +13,7 @@ type NewSearchTaskOption struct {
 	Src       string
 	Key       string
 	Limit     int
+	Filter    *ImageMetaFilter
 	OnDone    func(id string)
 	OnHit     func(id string, path string, name string, itemType string)
 	PathTrans string
@@ -73,7 +74,7 @@ func (t *SearchFileTask) Run() {
 			}
 		}
 	}()
-	_, err := SearchFile(t.Option.Src, t.Option.Key, notifier, t.Option.Limit)
+	_, err := SearchFile(t.Option.Src, t.Option.Key, t.Option.Filter, notifier, t.Option.Limit)
 	doneSearchChan <- struct{}{}
 	t.Lock()
 	if err != nil {
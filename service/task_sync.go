@@ -0,0 +1,284 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	SyncPhaseAnalyze = "Analyze"
+	SyncPhaseSync    = "Sync"
+)
+
+var SyncDiffNotReady = errors.New("sync diff is not ready")
+
+type NewSyncTaskOption struct {
+	SyncOption
+	DryRun      bool
+	OnDone      func(task *SyncTask)
+	OnError     func(task *SyncTask)
+	DisplayPath map[string]string
+	Username    string
+}
+
+type SyncTaskOutput struct {
+	Phase          string    `json:"phase"`
+	ScanCount      int       `json:"scan_count"`
+	Added          int       `json:"added"`
+	Changed        int       `json:"changed"`
+	Deleted        int       `json:"deleted"`
+	Conflict       int       `json:"conflict"`
+	Skipped        int       `json:"skipped"`
+	TotalLength    int64     `json:"total_length"`
+	CompleteLength int64     `json:"complete_length"`
+	FileCount      int       `json:"file_count"`
+	Complete       int       `json:"complete"`
+	CurrentFile    string    `json:"current_file"`
+	Progress       float64   `json:"progress"`
+	Speed          int64     `json:"speed"`
+	DryRun         bool      `json:"dry_run"`
+	Errors         []string  `json:"errors"`
+	Diff           *SyncDiff `json:"-"`
+}
+
+type SyncTask struct {
+	TaskInfo
+	Output *SyncTaskOutput
+	Option *NewSyncTaskOption
+	sync.Mutex
+}
+
+func (t *TaskPool) NewSyncTask(option *NewSyncTaskOption) Task {
+	taskInfo := t.createTask(option.Username)
+	taskInfo.Type = TaskTypeSync
+	taskInfo.Status = TaskStateAnalyze
+	task := SyncTask{
+		TaskInfo: taskInfo,
+		Output: &SyncTaskOutput{
+			Phase:  SyncPhaseAnalyze,
+			DryRun: option.DryRun,
+			Errors: make([]string, 0),
+		},
+		Option: option,
+	}
+	t.Lock()
+	t.Tasks = append(t.Tasks, &task)
+	t.Unlock()
+	return &task
+}
+
+func (t *SyncTask) AbortError(err error) {
+	t.Lock()
+	t.Error = err
+	t.Status = TaskStateError
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnError != nil {
+		t.Option.OnError(t)
+	}
+}
+
+func (t *SyncTask) complete() {
+	t.Lock()
+	t.Status = TaskStateComplete
+	t.UpdateStopTime()
+	t.Unlock()
+	if t.Option.OnDone != nil {
+		t.Option.OnDone(t)
+	}
+}
+
+func (t *SyncTask) Run() {
+	// analyze
+	syncNotifier := &SyncNotifier{
+		ScanChan: make(chan string),
+	}
+	analyzeDoneChan := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case currentFile := <-syncNotifier.ScanChan:
+				t.Lock()
+				t.Output.ScanCount += 1
+				t.Output.CurrentFile = currentFile
+				t.Unlock()
+			case <-t.InterruptChan:
+				t.Lock()
+				syncNotifier.StopFlag = true
+				t.Unlock()
+			case <-analyzeDoneChan:
+				return
+			}
+		}
+	}()
+	diff, err := BuildSyncDiff(&t.Option.SyncOption, syncNotifier)
+	analyzeDoneChan <- struct{}{}
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	requirement := map[string]int64{}
+	for _, item := range diff.Items {
+		if item.Skip || item.IsDir {
+			continue
+		}
+		if item.Direction == SyncDirectionToSource {
+			requirement[t.Option.Source] += item.TargetSize - item.SourceSize
+		} else {
+			requirement[t.Option.Target] += item.SourceSize - item.TargetSize
+		}
+	}
+	_, err = CheckQuota(t.Username, requirement)
+	if err != nil {
+		t.AbortError(err)
+		return
+	}
+	t.Lock()
+	t.Output.Diff = diff
+	t.Output.Added = diff.Added
+	t.Output.Changed = diff.Changed
+	t.Output.Deleted = diff.Deleted
+	t.Output.Conflict = diff.Conflict
+	t.Output.Skipped = diff.Skipped
+	t.Output.TotalLength = diff.Size
+	t.Output.FileCount = len(diff.Items) - diff.Skipped
+	t.Output.CurrentFile = ""
+	t.Unlock()
+	if t.Option.DryRun {
+		t.complete()
+		return
+	}
+
+	// apply diff
+	t.Lock()
+	t.Output.Phase = SyncPhaseSync
+	t.Status = TaskStateRunning
+	t.Unlock()
+	notifier := &CopyFileNotifier{
+		CurrentFileChan:   make(chan string),
+		CompleteDeltaChan: make(chan int64),
+		FileCompleteChan:  make(chan string),
+		StopChan:          make(chan struct{}, 1),
+	}
+	syncDoneChan := make(chan struct{})
+	// update info
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		var lastComplete int64 = 0
+		for {
+			select {
+			case currentFile := <-notifier.CurrentFileChan:
+				t.Lock()
+				t.Output.CurrentFile = currentFile
+				t.Unlock()
+			case completeDelta := <-notifier.CompleteDeltaChan:
+				t.Lock()
+				t.Output.CompleteLength += completeDelta
+				if t.Output.TotalLength > 0 {
+					t.Output.Progress = float64(t.Output.CompleteLength) / float64(t.Output.TotalLength)
+				}
+				t.Unlock()
+			case <-notifier.FileCompleteChan:
+			case <-ticker.C:
+				t.Lock()
+				t.Output.Speed = t.Output.CompleteLength - lastComplete
+				lastComplete = t.Output.CompleteLength
+				t.Unlock()
+			case <-t.InterruptChan:
+				t.Lock()
+				notifier.StopFlag = true
+				t.Unlock()
+				notifier.StopChan <- struct{}{}
+			case <-syncDoneChan:
+				return
+			}
+		}
+	}()
+	for _, item := range diff.Items {
+		if item.Skip {
+			continue
+		}
+		t.Lock()
+		stop := notifier.StopFlag
+		t.Unlock()
+		if stop {
+			break
+		}
+		err = ApplySyncItem(&t.Option.SyncOption, item, notifier)
+		t.Lock()
+		if err != nil {
+			t.Output.Errors = append(t.Output.Errors, err.Error())
+		}
+		t.Output.Complete += 1
+		t.Unlock()
+		if err == nil {
+			t.applyQuotaUsage(item)
+		}
+	}
+	syncDoneChan <- struct{}{}
+	t.Lock()
+	stopped := notifier.StopFlag
+	if !stopped {
+		t.Output.CompleteLength = t.Output.TotalLength
+		t.Output.Progress = 1
+	}
+	t.Output.CurrentFile = ""
+	failed := len(t.Output.Errors) > 0
+	t.Unlock()
+	if stopped {
+		t.AbortError(SyncInterrupt)
+		return
+	}
+	if failed {
+		t.AbortError(SyncFailed)
+		return
+	}
+	// baseline is only saved when both sides are same, or deletion would be missed next time
+	if t.Option.Mode == SyncModeBidirectional {
+		err = SaveSyncBaseline(&t.Option.SyncOption)
+		if err != nil {
+			t.AbortError(err)
+			return
+		}
+	}
+	t.complete()
+}
+
+func (t *SyncTask) applyQuotaUsage(item *SyncDiffItem) {
+	if item.IsDir {
+		return
+	}
+	if item.Direction == SyncDirectionToSource {
+		AddQuotaUsage(t.Username, t.Option.Source, item.TargetSize-item.SourceSize)
+		return
+	}
+	AddQuotaUsage(t.Username, t.Option.Target, item.SourceSize-item.TargetSize)
+}
+
+// GetDiff return page of diff items
+func (t *SyncTask) GetDiff(page int, pageSize int) ([]*SyncDiffItem, int, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.Output.Diff == nil {
+		return nil, 0, SyncDiffNotReady
+	}
+	items := t.Output.Diff.Items
+	total := len(items)
+	if pageSize <= 0 {
+		return items, total, nil
+	}
+	start := (page - 1) * pageSize
+	if start < 0 {
+		start = 0
+	}
+	if start >= total {
+		return []*SyncDiffItem{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return items[start:end], total, nil
+}
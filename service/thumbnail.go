@@ -0,0 +1,612 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/chai2010/webp"
+	"github.com/nfnt/resize"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/spf13/afero"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+var (
+	ThumbnailNotSupported   = errors.New("thumbnail of file is not supported")
+	ThumbnailSizeNotFound   = errors.New("thumbnail size not found")
+	ThumbnailNameInvalid    = errors.New("thumbnail name is invalid")
+	ThumbnailSourceFailed   = errors.New("file failed to decode for thumbnail")
+	HeicDecoderNotFound     = errors.New("heic decoder not found")
+	ThumbnailConvertTimeout = errors.New("convert of file for thumbnail timed out")
+)
+
+var ThumbnailSizes = []string{
+	config.ThumbnailSizeSmall,
+	config.ThumbnailSizeMedium,
+	config.ThumbnailSizeLarge,
+}
+
+var AllowGenerateThumbnailImageExtensions = []string{
+	".jpg", ".png", ".jpeg", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".heic", ".heif",
+}
+
+// decoder of gif return first frame
+var thumbnailDecoders = map[string]func(r io.Reader) (image.Image, error){
+	".jpg":  jpeg.Decode,
+	".jpeg": jpeg.Decode,
+	".png":  png.Decode,
+	".gif":  gif.Decode,
+	".webp": webp.Decode,
+	".bmp":  bmp.Decode,
+	".tif":  tiff.Decode,
+	".tiff": tiff.Decode,
+}
+
+func thumbnailDir() string {
+	return config.Instance.Thumbnail.Path
+}
+
+func thumbnailExtension() string {
+	if config.Instance.Thumbnail.Format == config.ThumbnailFormatWebp {
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// thumbnailFilename name thumbnail by checksum of source and size, e.g. <md5>_medium.jpg
+func thumbnailFilename(checksum string, size string) string {
+	return fmt.Sprintf("%s_%s%s", checksum, size, thumbnailExtension())
+}
+
+// thumbnailNamePattern match name made by thumbnailFilename
+var thumbnailNamePattern = regexp.MustCompile(`^[0-9a-f]+_[a-z0-9]+\.(jpg|webp)$`)
+
+// ThumbnailPath return path of thumbnail file by its name, thumbnail of other size is returned if size is not empty
+func ThumbnailPath(name string, size string) (string, error) {
+	if !thumbnailNamePattern.MatchString(name) {
+		return "", ThumbnailNameInvalid
+	}
+	if len(size) > 0 {
+		if _, exist := config.Instance.Thumbnail.Sizes[size]; !exist {
+			return "", ThumbnailSizeNotFound
+		}
+		idx := strings.LastIndex(name, "_")
+		if idx < 0 {
+			return "", ThumbnailSizeNotFound
+		}
+		name = thumbnailFilename(name[:idx], size)
+	}
+	return filepath.Join(thumbnailDir(), name), nil
+}
+
+func isThumbnailSupported(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".heic" || ext == ".heif" {
+		return len(findHeicDecoder()) > 0
+	}
+	if isPdf(path) {
+		return len(findPdfRenderer()) > 0
+	}
+	if isTextPreviewSupported(path) || IsAudioTagSupported(path) {
+		return true
+	}
+	return linq.From(AllowGenerateThumbnailImageExtensions).Contains(ext)
+}
+
+// findHeicDecoder return path of heic decoder in config, or one of libheif tools in PATH
+func findHeicDecoder() string {
+	if len(config.Instance.Thumbnail.HeicDecoder) > 0 {
+		return config.Instance.Thumbnail.HeicDecoder
+	}
+	for _, name := range []string{"heif-dec", "heif-convert"} {
+		if binPath, err := exec.LookPath(name); err == nil {
+			return binPath
+		}
+	}
+	return ""
+}
+
+// runThumbnailConverter run external decoder or renderer, it is killed if not finished in convert timeout
+func runThumbnailConverter(name string, args ...string) error {
+	timeout := time.Duration(config.Instance.Thumbnail.ConvertTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	// output goes to file instead of pipe, so wait is not blocked by child process which keeps pipe open
+	outputFile, err := ioutil.TempFile("", "youfile-convert")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = outputFile
+	cmd.Stderr = outputFile
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return ThumbnailConvertTimeout
+	}
+	if err != nil {
+		message, _ := ioutil.ReadFile(outputFile.Name())
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// decodeHeic convert heic to jpeg by decoder then decode it, orientation is applied by decoder
+func decodeHeic(path string) (image.Image, error) {
+	decoder := findHeicDecoder()
+	if len(decoder) == 0 {
+		return nil, HeicDecoderNotFound
+	}
+	tempDir, err := ioutil.TempDir("", "youfile-heic")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	output := filepath.Join(tempDir, "image.jpg")
+	err = runThumbnailConverter(decoder, path, output)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return jpeg.Decode(file)
+}
+
+func decodeThumbnailSource(path string) (image.Image, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".heic" || ext == ".heif" {
+		return decodeHeic(path)
+	}
+	if isPdf(path) {
+		return renderPdf(path)
+	}
+	if isTextPreviewSupported(path) {
+		return renderTextImage(path)
+	}
+	if IsAudioTagSupported(path) {
+		return decodeAudioCover(path)
+	}
+	decoder, exist := thumbnailDecoders[ext]
+	if !exist {
+		return nil, ThumbnailNotSupported
+	}
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decoder(file)
+}
+
+// checkThumbnailSource check file can be decoded without reading whole file, audio must have cover art
+func checkThumbnailSource(path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".heic" || ext == ".heif" || isPdf(path) || isTextPreviewSupported(path) {
+		return nil
+	}
+	if IsAudioTagSupported(path) {
+		audioTag, err := ReadAudioTag(path)
+		if err != nil {
+			return err
+		}
+		if audioTag.Picture == nil {
+			return AudioCoverNotFound
+		}
+		return nil
+	}
+	if _, exist := thumbnailDecoders[ext]; !exist {
+		return ThumbnailNotSupported
+	}
+	return nil
+}
+
+// readImageOrientation return exif orientation from 1 to 8, 1 if image has no orientation
+func readImageOrientation(path string) int {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".tif", ".tiff":
+	default:
+		return 1
+	}
+	file, err := AppFs.Open(path)
+	if err != nil {
+		return 1
+	}
+	defer file.Close()
+	x, err := exif.Decode(file)
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// applyImageOrientation flip and rotate image so it is shown upright
+func applyImageOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		// orientations from 5 to 8 swap width and height
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var srcX, srcY int
+			switch orientation {
+			case 2:
+				srcX, srcY = width-1-x, y
+			case 3:
+				srcX, srcY = width-1-x, height-1-y
+			case 4:
+				srcX, srcY = x, height-1-y
+			case 5:
+				srcX, srcY = y, x
+			case 6:
+				srcX, srcY = y, height-1-x
+			case 7:
+				srcX, srcY = width-1-y, height-1-x
+			case 8:
+				srcX, srcY = width-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+	return dst
+}
+
+// encodeThumbnail write image in configured format, transparent area is filled with white for jpeg
+func encodeThumbnail(out io.Writer, img image.Image) error {
+	quality := config.Instance.Thumbnail.Quality
+	if config.Instance.Thumbnail.Format == config.ThumbnailFormatWebp {
+		return webp.Encode(out, img, &webp.Options{Quality: float32(quality)})
+	}
+	bounds := img.Bounds()
+	flatten := image.NewRGBA(bounds)
+	draw.Draw(flatten, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flatten, bounds, img, bounds.Min, draw.Over)
+	return jpeg.Encode(out, flatten, &jpeg.Options{Quality: quality})
+}
+
+// createThumbnailImage create thumbnails of every size for decoded image of file
+func createThumbnailImage(path string, img image.Image, checksum string) error {
+	orientation := readImageOrientation(path)
+	for _, size := range ThumbnailSizes {
+		edge := config.Instance.Thumbnail.Sizes[size]
+		if edge <= 0 {
+			continue
+		}
+		// image smaller than size is not scaled up
+		m := resize.Thumbnail(uint(edge), uint(edge), img, resize.Lanczos3)
+		m = applyImageOrientation(m, orientation)
+		output := filepath.Join(thumbnailDir(), thumbnailFilename(checksum, size))
+		// write to temporary file, so thumbnail is never read while writing
+		out, err := ioutil.TempFile(thumbnailDir(), thumbnailFilename(checksum, size)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		tempOutput := out.Name()
+		err = encodeThumbnail(out, m)
+		out.Close()
+		if err != nil {
+			os.Remove(tempOutput)
+			return err
+		}
+		err = os.Rename(tempOutput, output)
+		if err != nil {
+			os.Remove(tempOutput)
+			return err
+		}
+	}
+	return nil
+}
+
+// isThumbnailExist return true if thumbnails of all sizes exist
+func isThumbnailExist(checksum string) bool {
+	for _, size := range ThumbnailSizes {
+		if config.Instance.Thumbnail.Sizes[size] <= 0 {
+			continue
+		}
+		isExist, _ := afero.Exists(AppFs, filepath.Join(thumbnailDir(), thumbnailFilename(checksum, size)))
+		if !isExist {
+			return false
+		}
+	}
+	return true
+}
+
+// isThumbnailValid return true if file is not changed since thumbnail generated
+func isThumbnailValid(thumbnail *database.Thumbnail, info os.FileInfo) bool {
+	return thumbnail.Size == info.Size() &&
+		thumbnail.ModTime.Equal(info.ModTime()) &&
+		thumbnail.Inode == util.FileInode(info)
+}
+
+// findThumbnails return thumbnail records of paths, latest record is used if path has more than one
+func findThumbnails(paths []string) (map[string]*database.Thumbnail, error) {
+	result := map[string]*database.Thumbnail{}
+	// query in chunks to keep under variable limit of sqlite
+	for start := 0; start < len(paths); start += 500 {
+		end := start + 500
+		if end > len(paths) {
+			end = len(paths)
+		}
+		var thumbnails []database.Thumbnail
+		err := database.Instance.Where("path IN ?", paths[start:end]).Order("id").Find(&thumbnails).Error
+		if err != nil {
+			return nil, err
+		}
+		for idx := range thumbnails {
+			result[thumbnails[idx].Path] = &thumbnails[idx]
+		}
+	}
+	return result, nil
+}
+
+// findValidThumbnail return thumbnail record of file, nil if not generated or file changed
+func findValidThumbnail(path string, info os.FileInfo) (*database.Thumbnail, error) {
+	thumbnails, err := findThumbnails([]string{path})
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, exist := thumbnails[path]
+	if !exist || !isThumbnailValid(thumbnail, info) {
+		return nil, nil
+	}
+	return thumbnail, nil
+}
+
+// saveThumbnail index thumbnail by path, thumbnail files of replaced checksum are removed if no other file use them
+func saveThumbnail(path string, info os.FileInfo, checksum string) error {
+	var thumbnails []database.Thumbnail
+	err := database.Instance.Where("path = ?", path).Find(&thumbnails).Error
+	if err != nil {
+		return err
+	}
+	err = database.Instance.Create(&database.Thumbnail{
+		Path:     path,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Inode:    util.FileInode(info),
+		Checksum: checksum,
+		AccessAt: time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	for idx := range thumbnails {
+		err = removeThumbnail(&thumbnails[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveFailedThumbnail index file without checksum, so it is not decoded again until changed. Cause is returned
+func saveFailedThumbnail(path string, info os.FileInfo, cause error) error {
+	err := saveThumbnail(path, info, "")
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// removeThumbnail delete thumbnail record, thumbnail files are kept if other file has same checksum
+func removeThumbnail(thumbnail *database.Thumbnail) error {
+	err := database.Instance.Unscoped().Delete(thumbnail).Error
+	if err != nil {
+		return err
+	}
+	var shared int64
+	err = database.Instance.Model(&database.Thumbnail{}).Where("checksum = ?", thumbnail.Checksum).Count(&shared).Error
+	if err != nil {
+		return err
+	}
+	if shared == 0 {
+		removeThumbnailFiles(thumbnail.Checksum)
+	}
+	return nil
+}
+
+// thumbnailChecksum return key of thumbnail files of file. Text preview only read head of file,
+// so it is keyed by path and index fields instead of checksum of whole file
+func thumbnailChecksum(path string, info os.FileInfo) (string, error) {
+	if isTextPreviewSupported(path) {
+		key := fmt.Sprintf("%s\x00%d\x00%d\x00%d", path, info.Size(), info.ModTime().UnixNano(), util.FileInode(info))
+		return fmt.Sprintf("%x", md5.Sum([]byte(key))), nil
+	}
+	return GetFileCheckSum(path)
+}
+
+// generateFileThumbnail create thumbnails of image if not exist, return name of medium thumbnail.
+// File is not read when thumbnail is indexed and file not changed, file failed to decode is indexed
+// without checksum and not read again until changed
+func generateFileThumbnail(path string) (string, error) {
+	info, err := AppFs.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	thumbnail, err := findValidThumbnail(path, info)
+	if err != nil {
+		return "", err
+	}
+	if thumbnail != nil && len(thumbnail.Checksum) == 0 {
+		return "", ThumbnailSourceFailed
+	}
+	if thumbnail != nil && isThumbnailExist(thumbnail.Checksum) {
+		return thumbnailFilename(thumbnail.Checksum, config.ThumbnailSizeMedium), nil
+	}
+	// file can not have thumbnail is not hashed
+	err = checkThumbnailSource(path)
+	if err != nil {
+		return "", saveFailedThumbnail(path, info, err)
+	}
+	sum, err := thumbnailChecksum(path, info)
+	if err != nil {
+		return "", err
+	}
+	// files with same content share thumbnails
+	if !isThumbnailExist(sum) {
+		img, err := decodeThumbnailSource(path)
+		if err != nil {
+			return "", saveFailedThumbnail(path, info, err)
+		}
+		err = os.MkdirAll(thumbnailDir(), os.ModePerm)
+		if err != nil {
+			return "", err
+		}
+		err = createThumbnailImage(path, img, sum)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = saveThumbnail(path, info, sum)
+	if err != nil {
+		return "", err
+	}
+	return thumbnailFilename(sum, config.ThumbnailSizeMedium), nil
+}
+
+// GetFileThumbnail return name of thumbnail in size, empty if thumbnail not generated or file changed
+func GetFileThumbnail(path string, size string) (string, error) {
+	info, err := AppFs.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	thumbnails, err := GetDirectoryThumbnails(filepath.Dir(path), []os.FileInfo{info}, size)
+	if err != nil {
+		return "", err
+	}
+	return thumbnails[info.Name()], nil
+}
+
+// GetDirectoryThumbnails return name of thumbnail in size of files in directory by file name,
+// only thumbnail index is read, files without valid thumbnail are not included
+func GetDirectoryThumbnails(dir string, items []os.FileInfo, size string) (map[string]string, error) {
+	result, supported, err := findDirectoryThumbnails(dir, items, size)
+	if err != nil {
+		return nil, err
+	}
+	for name, thumbnail := range result {
+		// file failed to decode has no thumbnail
+		if len(thumbnail) == 0 {
+			delete(result, name)
+			supported -= 1
+		}
+	}
+	atomic.AddInt64(&thumbnailHits, int64(len(result)))
+	atomic.AddInt64(&thumbnailMisses, int64(supported-len(result)))
+	return result, nil
+}
+
+// findDirectoryThumbnails return thumbnails of files in directory and count of files support thumbnail,
+// thumbnail is empty if file is indexed as failed to decode
+func findDirectoryThumbnails(dir string, items []os.FileInfo, size string) (map[string]string, int, error) {
+	result := map[string]string{}
+	paths := make([]string, 0)
+	for _, item := range items {
+		itemPath := filepath.Join(dir, item.Name())
+		if !item.IsDir() && isThumbnailSupported(itemPath) {
+			paths = append(paths, itemPath)
+		}
+	}
+	if len(paths) == 0 {
+		return result, 0, nil
+	}
+	thumbnails, err := findThumbnails(paths)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, item := range items {
+		thumbnail, exist := thumbnails[filepath.Join(dir, item.Name())]
+		if !exist {
+			continue
+		}
+		// index holds size and modify time of link target
+		if item.Mode()&os.ModeSymlink != 0 {
+			item, err = AppFs.Stat(thumbnail.Path)
+			if err != nil {
+				continue
+			}
+		}
+		if !isThumbnailValid(thumbnail, item) {
+			continue
+		}
+		if len(thumbnail.Checksum) == 0 {
+			result[item.Name()] = ""
+			continue
+		}
+		result[item.Name()] = thumbnailFilename(thumbnail.Checksum, size)
+	}
+	return result, len(paths), nil
+}
+
+// removeThumbnailFiles delete thumbnails of all sizes and formats
+func removeThumbnailFiles(checksum string) {
+	// record of file failed to decode has no thumbnail files
+	if len(checksum) == 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(thumbnailDir(), checksum+"_*"))
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
+
+type ClearThumbnailOption struct {
+	All bool `hsource:"query" hname:"all"`
+}
+
+func ClearThumbnail(option ClearThumbnailOption) error {
+	var err error
+	if option.All {
+		err = os.RemoveAll(thumbnailDir())
+		if err != nil {
+			return err
+		}
+		err = database.Instance.Model(&database.Thumbnail{}).Unscoped().Where("id != ?", -1).Delete(&database.Thumbnail{}).Error
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return removeOrphanThumbnails()
+}
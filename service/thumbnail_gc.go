@@ -0,0 +1,257 @@
+package service
+
+import (
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+// thumbnail files without index younger than this may be still generating
+const untrackedThumbnailGracePeriod = time.Hour
+
+var thumbnailCollectLock sync.Mutex
+
+// lookups of thumbnail index from directory listing since start
+var (
+	thumbnailHits   int64
+	thumbnailMisses int64
+)
+
+type ThumbnailStats struct {
+	// count of indexed files
+	Count int64
+	// count of thumbnail files
+	Files  int64
+	Bytes  int64
+	Hits   int64
+	Misses int64
+}
+
+func (s *ThumbnailStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type thumbnailFileUsage struct {
+	bytes   int64
+	files   int64
+	modTime time.Time
+}
+
+// checksumOfThumbnail return checksum part of thumbnail name, e.g. <md5>_medium.jpg
+func checksumOfThumbnail(name string) string {
+	name = filepath.Base(name)
+	if idx := strings.Index(name, "_"); idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// scanThumbnailFiles return disk usage of thumbnail files by checksum
+func scanThumbnailFiles() (map[string]*thumbnailFileUsage, error) {
+	usages := map[string]*thumbnailFileUsage{}
+	items, err := afero.ReadDir(AppFs, thumbnailDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usages, nil
+		}
+		return nil, err
+	}
+	for _, item := range items {
+		if item.IsDir() {
+			continue
+		}
+		checksum := checksumOfThumbnail(item.Name())
+		usage, exist := usages[checksum]
+		if !exist {
+			usage = &thumbnailFileUsage{}
+			usages[checksum] = usage
+		}
+		usage.bytes += item.Size()
+		usage.files += 1
+		if item.ModTime().After(usage.modTime) {
+			usage.modTime = item.ModTime()
+		}
+	}
+	return usages, nil
+}
+
+func GetThumbnailStats() (*ThumbnailStats, error) {
+	stats := &ThumbnailStats{
+		Hits:   atomic.LoadInt64(&thumbnailHits),
+		Misses: atomic.LoadInt64(&thumbnailMisses),
+	}
+	err := database.Instance.Model(&database.Thumbnail{}).Count(&stats.Count).Error
+	if err != nil {
+		return nil, err
+	}
+	usages, err := scanThumbnailFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range usages {
+		stats.Files += usage.files
+		stats.Bytes += usage.bytes
+	}
+	return stats, nil
+}
+
+// TouchThumbnail mark thumbnail as used, least recently used thumbnails are evicted first
+func TouchThumbnail(name string) error {
+	now := time.Now()
+	// skip write when thumbnail is touched recently
+	return database.Instance.Model(&database.Thumbnail{}).
+		Where("checksum = ? AND access_at < ?", checksumOfThumbnail(name), now.Add(-time.Minute)).
+		Update("access_at", now).Error
+}
+
+// unavailableMountPoints return mount points of fstab not mounted or not healthy,
+// files on them look missing while they are not
+func unavailableMountPoints() ([]string, error) {
+	mountInfo, err := ReadMountInfo()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]string, 0)
+	for _, mount := range DefaultFstab.entries() {
+		if !filepath.IsAbs(mount.File) {
+			continue
+		}
+		file := filepath.Clean(mount.File)
+		if _, mounted := mountInfo[file]; !mounted || !DefaultMountMonitor.IsHealthy(mount.File) {
+			points = append(points, file)
+		}
+	}
+	return points, nil
+}
+
+// removeOrphanThumbnails remove thumbnails of files which no longer exist
+func removeOrphanThumbnails() error {
+	var thumbnails []database.Thumbnail
+	err := database.Instance.Find(&thumbnails).Error
+	if err != nil {
+		return err
+	}
+	unavailablePoints, err := unavailableMountPoints()
+	if err != nil {
+		return err
+	}
+	for idx := range thumbnails {
+		unavailable := false
+		for _, point := range unavailablePoints {
+			if util.IsSubPath(point, thumbnails[idx].Path) {
+				unavailable = true
+				break
+			}
+		}
+		if unavailable {
+			continue
+		}
+		// file is only orphan when it surely not exist, not when it can not be read now
+		_, err = AppFs.Stat(thumbnails[idx].Path)
+		if err == nil || !os.IsNotExist(err) {
+			continue
+		}
+		err = removeThumbnail(&thumbnails[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evictThumbnail remove thumbnail files and index of all files with checksum
+func evictThumbnail(checksum string) error {
+	err := database.Instance.Unscoped().Where("checksum = ?", checksum).Delete(&database.Thumbnail{}).Error
+	if err != nil {
+		return err
+	}
+	removeThumbnailFiles(checksum)
+	return nil
+}
+
+// CollectThumbnails remove orphan and untracked thumbnails, then evict thumbnails by age and disk usage limit
+func CollectThumbnails() error {
+	thumbnailCollectLock.Lock()
+	defer thumbnailCollectLock.Unlock()
+	err := removeOrphanThumbnails()
+	if err != nil {
+		return err
+	}
+	var thumbnails []database.Thumbnail
+	err = database.Instance.Find(&thumbnails).Error
+	if err != nil {
+		return err
+	}
+	// last access of checksum is latest access of files share it
+	accessAt := map[string]time.Time{}
+	for _, thumbnail := range thumbnails {
+		if last, exist := accessAt[thumbnail.Checksum]; !exist || thumbnail.AccessAt.After(last) {
+			accessAt[thumbnail.Checksum] = thumbnail.AccessAt
+		}
+	}
+	usages, err := scanThumbnailFiles()
+	if err != nil {
+		return err
+	}
+	var totalBytes int64 = 0
+	for checksum, usage := range usages {
+		if _, tracked := accessAt[checksum]; !tracked && time.Since(usage.modTime) > untrackedThumbnailGracePeriod {
+			removeThumbnailFiles(checksum)
+			continue
+		}
+		totalBytes += usage.bytes
+	}
+	checksums := make([]string, 0, len(accessAt))
+	for checksum := range accessAt {
+		checksums = append(checksums, checksum)
+	}
+	sort.Slice(checksums, func(i, j int) bool {
+		return accessAt[checksums[i]].Before(accessAt[checksums[j]])
+	})
+	maxAge := time.Duration(config.Instance.Thumbnail.MaxAge) * 24 * time.Hour
+	maxBytes := config.Instance.Thumbnail.MaxSize * 1024 * 1024
+	for _, checksum := range checksums {
+		isExpired := maxAge > 0 && time.Since(accessAt[checksum]) > maxAge
+		isOverSize := maxBytes > 0 && totalBytes > maxBytes
+		if !isExpired && !isOverSize {
+			// checksums are sorted by access time, rest are newer
+			break
+		}
+		err = evictThumbnail(checksum)
+		if err != nil {
+			return err
+		}
+		if usage, exist := usages[checksum]; exist {
+			totalBytes -= usage.bytes
+		}
+	}
+	return nil
+}
+
+func StartThumbnailCollector() {
+	interval := config.Instance.Thumbnail.GCInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		for {
+			err := CollectThumbnails()
+			if err != nil {
+				thumbnailLogger.Error(err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"container/heap"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sync"
+	"youfile/config"
+	"youfile/database"
+)
+
+var thumbnailLogger = logrus.WithField("scope", "thumbnail")
+
+const (
+	ThumbnailPriorityBackground = 0
+	// images of directory which is viewed by user
+	ThumbnailPriorityView = 10
+)
+
+type ThumbnailNotifier struct {
+	OnFileComplete func(path string, thumbnail string)
+	OnComplete     func()
+}
+
+type thumbnailJob struct {
+	path     string
+	priority int
+	seq      uint64
+	index    int
+}
+
+// thumbnailJobQueue pop job of higher priority first, jobs of same priority in order of enqueue
+type thumbnailJobQueue []*thumbnailJob
+
+func (q thumbnailJobQueue) Len() int {
+	return len(q)
+}
+
+func (q thumbnailJobQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q thumbnailJobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *thumbnailJobQueue) Push(x interface{}) {
+	job := x.(*thumbnailJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *thumbnailJobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return job
+}
+
+// ThumbnailService generate thumbnails with bounded workers,
+// images are queued once no matter how many times its directory is requested
+type ThumbnailService struct {
+	queue   thumbnailJobQueue
+	jobs    map[string]*thumbnailJob
+	running map[string]bool
+	// count of queued and running jobs in directory
+	pending   map[string]int
+	notifiers map[string][]*ThumbnailNotifier
+	seq       uint64
+	started   bool
+	cond      *sync.Cond
+	sync.Mutex
+}
+
+func NewThumbnailService() *ThumbnailService {
+	s := &ThumbnailService{
+		jobs:      map[string]*thumbnailJob{},
+		running:   map[string]bool{},
+		pending:   map[string]int{},
+		notifiers: map[string][]*ThumbnailNotifier{},
+	}
+	s.cond = sync.NewCond(&s.Mutex)
+	return s
+}
+
+var DefaultThumbnailService = NewThumbnailService()
+
+// StartThumbnailService restore jobs saved before last shutdown, start workers and queue images under roots
+func StartThumbnailService() error {
+	return DefaultThumbnailService.Start(config.Instance.Thumbnail.Workers, config.Instance.Thumbnail.Roots)
+}
+
+func (s *ThumbnailService) Start(workers int, roots []string) error {
+	var savedJobs []database.ThumbnailJob
+	err := database.Instance.Order("id").Find(&savedJobs).Error
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	if s.started {
+		s.Unlock()
+		return nil
+	}
+	s.started = true
+	for _, savedJob := range savedJobs {
+		s.push(savedJob.Path, savedJob.Priority)
+	}
+	s.Unlock()
+	if workers <= 0 {
+		workers = 1
+	}
+	for idx := 0; idx < workers; idx++ {
+		go s.work()
+	}
+	go func() {
+		for _, root := range roots {
+			err := s.GenerateTree(root)
+			if err != nil {
+				thumbnailLogger.WithField("root", root).Error(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// push add job to queue, job is not saved. Must be called with lock held
+func (s *ThumbnailService) push(path string, priority int) bool {
+	if job, exist := s.jobs[path]; exist {
+		if job.priority < priority {
+			job.priority = priority
+			heap.Fix(&s.queue, job.index)
+			return true
+		}
+		return false
+	}
+	if s.running[path] {
+		return false
+	}
+	s.seq += 1
+	job := &thumbnailJob{path: path, priority: priority, seq: s.seq}
+	heap.Push(&s.queue, job)
+	s.jobs[path] = job
+	s.pending[filepath.Dir(path)] += 1
+	s.cond.Signal()
+	return true
+}
+
+// enqueue add job to queue and save it, so unfinished jobs can be restored at next start
+func (s *ThumbnailService) enqueue(path string, priority int) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.push(path, priority) {
+		return
+	}
+	// saved before worker can take the job, so the record is never left after job done
+	err := database.Instance.
+		Where(database.ThumbnailJob{Path: path}).
+		Assign(database.ThumbnailJob{Priority: priority}).
+		FirstOrCreate(&database.ThumbnailJob{}).Error
+	if err != nil {
+		thumbnailLogger.WithField("path", path).Error(err)
+	}
+}
+
+// GenerateDirectory queue images in directory, notifier is called when each image and whole directory is done
+func (s *ThumbnailService) GenerateDirectory(dir string, priority int, notifier *ThumbnailNotifier) error {
+	items, err := afero.ReadDir(AppFs, dir)
+	if err != nil {
+		return err
+	}
+	dir = filepath.Clean(dir)
+	generated, _, err := findDirectoryThumbnails(dir, items, config.ThumbnailSizeMedium)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.IsDir() {
+			continue
+		}
+		if _, exist := generated[item.Name()]; exist {
+			continue
+		}
+		itemPath := filepath.Join(dir, item.Name())
+		if !isThumbnailSupported(itemPath) {
+			continue
+		}
+		s.enqueue(itemPath, priority)
+	}
+	if notifier == nil {
+		return nil
+	}
+	s.Lock()
+	if s.pending[dir] > 0 {
+		s.notifiers[dir] = append(s.notifiers[dir], notifier)
+		s.Unlock()
+		return nil
+	}
+	s.Unlock()
+	if notifier.OnComplete != nil {
+		notifier.OnComplete()
+	}
+	return nil
+}
+
+// GenerateTree queue images under root in background priority
+func (s *ThumbnailService) GenerateTree(root string) error {
+	return afero.Walk(AppFs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !isThumbnailSupported(path) {
+			return nil
+		}
+		s.enqueue(filepath.Clean(path), ThumbnailPriorityBackground)
+		return nil
+	})
+}
+
+func (s *ThumbnailService) work() {
+	for {
+		s.Lock()
+		for s.queue.Len() == 0 {
+			s.cond.Wait()
+		}
+		job := heap.Pop(&s.queue).(*thumbnailJob)
+		delete(s.jobs, job.path)
+		s.running[job.path] = true
+		s.Unlock()
+
+		thumbnail, err := generateFileThumbnail(job.path)
+		// audio without cover art is common, and failed file is logged when first decoded
+		if err != nil && err != AudioCoverNotFound && err != ThumbnailSourceFailed {
+			thumbnailLogger.WithField("path", job.path).Error(err)
+		}
+		err = database.Instance.Unscoped().Where("path = ?", job.path).Delete(&database.ThumbnailJob{}).Error
+		if err != nil {
+			thumbnailLogger.WithField("path", job.path).Error(err)
+		}
+		s.done(job.path, thumbnail)
+	}
+}
+
+// done notify directory of job, thumbnail is empty if generate failed
+func (s *ThumbnailService) done(path string, thumbnail string) {
+	dir := filepath.Dir(path)
+	s.Lock()
+	delete(s.running, path)
+	s.pending[dir] -= 1
+	notifiers := s.notifiers[dir]
+	isComplete := s.pending[dir] <= 0
+	if isComplete {
+		delete(s.pending, dir)
+		delete(s.notifiers, dir)
+	}
+	s.Unlock()
+	for _, notifier := range notifiers {
+		if len(thumbnail) > 0 && notifier.OnFileComplete != nil {
+			notifier.OnFileComplete(path, thumbnail)
+		}
+		if isComplete && notifier.OnComplete != nil {
+			notifier.OnComplete()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"youfile/config"
+	"youfile/database"
+	"youfile/util"
+)
+
+var (
+	TrashItemNotFound    = errors.New("trash item not found")
+	TrashRestoreConflict = errors.New("file exists at original path")
+)
+
+// MoveToTrash move file into trash directory, original path is recorded so file can be restored
+func MoveToTrash(target string, displayPath string, username string) (*database.TrashItem, error) {
+	err := AppFs.MkdirAll(config.Instance.TrashPath, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	trashPath := filepath.Join(config.Instance.TrashPath, filepath.Base(target))
+	for {
+		exist, _ := afero.Exists(AppFs, trashPath)
+		if !exist {
+			break
+		}
+		trashPath = util.RenameDuplicateFilename(trashPath)
+	}
+	err = MoveFile(target, trashPath, nil, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+	err = AppFs.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	item := &database.TrashItem{
+		Username:     username,
+		Path:         trashPath,
+		OriginalPath: target,
+		DisplayPath:  displayPath,
+	}
+	err = database.Instance.Create(item).Error
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func GetTrashItems(username string) ([]database.TrashItem, error) {
+	var items []database.TrashItem
+	err := database.Instance.Where("username = ?", username).Order("id desc").Find(&items).Error
+	return items, err
+}
+
+// RestoreTrashItem move file in trash back to its original path, file at original path is not overwritten
+func RestoreTrashItem(id uint, username string) (*database.TrashItem, error) {
+	var item database.TrashItem
+	err := database.Instance.Where("id = ? AND username = ?", id, username).Find(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	if item.ID == 0 {
+		return nil, TrashItemNotFound
+	}
+	exist, err := afero.Exists(AppFs, item.OriginalPath)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, TrashRestoreConflict
+	}
+	stat, err := AppFs.Stat(item.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, TrashItemNotFound
+		}
+		return nil, err
+	}
+	err = AppFs.MkdirAll(filepath.Dir(item.OriginalPath), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	err = MoveFile(item.Path, item.OriginalPath, nil, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+	err = AppFs.Remove(item.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	AddQuotaUsage(username, item.Path, -stat.Size())
+	AddQuotaUsage(username, item.OriginalPath, stat.Size())
+	err = database.Instance.Unscoped().Delete(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,60 @@
+package template
+
+import (
+	"path"
+	"strings"
+	"youfile/database"
+	"youfile/service"
+)
+
+type ArchiveEntryTemplate struct {
+	Path           string `json:"path"`
+	Name           string `json:"name"`
+	IsDir          bool   `json:"isDir"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+	ModTime        string `json:"modTime,omitempty"`
+	Encrypted      bool   `json:"encrypted"`
+}
+
+func NewArchiveEntryListTemplate(entries []*service.ArchiveEntry) []ArchiveEntryTemplate {
+	data := make([]ArchiveEntryTemplate, 0)
+	for _, entry := range entries {
+		template := ArchiveEntryTemplate{
+			Path:           entry.Path,
+			Name:           path.Base(strings.TrimSuffix(entry.Path, "/")),
+			IsDir:          entry.IsDir,
+			Size:           entry.Size,
+			CompressedSize: entry.CompressedSize,
+			Encrypted:      entry.Encrypted,
+		}
+		if !entry.ModTime.IsZero() {
+			template.ModTime = entry.ModTime.Format(timeFormat)
+		}
+		data = append(data, template)
+	}
+	return data
+}
+
+// ArchivePasswordTemplate is saved password, password itself is never sent back
+type ArchivePasswordTemplate struct {
+	Id        uint   `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func NewArchivePasswordTemplate(password *database.ArchivePassword) ArchivePasswordTemplate {
+	return ArchivePasswordTemplate{
+		Id:        password.ID,
+		Name:      password.Name,
+		CreatedAt: password.CreatedAt.Format(timeFormat),
+	}
+}
+
+func NewArchivePasswordListTemplate(passwords []database.ArchivePassword) []ArchivePasswordTemplate {
+	data := make([]ArchivePasswordTemplate, 0)
+	for idx := range passwords {
+		data = append(data, NewArchivePasswordTemplate(&passwords[idx]))
+	}
+	return data
+}
@@ -0,0 +1,50 @@
+package template
+
+import (
+	"youfile/service"
+)
+
+type AudioTagTemplate struct {
+	Title         string `json:"title"`
+	Artist        string `json:"artist"`
+	Album         string `json:"album"`
+	AlbumArtist   string `json:"albumArtist"`
+	Genre         string `json:"genre"`
+	Composer      string `json:"composer"`
+	Comment       string `json:"comment"`
+	Year          int    `json:"year"`
+	Track         int    `json:"track"`
+	TrackTotal    int    `json:"trackTotal"`
+	Disc          int    `json:"disc"`
+	DiscTotal     int    `json:"discTotal"`
+	HasCover      bool   `json:"hasCover"`
+	CoverMimeType string `json:"coverMimeType,omitempty"`
+	Format        string `json:"format,omitempty"`
+	FileType      string `json:"fileType,omitempty"`
+	Writable      bool   `json:"writable"`
+}
+
+func NewAudioTagTemplate(path string, audioTag *service.AudioTag) *AudioTagTemplate {
+	template := &AudioTagTemplate{
+		Title:       audioTag.Title,
+		Artist:      audioTag.Artist,
+		Album:       audioTag.Album,
+		AlbumArtist: audioTag.AlbumArtist,
+		Genre:       audioTag.Genre,
+		Composer:    audioTag.Composer,
+		Comment:     audioTag.Comment,
+		Year:        audioTag.Year,
+		Track:       audioTag.Track,
+		TrackTotal:  audioTag.TrackTotal,
+		Disc:        audioTag.Disc,
+		DiscTotal:   audioTag.DiscTotal,
+		Format:      audioTag.Format,
+		FileType:    audioTag.FileType,
+		Writable:    service.IsAudioTagWriteSupported(path),
+	}
+	if audioTag.Picture != nil {
+		template.HasCover = true
+		template.CoverMimeType = audioTag.Picture.MIMEType
+	}
+	return template
+}
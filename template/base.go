@@ -1,3 +1,18 @@
 package template
 
+import (
+	"strings"
+	"youfile/util"
+)
+
 var timeFormat = "2006-01-02 15:04:05"
+
+// translatePath convert real path to display path with mapping of real root to display root
+func translatePath(target string, mapping map[string]string) string {
+	for realPath, displayPath := range mapping {
+		if util.IsSubPath(realPath, target) {
+			return strings.Replace(target, realPath, displayPath, 1)
+		}
+	}
+	return target
+}
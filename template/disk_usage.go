@@ -0,0 +1,102 @@
+package template
+
+import (
+	"strings"
+	"youfile/config"
+	"youfile/service"
+)
+
+type DiskUsageNodeTemplate struct {
+	Name       string                  `json:"name"`
+	Path       string                  `json:"path"`
+	IsDir      bool                    `json:"isDir"`
+	Size       int64                   `json:"size"`
+	FileCount  int64                   `json:"fileCount"`
+	DirCount   int64                   `json:"dirCount"`
+	ModifyTime string                  `json:"modifyTime"`
+	Children   []DiskUsageNodeTemplate `json:"children,omitempty"`
+}
+
+func NewDiskUsageNodeTemplate(node *service.DiskUsageNode, src string, pathTrans string) DiskUsageNodeTemplate {
+	targetPath := node.Path
+	if config.Instance.YouPlusPath {
+		targetPath = strings.Replace(targetPath, src, pathTrans, 1)
+	}
+	template := DiskUsageNodeTemplate{
+		Name:       node.Name,
+		Path:       targetPath,
+		IsDir:      node.IsDir,
+		Size:       node.Size,
+		FileCount:  node.FileCount,
+		DirCount:   node.DirCount,
+		ModifyTime: node.ModTime.Format(timeFormat),
+	}
+	for _, child := range node.Children {
+		template.Children = append(template.Children, NewDiskUsageNodeTemplate(child, src, pathTrans))
+	}
+	return template
+}
+
+type DiskUsageGroupTemplate struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	FileCount int64  `json:"fileCount"`
+}
+
+type DiskUsageOutputTemplate struct {
+	ScanFile    int64                    `json:"scanFile"`
+	ScanDir     int64                    `json:"scanDir"`
+	ScanSize    int64                    `json:"scanSize"`
+	CurrentPath string                   `json:"currentPath"`
+	Speed       int64                    `json:"speed"`
+	TopFiles    []DiskUsageNodeTemplate  `json:"topFiles,omitempty"`
+	TopDirs     []DiskUsageNodeTemplate  `json:"topDirs,omitempty"`
+	Extensions  []DiskUsageGroupTemplate `json:"extensions,omitempty"`
+	Ages        []DiskUsageGroupTemplate `json:"ages,omitempty"`
+}
+
+func newDiskUsageGroupTemplates(groups []*service.DiskUsageGroup) []DiskUsageGroupTemplate {
+	data := make([]DiskUsageGroupTemplate, 0)
+	for _, group := range groups {
+		data = append(data, DiskUsageGroupTemplate{
+			Key:       group.Key,
+			Size:      group.Size,
+			FileCount: group.FileCount,
+		})
+	}
+	return data
+}
+
+func (t *DiskUsageOutputTemplate) Serialize(task service.Task) {
+	diskUsageTask := task.(*service.DiskUsageTask)
+	diskUsageTask.Lock()
+	defer diskUsageTask.Unlock()
+	src := diskUsageTask.Option.Src
+	pathTrans := diskUsageTask.Option.PathTrans
+	t.ScanFile = diskUsageTask.Output.ScanFile
+	t.ScanDir = diskUsageTask.Output.ScanDir
+	t.ScanSize = diskUsageTask.Output.ScanSize
+	t.CurrentPath = diskUsageTask.Output.CurrentPath
+	if config.Instance.YouPlusPath {
+		t.CurrentPath = strings.Replace(t.CurrentPath, src, pathTrans, 1)
+	}
+	t.Speed = diskUsageTask.Output.Speed
+	result := diskUsageTask.Output.Result
+	if result == nil {
+		return
+	}
+	for _, file := range result.TopFiles {
+		t.TopFiles = append(t.TopFiles, NewDiskUsageNodeTemplate(file, src, pathTrans))
+	}
+	for _, dir := range result.TopDirs {
+		t.TopDirs = append(t.TopDirs, NewDiskUsageNodeTemplate(dir, src, pathTrans))
+	}
+	t.Extensions = newDiskUsageGroupTemplates(result.Extensions)
+	t.Ages = newDiskUsageGroupTemplates(result.Ages)
+}
+
+func SerializeDiskUsageOutput(data *service.DiskUsageTask) interface{} {
+	template := DiskUsageOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
@@ -0,0 +1,102 @@
+package template
+
+import (
+	"path/filepath"
+	"youfile/service"
+)
+
+type DuplicateFileTemplate struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Directory  string `json:"directory"`
+	ModifyTime string `json:"modifyTime"`
+}
+
+type DuplicateGroupTemplate struct {
+	Id       int                     `json:"id"`
+	Hash     string                  `json:"hash"`
+	Size     int64                   `json:"size"`
+	Wasted   int64                   `json:"wasted"`
+	Resolved bool                    `json:"resolved"`
+	Files    []DuplicateFileTemplate `json:"files"`
+}
+
+func NewDuplicateGroupTemplate(group *service.DuplicateGroup, displayPath map[string]string) DuplicateGroupTemplate {
+	template := DuplicateGroupTemplate{
+		Id:       group.Id,
+		Hash:     group.Hash,
+		Size:     group.Size,
+		Wasted:   group.Wasted(),
+		Resolved: group.Resolved,
+		Files:    []DuplicateFileTemplate{},
+	}
+	for _, file := range group.Files {
+		path := translatePath(file.Path, displayPath)
+		template.Files = append(template.Files, DuplicateFileTemplate{
+			Path:       path,
+			Name:       filepath.Base(path),
+			Directory:  filepath.Dir(path),
+			ModifyTime: file.ModTime.Format(timeFormat),
+		})
+	}
+	return template
+}
+
+func NewDuplicateGroupListTemplate(groups []*service.DuplicateGroup, displayPath map[string]string) []DuplicateGroupTemplate {
+	data := make([]DuplicateGroupTemplate, 0)
+	for _, group := range groups {
+		data = append(data, NewDuplicateGroupTemplate(group, displayPath))
+	}
+	return data
+}
+
+type ResolveDuplicateResultTemplate struct {
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func NewResolveDuplicateResultTemplate(results map[int][]*service.ResolveDuplicateResult, displayPath map[string]string) map[int][]ResolveDuplicateResultTemplate {
+	data := map[int][]ResolveDuplicateResultTemplate{}
+	for groupId, groupResults := range results {
+		data[groupId] = make([]ResolveDuplicateResultTemplate, 0)
+		for _, result := range groupResults {
+			item := ResolveDuplicateResultTemplate{Error: result.Error}
+			if len(result.Path) > 0 {
+				item.Path = translatePath(result.Path, displayPath)
+			}
+			data[groupId] = append(data[groupId], item)
+		}
+	}
+	return data
+}
+
+type FindDuplicatesOutputTemplate struct {
+	Phase       string  `json:"phase"`
+	ScanFile    int     `json:"scanFile"`
+	HashTotal   int     `json:"hashTotal"`
+	HashFile    int     `json:"hashFile"`
+	CurrentFile string  `json:"currentFile"`
+	Progress    float64 `json:"progress"`
+	GroupCount  int     `json:"groupCount"`
+	WastedSize  int64   `json:"wastedSize"`
+}
+
+func (t *FindDuplicatesOutputTemplate) Serialize(task service.Task) {
+	duplicateTask := task.(*service.FindDuplicatesTask)
+	duplicateTask.Lock()
+	defer duplicateTask.Unlock()
+	t.Phase = duplicateTask.Output.Phase
+	t.ScanFile = duplicateTask.Output.ScanFile
+	t.HashTotal = duplicateTask.Output.HashTotal
+	t.HashFile = duplicateTask.Output.HashFile
+	t.CurrentFile = translatePath(duplicateTask.Output.CurrentFile, duplicateTask.Option.DisplayPath)
+	t.Progress = duplicateTask.Output.Progress
+	t.GroupCount = duplicateTask.Output.GroupCount
+	t.WastedSize = duplicateTask.Output.WastedSize
+}
+
+func SerializeFindDuplicatesOutput(data *service.FindDuplicatesTask) interface{} {
+	template := FindDuplicatesOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
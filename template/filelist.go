@@ -12,13 +12,14 @@ import (
 )
 
 type FileItem struct {
-	Name       string `json:"name"`
-	Type       string `json:"type"`
-	Path       string `json:"path"`
-	Size       int64  `json:"size"`
-	ModifyTime string `json:"modifyTime"`
-	Thumbnail  string `json:"thumbnail,omitempty"`
-	IsDataset  bool   `json:"isDataset"`
+	Name       string             `json:"name"`
+	Type       string             `json:"type"`
+	Path       string             `json:"path"`
+	Size       int64              `json:"size"`
+	ModifyTime string             `json:"modifyTime"`
+	Thumbnail  string             `json:"thumbnail,omitempty"`
+	IsDataset  bool               `json:"isDataset"`
+	Meta       *ImageMetaTemplate `json:"meta,omitempty"`
 }
 type FileListTemplate struct {
 	Success bool       `json:"success"`
@@ -29,6 +30,7 @@ type FileListTemplate struct {
 
 func NewFileListTemplate(result []os.FileInfo, parentPath string, realPath string) *FileListTemplate {
 	items := make([]FileItem, 0)
+	thumbnails, _ := service.GetDirectoryThumbnails(realPath, result, config.ThumbnailSizeMedium)
 	for _, info := range result {
 		item := FileItem{
 			Name:       info.Name(),
@@ -53,8 +55,7 @@ func NewFileListTemplate(result []os.FileInfo, parentPath string, realPath strin
 			}
 		} else {
 			item.Type = "File"
-			thumbnailName, _ := service.GetFileThumbnail(item.Path)
-			item.Thumbnail = thumbnailName
+			item.Thumbnail = thumbnails[info.Name()]
 		}
 		items = append(items, item)
 	}
@@ -62,6 +63,22 @@ func NewFileListTemplate(result []os.FileInfo, parentPath string, realPath strin
 	return &FileListTemplate{Result: items, Sep: string(filepath.Separator), Success: true, Name: filepath.Base(realPath)}
 }
 
+// AttachImageMeta add metadata of images to file items
+func (t *FileListTemplate) AttachImageMeta(realPath string) {
+	for idx := range t.Result {
+		item := &t.Result[idx]
+		itemPath := filepath.Join(realPath, item.Name)
+		if item.Type != "File" || !service.IsImageMetaSupported(itemPath) {
+			continue
+		}
+		meta, err := service.GetImageMeta(itemPath)
+		if err != nil {
+			continue
+		}
+		item.Meta = NewImageMetaTemplate(meta)
+	}
+}
+
 func NewFileListTemplateFromTargetFile(result []service.TargetFile, src string) *FileListTemplate {
 
 	items := make([]FileItem, 0)
@@ -3,6 +3,8 @@ package template
 import (
 	"github.com/d-tux/go-fstab"
 	"path/filepath"
+	"youfile/database"
+	"youfile/service"
 )
 
 type MountTemplate struct {
@@ -13,12 +15,16 @@ type MountTemplate struct {
 	Freq      int               `json:"freq"`
 	PassNo    int               `json:"pass_no"`
 	MountName string            `json:"mountName"`
+	// name of mount provider, empty if filesystem is not managed by provider
+	Provider string               `json:"provider,omitempty"`
+	Status   *MountStatusTemplate `json:"status,omitempty"`
 }
 
-func MountTemplateFromList(mounts fstab.Mounts) []MountTemplate {
+// MountTemplateFromList serialize mounts with status of same index, statuses can be nil
+func MountTemplateFromList(mounts fstab.Mounts, statuses []*service.MountStatus) []MountTemplate {
 	data := make([]MountTemplate, 0)
-	for _, mount := range mounts {
-		data = append(data, MountTemplate{
+	for idx, mount := range mounts {
+		template := MountTemplate{
 			Spec:      mount.Spec,
 			File:      mount.File,
 			VfsType:   mount.VfsType,
@@ -26,6 +32,133 @@ func MountTemplateFromList(mounts fstab.Mounts) []MountTemplate {
 			Freq:      mount.Freq,
 			PassNo:    mount.PassNo,
 			MountName: filepath.Base(mount.File),
+		}
+		if provider := service.GetMountProviderByVfsType(mount.VfsType); provider != nil {
+			template.Provider = provider.Name()
+		}
+		if idx < len(statuses) && statuses[idx] != nil {
+			template.Status = NewMountStatusTemplate(statuses[idx])
+		}
+		data = append(data, template)
+	}
+	return data
+}
+
+type MountStatusTemplate struct {
+	File      string `json:"file"`
+	Mounted   bool   `json:"mounted"`
+	FsType    string `json:"fsType,omitempty"`
+	Source    string `json:"source,omitempty"`
+	ReadOnly  bool   `json:"readOnly"`
+	Network   bool   `json:"network"`
+	Health    string `json:"health"`
+	Error     string `json:"error,omitempty"`
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Available uint64 `json:"available"`
+	// milliseconds of probe on network mount
+	Latency int64  `json:"latency"`
+	CheckAt string `json:"checkAt"`
+}
+
+func NewMountStatusTemplate(status *service.MountStatus) *MountStatusTemplate {
+	return &MountStatusTemplate{
+		File:      status.File,
+		Mounted:   status.Mounted,
+		FsType:    status.FsType,
+		Source:    status.Source,
+		ReadOnly:  status.ReadOnly,
+		Network:   status.Network,
+		Health:    status.Health,
+		Error:     status.Error,
+		Total:     status.Total,
+		Free:      status.Free,
+		Available: status.Available,
+		Latency:   status.Latency.Milliseconds(),
+		CheckAt:   status.CheckAt.Format(timeFormat),
+	}
+}
+
+func NewMountStatusTemplateList(statuses []*service.MountStatus) []*MountStatusTemplate {
+	data := make([]*MountStatusTemplate, 0)
+	for _, status := range statuses {
+		data = append(data, NewMountStatusTemplate(status))
+	}
+	return data
+}
+
+type MountProviderTemplate struct {
+	Name    string `json:"name"`
+	VfsType string `json:"vfsType"`
+}
+
+func NewMountProviderTemplateList(providers []service.MountProvider) []MountProviderTemplate {
+	data := make([]MountProviderTemplate, 0)
+	for _, provider := range providers {
+		data = append(data, MountProviderTemplate{
+			Name:    provider.Name(),
+			VfsType: provider.VfsType(),
+		})
+	}
+	return data
+}
+
+type MountCredentialTemplate struct {
+	Name      string   `json:"name"`
+	Username  string   `json:"username"`
+	Domain    string   `json:"domain,omitempty"`
+	Encrypted bool     `json:"encrypted"`
+	Path      string   `json:"path"`
+	UsedBy    []string `json:"usedBy"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+func NewMountCredentialTemplate(credential *database.MountCredential) MountCredentialTemplate {
+	return MountCredentialTemplate{
+		Name:      credential.Name,
+		Username:  credential.Username,
+		Domain:    credential.Domain,
+		Encrypted: credential.Encrypted,
+		Path:      credential.Path,
+		UsedBy:    service.GetMountCredentialUsage(credential),
+		UpdatedAt: credential.UpdatedAt.Format(timeFormat),
+	}
+}
+
+func NewMountCredentialTemplateList(credentials []database.MountCredential) []MountCredentialTemplate {
+	data := make([]MountCredentialTemplate, 0)
+	for idx := range credentials {
+		data = append(data, NewMountCredentialTemplate(&credentials[idx]))
+	}
+	return data
+}
+
+type FstabCheckTemplate struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// NewFstabCheckTemplate serialize result of fstab dry run, err is nil if fstab is valid
+func NewFstabCheckTemplate(err error) FstabCheckTemplate {
+	if err != nil {
+		return FstabCheckTemplate{Error: err.Error()}
+	}
+	return FstabCheckTemplate{Valid: true}
+}
+
+type FstabBackupTemplate struct {
+	Name string `json:"name"`
+	Time string `json:"time"`
+	Size int64  `json:"size"`
+}
+
+func NewFstabBackupTemplateList(backups []*service.FstabBackup) []FstabBackupTemplate {
+	data := make([]FstabBackupTemplate, 0)
+	for _, backup := range backups {
+		data = append(data, FstabBackupTemplate{
+			Name: backup.Name,
+			Time: backup.Time.Format(timeFormat),
+			Size: backup.Size,
 		})
 	}
 	return data
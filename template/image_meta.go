@@ -0,0 +1,51 @@
+package template
+
+import (
+	"strings"
+	"youfile/database"
+)
+
+type ImageMetaTemplate struct {
+	Width        int      `json:"width"`
+	Height       int      `json:"height"`
+	Orientation  int      `json:"orientation,omitempty"`
+	CameraMake   string   `json:"cameraMake,omitempty"`
+	CameraModel  string   `json:"cameraModel,omitempty"`
+	LensModel    string   `json:"lensModel,omitempty"`
+	CaptureAt    string   `json:"captureAt,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+	ExposureTime string   `json:"exposureTime,omitempty"`
+	FNumber      float64  `json:"fNumber,omitempty"`
+	ISO          int      `json:"iso,omitempty"`
+	FocalLength  float64  `json:"focalLength,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Keywords     []string `json:"keywords,omitempty"`
+}
+
+func NewImageMetaTemplate(meta *database.ImageMeta) *ImageMetaTemplate {
+	template := &ImageMetaTemplate{
+		Width:        meta.Width,
+		Height:       meta.Height,
+		Orientation:  meta.Orientation,
+		CameraMake:   meta.CameraMake,
+		CameraModel:  meta.CameraModel,
+		LensModel:    meta.LensModel,
+		Latitude:     meta.Latitude,
+		Longitude:    meta.Longitude,
+		ExposureTime: meta.ExposureTime,
+		FNumber:      meta.FNumber,
+		ISO:          meta.ISO,
+		FocalLength:  meta.FocalLength,
+		Title:        meta.Title,
+		Description:  meta.Description,
+	}
+	if meta.CaptureAt != nil {
+		template.CaptureAt = meta.CaptureAt.Format(timeFormat)
+	}
+	if len(meta.Keywords) > 0 {
+		template.Keywords = strings.Split(meta.Keywords, ",")
+	}
+	return template
+}
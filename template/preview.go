@@ -0,0 +1,23 @@
+package template
+
+import "youfile/service"
+
+type PreviewTemplate struct {
+	Type      string `json:"type"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Html      string `json:"html,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"truncated"`
+}
+
+func NewPreviewTemplate(preview *service.Preview) PreviewTemplate {
+	return PreviewTemplate{
+		Type:      preview.Type,
+		Thumbnail: preview.Thumbnail,
+		Html:      preview.Html,
+		Language:  preview.Language,
+		Encoding:  preview.Encoding,
+		Truncated: preview.Truncated,
+	}
+}
@@ -0,0 +1,42 @@
+package template
+
+import "youfile/database"
+
+type QuotaTemplate struct {
+	Id       uint    `json:"id"`
+	Username string  `json:"username"`
+	Path     string  `json:"path"`
+	Limit    int64   `json:"limit"`
+	Used     int64   `json:"used"`
+	Free     int64   `json:"free"`
+	Usage    float64 `json:"usage"`
+	ScanAt   string  `json:"scanAt,omitempty"`
+}
+
+func NewQuotaTemplate(quota *database.Quota) QuotaTemplate {
+	template := QuotaTemplate{
+		Id:       quota.ID,
+		Username: quota.Username,
+		Path:     quota.Path,
+		Limit:    quota.Limit,
+		Used:     quota.Used,
+	}
+	if quota.Limit > quota.Used {
+		template.Free = quota.Limit - quota.Used
+	}
+	if quota.Limit > 0 {
+		template.Usage = float64(quota.Used) / float64(quota.Limit)
+	}
+	if quota.ScanAt != nil {
+		template.ScanAt = quota.ScanAt.Format(timeFormat)
+	}
+	return template
+}
+
+func NewQuotaListTemplate(quotas []database.Quota) []QuotaTemplate {
+	data := make([]QuotaTemplate, 0)
+	for idx := range quotas {
+		data = append(data, NewQuotaTemplate(&quotas[idx]))
+	}
+	return data
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"youfile/database"
+	"youfile/service"
+)
+
+type ScheduleJobOptionTemplate struct {
+	Sources       []string `json:"sources"`
+	Target        string   `json:"target,omitempty"`
+	OnDuplicate   string   `json:"onDuplicate,omitempty"`
+	Mode          string   `json:"mode,omitempty"`
+	Compare       string   `json:"compare,omitempty"`
+	Conflict      string   `json:"conflict,omitempty"`
+	OlderThanDays int      `json:"olderThanDays,omitempty"`
+}
+
+type ScheduleJobTemplate struct {
+	Id        uint                       `json:"id"`
+	Name      string                     `json:"name"`
+	Cron      string                     `json:"cron"`
+	TaskType  string                     `json:"taskType"`
+	Enable    bool                       `json:"enable"`
+	Options   *ScheduleJobOptionTemplate `json:"options,omitempty"`
+	Running   bool                       `json:"running"`
+	LastRunAt string                     `json:"lastRunAt,omitempty"`
+	NextRunAt string                     `json:"nextRunAt,omitempty"`
+}
+
+func NewScheduleJobTemplate(job *database.ScheduleJob) ScheduleJobTemplate {
+	template := ScheduleJobTemplate{
+		Id:       job.ID,
+		Name:     job.Name,
+		Cron:     job.Cron,
+		TaskType: job.TaskType,
+		Enable:   job.Enable,
+		Running:  service.DefaultScheduler.IsRunning(job.ID),
+	}
+	option, err := service.ParseScheduleJobOption(job)
+	if err == nil {
+		template.Options = &ScheduleJobOptionTemplate{
+			Sources:       make([]string, 0),
+			Target:        translatePath(option.Target, option.DisplayPath),
+			OnDuplicate:   option.OnDuplicate,
+			Mode:          option.Mode,
+			Compare:       option.Compare,
+			Conflict:      option.Conflict,
+			OlderThanDays: option.OlderThanDays,
+		}
+		for _, source := range option.Sources {
+			template.Options.Sources = append(template.Options.Sources, translatePath(source, option.DisplayPath))
+		}
+	}
+	if job.LastRunAt != nil {
+		template.LastRunAt = job.LastRunAt.Format(timeFormat)
+	}
+	if job.NextRunAt != nil {
+		template.NextRunAt = job.NextRunAt.Format(timeFormat)
+	}
+	return template
+}
+
+func NewScheduleJobListTemplate(jobs []database.ScheduleJob) []ScheduleJobTemplate {
+	data := make([]ScheduleJobTemplate, 0)
+	for idx := range jobs {
+		data = append(data, NewScheduleJobTemplate(&jobs[idx]))
+	}
+	return data
+}
+
+type ScheduleRunTemplate struct {
+	Id      uint   `json:"id"`
+	JobId   uint   `json:"jobId"`
+	TaskId  string `json:"taskId,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	StartAt string `json:"startAt"`
+	StopAt  string `json:"stopAt,omitempty"`
+}
+
+func NewScheduleRunListTemplate(runs []database.ScheduleRun) []ScheduleRunTemplate {
+	data := make([]ScheduleRunTemplate, 0)
+	for _, run := range runs {
+		template := ScheduleRunTemplate{
+			Id:      run.ID,
+			JobId:   run.JobId,
+			TaskId:  run.TaskId,
+			Status:  run.Status,
+			Error:   run.Error,
+			StartAt: run.StartAt.Format(timeFormat),
+		}
+		if run.StopAt != nil {
+			template.StopAt = run.StopAt.Format(timeFormat)
+		}
+		data = append(data, template)
+	}
+	return data
+}
@@ -0,0 +1,97 @@
+package template
+
+import (
+	"path/filepath"
+	"youfile/service"
+)
+
+type SyncDiffItemTemplate struct {
+	Path             string `json:"path"`
+	Name             string `json:"name"`
+	IsDir            bool   `json:"isDir"`
+	Action           string `json:"action"`
+	Direction        string `json:"direction,omitempty"`
+	SourceSize       int64  `json:"sourceSize"`
+	TargetSize       int64  `json:"targetSize"`
+	SourceModifyTime string `json:"sourceModifyTime,omitempty"`
+	TargetModifyTime string `json:"targetModifyTime,omitempty"`
+	Skip             bool   `json:"skip"`
+}
+
+func NewSyncDiffListTemplate(items []*service.SyncDiffItem) []SyncDiffItemTemplate {
+	data := make([]SyncDiffItemTemplate, 0)
+	for _, item := range items {
+		template := SyncDiffItemTemplate{
+			Path:       filepath.ToSlash(item.Path),
+			Name:       filepath.Base(item.Path),
+			IsDir:      item.IsDir,
+			Action:     item.Action,
+			Direction:  item.Direction,
+			SourceSize: item.SourceSize,
+			TargetSize: item.TargetSize,
+			Skip:       item.Skip,
+		}
+		if !item.SourceModTime.IsZero() {
+			template.SourceModifyTime = item.SourceModTime.Format(timeFormat)
+		}
+		if !item.TargetModTime.IsZero() {
+			template.TargetModifyTime = item.TargetModTime.Format(timeFormat)
+		}
+		data = append(data, template)
+	}
+	return data
+}
+
+type SyncOutputTemplate struct {
+	Source         string   `json:"source"`
+	Target         string   `json:"target"`
+	Mode           string   `json:"mode"`
+	Phase          string   `json:"phase"`
+	DryRun         bool     `json:"dryRun"`
+	ScanCount      int      `json:"scanCount"`
+	Added          int      `json:"added"`
+	Changed        int      `json:"changed"`
+	Deleted        int      `json:"deleted"`
+	Conflict       int      `json:"conflict"`
+	Skipped        int      `json:"skipped"`
+	TotalLength    int64    `json:"totalLength"`
+	CompleteLength int64    `json:"completeLength"`
+	FileCount      int      `json:"fileCount"`
+	Complete       int      `json:"complete"`
+	CurrentFile    string   `json:"currentFile"`
+	Progress       float64  `json:"progress"`
+	Speed          int64    `json:"speed"`
+	Errors         []string `json:"errors"`
+}
+
+func (t *SyncOutputTemplate) Serialize(task service.Task) {
+	syncTask := task.(*service.SyncTask)
+	syncTask.Lock()
+	defer syncTask.Unlock()
+	output := syncTask.Output
+	t.Source = translatePath(syncTask.Option.Source, syncTask.Option.DisplayPath)
+	t.Target = translatePath(syncTask.Option.Target, syncTask.Option.DisplayPath)
+	t.Mode = syncTask.Option.Mode
+	t.Phase = output.Phase
+	t.DryRun = output.DryRun
+	t.ScanCount = output.ScanCount
+	t.Added = output.Added
+	t.Changed = output.Changed
+	t.Deleted = output.Deleted
+	t.Conflict = output.Conflict
+	t.Skipped = output.Skipped
+	t.TotalLength = output.TotalLength
+	t.CompleteLength = output.CompleteLength
+	t.FileCount = output.FileCount
+	t.Complete = output.Complete
+	t.CurrentFile = translatePath(output.CurrentFile, syncTask.Option.DisplayPath)
+	t.Progress = output.Progress
+	t.Speed = output.Speed
+	t.Errors = output.Errors
+}
+
+func SerializeSyncOutput(data *service.SyncTask) interface{} {
+	template := SyncOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
@@ -43,11 +43,21 @@ func SerializeTaskOutput(data interface{}) interface{} {
 	case *service.DeleteFileTask:
 		return SerializeDeleteFileOutput(v)
 	case *service.ArchiveTask:
-		return map[string]interface{}{}
+		return SerializeArchiveOutput(v)
 	case *service.ExtractTask:
 		return SerializeExtractOutput(v)
+	case *service.ArchiveTestTask:
+		return SerializeArchiveTestOutput(v)
 	case *service.MoveTask:
 		return SerializeMoveFileOutput(v)
+	case *service.DiskUsageTask:
+		return SerializeDiskUsageOutput(v)
+	case *service.FindDuplicatesTask:
+		return SerializeFindDuplicatesOutput(v)
+	case *service.SyncTask:
+		return SerializeSyncOutput(v)
+	case *service.AudioTagTask:
+		return SerializeAudioTagOutput(v)
 	default:
 		return data
 	}
@@ -163,21 +173,43 @@ type ExtractOption struct {
 	Source        CopyFile `json:"source"`
 	Dest          string   `json:"dest"`
 	DestDirectory string   `json:"destDirectory"`
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+	TotalSize     int64    `json:"totalSize"`
+	CompleteSize  int64    `json:"completeSize"`
+	TotalEntry    int64    `json:"totalEntry"`
+	CompleteEntry int64    `json:"completeEntry"`
+	Volumes       int      `json:"volumes"`
 }
 type ExtractOutputTemplate struct {
-	Complete int             `json:"complete"`
-	Total    int             `json:"total"`
-	Files    []ExtractOption `json:"files"`
+	Complete      int             `json:"complete"`
+	Total         int             `json:"total"`
+	TotalSize     int64           `json:"totalSize"`
+	CompleteSize  int64           `json:"completeSize"`
+	CompleteEntry int64           `json:"completeEntry"`
+	CurrentEntry  string          `json:"currentEntry"`
+	Progress      float64         `json:"progress"`
+	Speed         int64           `json:"speed"`
+	Files         []ExtractOption `json:"files"`
 }
 
 func (t *ExtractOutputTemplate) Serialize(task service.Task) {
 	extractTask := task.(*service.ExtractTask)
+	extractTask.Lock()
+	defer extractTask.Unlock()
 	t.Complete = extractTask.Output.Complete
 	t.Total = extractTask.Output.Total
+	t.TotalSize = extractTask.Output.TotalSize
+	t.CompleteSize = extractTask.Output.CompleteSize
+	t.CompleteEntry = extractTask.Output.CompleteEntry
+	t.CurrentEntry = extractTask.Output.CurrentEntry
+	t.Progress = extractTask.Output.Progress
+	t.Speed = extractTask.Output.Speed
 	t.Files = []ExtractOption{}
-	for _, extractOption := range extractTask.Input {
+	for idx, extractOption := range extractTask.Input {
 		displaySourcePath := extractTask.Option.DisplayPath[extractOption.Input]
 		displayDestPath := extractTask.Option.DisplayPath[extractOption.Output]
+		state := extractTask.Output.Inputs[idx]
 		t.Files = append(t.Files, ExtractOption{
 			Source: CopyFile{
 				Path:      displaySourcePath,
@@ -186,10 +218,119 @@ func (t *ExtractOutputTemplate) Serialize(task service.Task) {
 			},
 			Dest:          displayDestPath,
 			DestDirectory: filepath.Dir(displayDestPath),
+			Status:        state.Status,
+			Error:         state.Error,
+			TotalSize:     state.TotalSize,
+			CompleteSize:  state.CompleteSize,
+			TotalEntry:    state.TotalEntry,
+			CompleteEntry: state.CompleteEntry,
+			Volumes:       len(extractOption.Volumes),
 		})
 	}
 }
 
+func SerializeArchiveOutput(data *service.ArchiveTask) interface{} {
+	template := ArchiveOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
+
+type ArchiveOutputTemplate struct {
+	TotalSize     int64    `json:"totalSize"`
+	CompleteSize  int64    `json:"completeSize"`
+	TotalEntry    int64    `json:"totalEntry"`
+	CompleteEntry int64    `json:"completeEntry"`
+	CurrentEntry  string   `json:"currentEntry"`
+	Progress      float64  `json:"progress"`
+	Speed         int64    `json:"speed"`
+	Volumes       []string `json:"volumes"`
+}
+
+func (t *ArchiveOutputTemplate) Serialize(task service.Task) {
+	archiveTask := task.(*service.ArchiveTask)
+	archiveTask.Lock()
+	defer archiveTask.Unlock()
+	t.TotalSize = archiveTask.Output.TotalSize
+	t.CompleteSize = archiveTask.Output.CompleteSize
+	t.TotalEntry = archiveTask.Output.TotalEntry
+	t.CompleteEntry = archiveTask.Output.CompleteEntry
+	t.CurrentEntry = archiveTask.Output.CurrentEntry
+	t.Progress = archiveTask.Output.Progress
+	t.Speed = archiveTask.Output.Speed
+	t.Volumes = []string{}
+	for _, volume := range archiveTask.Output.Volumes {
+		t.Volumes = append(t.Volumes, filepath.Base(volume))
+	}
+}
+
+func SerializeArchiveTestOutput(data *service.ArchiveTestTask) interface{} {
+	template := ArchiveTestOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
+
+type ArchiveTestFailureTemplate struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+type ArchiveTestArchiveTemplate struct {
+	Path          string                       `json:"path"`
+	Name          string                       `json:"name"`
+	Status        string                       `json:"status"`
+	Error         string                       `json:"error,omitempty"`
+	WrongPassword bool                         `json:"wrongPassword"`
+	Failures      []ArchiveTestFailureTemplate `json:"failures"`
+	TotalSize     int64                        `json:"totalSize"`
+	CompleteSize  int64                        `json:"completeSize"`
+}
+type ArchiveTestOutputTemplate struct {
+	Complete     int                          `json:"complete"`
+	Total        int                          `json:"total"`
+	Failed       int                          `json:"failed"`
+	TotalSize    int64                        `json:"totalSize"`
+	CompleteSize int64                        `json:"completeSize"`
+	CurrentEntry string                       `json:"currentEntry"`
+	Progress     float64                      `json:"progress"`
+	Speed        int64                        `json:"speed"`
+	Archives     []ArchiveTestArchiveTemplate `json:"archives"`
+}
+
+func (t *ArchiveTestOutputTemplate) Serialize(task service.Task) {
+	testTask := task.(*service.ArchiveTestTask)
+	testTask.Lock()
+	defer testTask.Unlock()
+	output := testTask.Output
+	t.Complete = output.Complete
+	t.Total = output.Total
+	t.Failed = output.Failed
+	t.TotalSize = output.TotalSize
+	t.CompleteSize = output.CompleteSize
+	t.CurrentEntry = output.CurrentEntry
+	t.Progress = output.Progress
+	t.Speed = output.Speed
+	t.Archives = []ArchiveTestArchiveTemplate{}
+	for _, state := range output.Archives {
+		displayPath := translatePath(state.Path, testTask.Option.DisplayPath)
+		archiveTemplate := ArchiveTestArchiveTemplate{
+			Path:          displayPath,
+			Name:          filepath.Base(displayPath),
+			Status:        state.Status,
+			Error:         state.Error,
+			WrongPassword: state.WrongPassword,
+			Failures:      []ArchiveTestFailureTemplate{},
+			TotalSize:     state.TotalSize,
+			CompleteSize:  state.CompleteSize,
+		}
+		for _, failure := range state.Failures {
+			archiveTemplate.Failures = append(archiveTemplate.Failures, ArchiveTestFailureTemplate{
+				Path:  failure.Path,
+				Error: failure.Error,
+			})
+		}
+		t.Archives = append(t.Archives, archiveTemplate)
+	}
+}
+
 func SerializeMoveFileOutput(data *service.MoveTask) interface{} {
 	template := MoveFileOutputTemplate{}
 	template.Serialize(data)
@@ -243,3 +384,48 @@ func (t *MoveFileOutputTemplate) Serialize(task service.Task) {
 		})
 	}
 }
+
+func SerializeAudioTagOutput(data *service.AudioTagTask) interface{} {
+	template := AudioTagOutputTemplate{}
+	template.Serialize(data)
+	return template
+}
+
+type AudioTagFileTemplate struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+type AudioTagOutputTemplate struct {
+	FileCount int                    `json:"fileCount"`
+	Complete  int                    `json:"complete"`
+	Failed    int                    `json:"failed"`
+	Progress  float64                `json:"progress"`
+	Current   string                 `json:"current"`
+	UndoOf    string                 `json:"undoOf,omitempty"`
+	Files     []AudioTagFileTemplate `json:"files"`
+}
+
+func (t *AudioTagOutputTemplate) Serialize(task service.Task) {
+	tagTask := task.(*service.AudioTagTask)
+	tagTask.Lock()
+	defer tagTask.Unlock()
+	output := tagTask.Output
+	t.FileCount = output.FileCount
+	t.Complete = output.Complete
+	t.Failed = output.Failed
+	t.Progress = output.Progress
+	t.Current = translatePath(output.Current, tagTask.Option.DisplayPath)
+	t.UndoOf = tagTask.UndoOf
+	t.Files = []AudioTagFileTemplate{}
+	for _, state := range output.Files {
+		displayPath := translatePath(state.Path, tagTask.Option.DisplayPath)
+		t.Files = append(t.Files, AudioTagFileTemplate{
+			Path:   displayPath,
+			Name:   filepath.Base(displayPath),
+			Status: state.Status,
+			Error:  state.Error,
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package template
+
+import "youfile/service"
+
+type ThumbnailStatsTemplate struct {
+	Count   int64   `json:"count"`
+	Files   int64   `json:"files"`
+	Bytes   int64   `json:"bytes"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+func NewThumbnailStatsTemplate(stats *service.ThumbnailStats) ThumbnailStatsTemplate {
+	return ThumbnailStatsTemplate{
+		Count:   stats.Count,
+		Files:   stats.Files,
+		Bytes:   stats.Bytes,
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		HitRate: stats.HitRate(),
+	}
+}
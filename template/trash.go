@@ -0,0 +1,32 @@
+package template
+
+import (
+	"path/filepath"
+	"youfile/database"
+)
+
+type TrashItemTemplate struct {
+	Id        uint   `json:"id"`
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Directory string `json:"directory"`
+	TrashAt   string `json:"trashAt"`
+}
+
+func NewTrashItemTemplate(item *database.TrashItem) TrashItemTemplate {
+	return TrashItemTemplate{
+		Id:        item.ID,
+		Path:      item.DisplayPath,
+		Name:      filepath.Base(item.DisplayPath),
+		Directory: filepath.Dir(item.DisplayPath),
+		TrashAt:   item.CreatedAt.Format(timeFormat),
+	}
+}
+
+func NewTrashItemListTemplate(items []database.TrashItem) []TrashItemTemplate {
+	data := make([]TrashItemTemplate, 0)
+	for idx := range items {
+		data = append(data, NewTrashItemTemplate(&items[idx]))
+	}
+	return data
+}
@@ -6,6 +6,12 @@ import (
 	"sync"
 )
 
+type DiskUsageInfo struct {
+	Total     uint64
+	Free      uint64
+	Available uint64
+}
+
 var (
 	CopyInterrupt = errors.New("stop with interrupt")
 )
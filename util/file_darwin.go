@@ -1,6 +1,10 @@
 package util
 
-import "os"
+import (
+	"errors"
+	"os"
+	"syscall"
+)
 
 func ReadDisks() ([]string, error) {
 	return nil, nil
@@ -19,3 +23,55 @@ func ReadStartDirectory() []*StartDirectory {
 	}
 	return directories
 }
+
+// FileInode return inode of file, 0 if unknown
+func FileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
+
+// FileDevice return device of file, 0 if unknown
+func FileDevice(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+// FileLinkCount return count of hard links of file, 1 if unknown
+func FileLinkCount(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
+
+// CopyFileOwner change owner and group of path to those of file
+func CopyFileOwner(path string, info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return os.Lchown(path, int(stat.Uid), int(stat.Gid))
+	}
+	return nil
+}
+
+// DiskUsage return total, free and available bytes of filesystem contains path
+func DiskUsage(path string) (*DiskUsageInfo, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := uint64(stat.Bsize)
+	return &DiskUsageInfo{
+		Total:     stat.Blocks * blockSize,
+		Free:      stat.Bfree * blockSize,
+		Available: stat.Bavail * blockSize,
+	}, nil
+}
+
+// IsStaleFileError check error is caused by stale handle of network filesystem or disconnected fuse mount
+func IsStaleFileError(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.ENOTCONN)
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
+	"unsafe"
 )
 
 func ReadDisks() ([]string, error) {
@@ -46,3 +47,57 @@ func ReadStartDirectory() []*StartDirectory {
 	})
 	return directories
 }
+
+// FileInode return inode of file, not available on windows
+func FileInode(info os.FileInfo) uint64 {
+	return 0
+}
+
+// FileDevice return device of file, not available on windows
+func FileDevice(info os.FileInfo) uint64 {
+	return 0
+}
+
+// FileLinkCount return count of hard links of file, not available on windows
+func FileLinkCount(info os.FileInfo) uint64 {
+	return 1
+}
+
+// CopyFileOwner change owner of path to owner of file, not available on windows
+func CopyFileOwner(path string, info os.FileInfo) error {
+	return nil
+}
+
+// DiskUsage return total, free and available bytes of volume contains path
+func DiskUsage(path string) (*DiskUsageInfo, error) {
+	kernel32, err := syscall.LoadLibrary("kernel32.dll")
+	if err != nil {
+		return nil, err
+	}
+	getDiskFreeSpaceHandle, err := syscall.GetProcAddress(kernel32, "GetDiskFreeSpaceExW")
+	if err != nil {
+		return nil, err
+	}
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &DiskUsageInfo{}
+	ret, _, callErr := syscall.Syscall6(
+		uintptr(getDiskFreeSpaceHandle), 4,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&info.Available)),
+		uintptr(unsafe.Pointer(&info.Total)),
+		uintptr(unsafe.Pointer(&info.Free)),
+		0, 0,
+	)
+	if ret == 0 {
+		return nil, callErr
+	}
+	return info, nil
+}
+
+// IsStaleFileError check error is caused by stale handle of network filesystem, not detected on windows
+func IsStaleFileError(err error) bool {
+	return false
+}
@@ -23,3 +23,11 @@ func GenerateRPCTimeoutContext() context.Context {
 	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
 	return ctx
 }
+
+func IsSubPath(root string, target string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(target))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}